@@ -0,0 +1,62 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+)
+
+// AliasWriteMode tells how the writes to a value shared through a YAML alias
+// or merge key are handled.
+//
+// The getters of KubeObject and SubObject, e.g. NestedString, GetPath and As,
+// follow the YAML aliases (`*defaults`) and merge keys (`<<: *defaults`) as if
+// the shared values were written in place. The writes by field path, e.g.
+// SetNestedField, SetPath, RemoveNestedField and RemovePath, never modify a
+// shared value: they either copy it on the written path only, or fail. A write
+// at the anchor itself, e.g. to `labels: &labels` with `matchLabels: *labels`,
+// replaces its aliases by copies of the value first. The anchors and aliases
+// which are not written are kept when the KubeObject is serialized.
+//
+// A SubObject returned by a getter for an aliased map, e.g. NestedSubObject for
+// `spec: *defaults`, is the anchored map itself: its setters modify all the
+// aliases. Write through the parent KubeObject to modify a single one.
+type AliasWriteMode int
+
+const (
+	// CopyAliasOnWrite replaces the shared value by a copy on the written path,
+	// leaving the anchor and the other aliases unchanged. It is the default.
+	CopyAliasOnWrite AliasWriteMode = iota
+	// FailOnAliasWrite fails the writes to a shared value with an error
+	// wrapping ErrAliasedField.
+	FailOnAliasWrite
+)
+
+// ErrAliasedField is wrapped by the errors of the writes to a shared value in
+// the FailOnAliasWrite mode.
+var ErrAliasedField = internal.ErrAliasedField
+
+// SetAliasWriteMode sets how the writes to a value shared through a YAML alias
+// or merge key are handled in the KubeObject and its SubObjects.
+func (o *KubeObject) SetAliasWriteMode(mode AliasWriteMode) {
+	o.obj.SetAliases(o.obj.Aliases().WithFailOnWrite(mode == FailOnAliasWrite))
+}
+
+// SetAliasWriteMode sets the AliasWriteMode of all the KubeObjects.
+func (o KubeObjects) SetAliasWriteMode(mode AliasWriteMode) {
+	for _, obj := range o {
+		obj.SetAliasWriteMode(mode)
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var aliasedConfigMaps = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+  labels: &labels
+    app: web
+    tier: frontend
+  annotations:
+    <<: *labels
+    owner: team-a
+data: &data
+  color: blue
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: api
+  labels: *labels
+data:
+  <<: *data
+  size: large
+`
+
+func TestAliasReads(t *testing.T) {
+	objs, err := ParseKubeObjects([]byte(aliasedConfigMaps))
+	require.NoError(t, err)
+	web, api := objs[0], objs[1]
+
+	owner, _, _ := web.NestedString("metadata", "annotations", "owner")
+	assert.Equal(t, "team-a", owner)
+	tier, found, err := web.NestedString("metadata", "annotations", "tier")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "frontend", tier)
+	assert.Equal(t, map[string]string{"app": "web", "tier": "frontend", "owner": "team-a"}, web.GetAnnotations())
+
+	assert.Equal(t, map[string]string{"app": "web", "tier": "frontend"}, api.GetLabels())
+	color, _, _ := api.NestedString("data", "color")
+	assert.Equal(t, "blue", color)
+	matches, err := api.GetPath("data.color")
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	assert.Equal(t, "blue\n", matches[0].String())
+}
+
+func TestAliasWrites(t *testing.T) {
+	testcases := map[string]struct {
+		write    func(o *KubeObject) error
+		expected string
+	}{
+		"set through an alias": {
+			write: func(o *KubeObject) error {
+				return o.SetNestedField("api", "metadata", "labels", "app")
+			},
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: api
+  labels:
+    app: api
+    tier: frontend
+data:
+  <<: *data
+  size: large
+`,
+		},
+		"set a merged field": {
+			write: func(o *KubeObject) error {
+				return o.SetNestedField("red", "data", "color")
+			},
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: api
+  labels: *labels
+data:
+  <<: *data
+  size: large
+  color: red
+`,
+		},
+		"remove a merged field": {
+			write: func(o *KubeObject) error {
+				_, err := o.RemoveNestedField("data", "color")
+				return err
+			},
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: api
+  labels: *labels
+data:
+  size: large
+`,
+		},
+		"set path through an alias": {
+			write: func(o *KubeObject) error {
+				_, err := o.SetPath("backend", "metadata.labels.tier")
+				return err
+			},
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: api
+  labels:
+    app: web
+    tier: backend
+data:
+  <<: *data
+  size: large
+`,
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			objs, err := ParseKubeObjects([]byte(aliasedConfigMaps))
+			require.NoError(t, err)
+			web, api := objs[0], objs[1]
+			webBefore := web.String()
+
+			require.NoError(t, tc.write(api))
+			assert.Equal(t, tc.expected, api.String())
+			assert.Equal(t, webBefore, web.String())
+		})
+	}
+}
+
+func TestFailOnAliasWrite(t *testing.T) {
+	objs, err := ParseKubeObjects([]byte(aliasedConfigMaps))
+	require.NoError(t, err)
+	web, api := objs[0], objs[1]
+	api.SetAliasWriteMode(FailOnAliasWrite)
+
+	err = api.SetNestedField("api", "metadata", "labels", "app")
+	assert.True(t, errors.Is(err, ErrAliasedField))
+	assert.ErrorContains(t, err, `unable to write the field "labels" shared with the anchor &labels at line 5`)
+	_, err = api.RemoveNestedField("data", "color")
+	assert.True(t, errors.Is(err, ErrAliasedField))
+
+	require.NoError(t, api.SetNestedField("small", "data", "size"))
+	size, _, _ := api.NestedString("data", "size")
+	assert.Equal(t, "small", size)
+
+	// The mode is set per KubeObject.
+	require.NoError(t, web.SetNestedField("web2", "metadata", "labels", "app"))
+	app, _, _ := api.NestedString("metadata", "labels", "app")
+	assert.Equal(t, "web", app)
+}
+
+func TestAnchorWritesAfterRun(t *testing.T) {
+	objs, err := ParseKubeObjects([]byte(aliasedConfigMaps))
+	require.NoError(t, err)
+	web, api := objs[0], objs[1]
+
+	// Running another function doesn't forget the aliases of the KubeObjects.
+	_, err = Run(ResourceListProcessorFunc(func(rl *ResourceList) (bool, error) { return true, nil }), []byte(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+`))
+	require.NoError(t, err)
+
+	require.NoError(t, web.SetNestedField("web2", "metadata", "labels", "app"))
+	app, _, _ := api.NestedString("metadata", "labels", "app")
+	assert.Equal(t, "web", app)
+}
+
+func TestDeepCopyAliases(t *testing.T) {
+	objs, err := ParseKubeObjects([]byte(aliasedConfigMaps))
+	require.NoError(t, err)
+	web, api := objs[0], objs[1]
+
+	// The copy holds the values of the anchors of the other KubeObjects.
+	copied := api.DeepCopy()
+	require.NoError(t, web.SetNestedField("web2", "metadata", "labels", "app"))
+	require.NoError(t, web.SetNestedField("red", "data", "color"))
+	assert.Equal(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: api
+  labels:
+    app: web
+    tier: frontend
+data:
+  <<:
+    color: blue
+  size: large
+`, copied.String())
+}
+
+func TestAnchorWrites(t *testing.T) {
+	testcases := map[string]struct {
+		input    string
+		write    func(o *KubeObject) error
+		expected string
+	}{
+		"set in an anchored map": {
+			input: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels: &labels
+    app: nginx
+spec:
+  selector:
+    matchLabels: *labels
+`,
+			write: func(o *KubeObject) error {
+				return o.SetLabel("tier", "frontend")
+			},
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels:
+    app: nginx
+    tier: frontend
+spec:
+  selector:
+    matchLabels:
+      app: nginx
+`,
+		},
+		"set a merged anchored map": {
+			input: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+  labels: &labels
+    app: web
+  annotations:
+    <<: *labels
+`,
+			write: func(o *KubeObject) error {
+				return o.SetNestedField("api", "metadata", "labels", "app")
+			},
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+  labels:
+    app: api
+  annotations:
+    <<:
+      app: web
+`,
+		},
+		"set an anchored scalar": {
+			input: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  a: &v foo
+  b: *v
+`,
+			write: func(o *KubeObject) error {
+				return o.SetNestedString("bar", "data", "a")
+			},
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  a: bar
+  b: foo
+`,
+		},
+		"set path to an anchored scalar": {
+			input: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  a: &v foo
+  b: *v
+`,
+			write: func(o *KubeObject) error {
+				_, err := o.SetPath("bar", "data.*")
+				return err
+			},
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  a: bar
+  b: bar
+`,
+		},
+		"remove an anchored scalar": {
+			input: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  a: &v foo
+  b: *v
+`,
+			write: func(o *KubeObject) error {
+				_, err := o.RemoveNestedField("data", "a")
+				return err
+			},
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  b: foo
+`,
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			obj, err := ParseKubeObject([]byte(tc.input))
+			require.NoError(t, err)
+			require.NoError(t, tc.write(obj))
+			assert.Equal(t, tc.expected, obj.String())
+			// The output is still valid YAML.
+			_, err = ParseKubeObject([]byte(obj.String()))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestFailOnAnchorWrite(t *testing.T) {
+	objs, err := ParseKubeObjects([]byte(aliasedConfigMaps))
+	require.NoError(t, err)
+	KubeObjects(objs).SetAliasWriteMode(FailOnAliasWrite)
+	web := objs[0]
+
+	err = web.SetNestedField("web2", "metadata", "labels", "app")
+	assert.True(t, errors.Is(err, ErrAliasedField))
+	err = web.SetNestedField("red", "data", "color")
+	assert.True(t, errors.Is(err, ErrAliasedField))
+	_, err = web.RemoveNestedField("data")
+	assert.True(t, errors.Is(err, ErrAliasedField))
+
+	require.NoError(t, web.SetNestedField("team-b", "metadata", "annotations", "owner"))
+}
@@ -0,0 +1,214 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// FieldChangeType tells how a field differs between two KubeObjects.
+type FieldChangeType string
+
+const (
+	// FieldAdded means the field only exists in the new object.
+	FieldAdded FieldChangeType = "added"
+	// FieldRemoved means the field only exists in the old object.
+	FieldRemoved FieldChangeType = "removed"
+	// FieldModified means the field exists in both objects with different values.
+	FieldModified FieldChangeType = "modified"
+)
+
+// FieldChange describes a field that differs between two KubeObjects.
+type FieldChange struct {
+	// Type is how the field changed.
+	Type FieldChangeType
+	// Path is the field path, e.g. `spec.template.spec.containers[name=nginx].image`.
+	Path string
+	// OldValue is the field value in the old object. It is nil if the field is added.
+	OldValue interface{}
+	// NewValue is the field value in the new object. It is nil if the field is removed.
+	NewValue interface{}
+}
+
+// String provides a human-readable message for the change.
+func (c FieldChange) String() string {
+	switch c.Type {
+	case FieldAdded:
+		return fmt.Sprintf("field %v added with value %v", c.Path, c.NewValue)
+	case FieldRemoved:
+		return fmt.Sprintf("field %v removed, was %v", c.Path, c.OldValue)
+	default:
+		return fmt.Sprintf("field %v changed from %v to %v", c.Path, c.OldValue, c.NewValue)
+	}
+}
+
+// Result converts the change of a field in obj to a Result whose Field.CurrentValue
+// and Field.ProposedValue are the old and the new values.
+func (c FieldChange) Result(obj *KubeObject, severity Severity) *Result {
+	result := ConfigObjectResult(c.String(), obj, severity)
+	result.Field = &Field{
+		Path:          c.Path,
+		CurrentValue:  c.OldValue,
+		ProposedValue: c.NewValue,
+	}
+	return result
+}
+
+// FieldChangesToResults converts the changes of obj to Results.
+func FieldChangesToResults(changes []FieldChange, obj *KubeObject, severity Severity) Results {
+	var results Results
+	for _, c := range changes {
+		results = append(results, c.Result(obj, severity))
+	}
+	return results
+}
+
+// Diff compares two KubeObjects field by field and returns the added, removed
+// and modified fields. Comments and formatting are ignored. Sequences whose
+// elements are maps with a unique `name` field are matched by name, e.g.
+// `spec.containers[name=nginx]`; other sequences are matched by index.
+func Diff(before, after *KubeObject) []FieldChange {
+	var beforeNode, afterNode *yaml.Node
+	if before != nil {
+		beforeNode = before.obj.Node()
+	}
+	if after != nil {
+		afterNode = after.obj.Node()
+	}
+	var changes []FieldChange
+	diffNodes("", beforeNode, afterNode, &changes)
+	return changes
+}
+
+func diffNodes(path string, before, after *yaml.Node, changes *[]FieldChange) {
+	// The aliases and the merge keys are compared by their values.
+	before, after = internal.ResolveAlias(before), internal.ResolveAlias(after)
+	switch {
+	case before == nil && after == nil:
+		return
+	case before == nil:
+		*changes = append(*changes, FieldChange{Type: FieldAdded, Path: path, NewValue: nodeValue(after)})
+		return
+	case after == nil:
+		*changes = append(*changes, FieldChange{Type: FieldRemoved, Path: path, OldValue: nodeValue(before)})
+		return
+	}
+	if before.Kind == yaml.MappingNode && after.Kind == yaml.MappingNode {
+		diffMaps(path, before, after, changes)
+		return
+	}
+	if before.Kind == yaml.SequenceNode && after.Kind == yaml.SequenceNode {
+		diffSequences(path, before, after, changes)
+		return
+	}
+	oldValue, newValue := nodeValue(before), nodeValue(after)
+	if before.Kind != after.Kind || !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, FieldChange{Type: FieldModified, Path: path, OldValue: oldValue, NewValue: newValue})
+	}
+}
+
+func diffMaps(path string, before, after *yaml.Node, changes *[]FieldChange) {
+	beforeKeys, beforeNodes := internal.MappingFields(before)
+	afterKeys, afterNodes := internal.MappingFields(after)
+	beforeValues := map[string]*yaml.Node{}
+	for i, key := range beforeKeys {
+		beforeValues[key.Value] = beforeNodes[i]
+	}
+	afterValues := map[string]*yaml.Node{}
+	for i, key := range afterKeys {
+		afterValues[key.Value] = afterNodes[i]
+	}
+	for i, key := range beforeKeys {
+		diffNodes(joinFieldPath(path, key.Value), beforeNodes[i], afterValues[key.Value], changes)
+	}
+	for i, key := range afterKeys {
+		if _, found := beforeValues[key.Value]; !found {
+			diffNodes(joinFieldPath(path, key.Value), nil, afterNodes[i], changes)
+		}
+	}
+}
+
+func diffSequences(path string, before, after *yaml.Node, changes *[]FieldChange) {
+	beforeNames, beforeOk := elementNames(before)
+	afterNames, afterOk := elementNames(after)
+	if !beforeOk || !afterOk {
+		for i := 0; i < len(before.Content) || i < len(after.Content); i++ {
+			var b, a *yaml.Node
+			if i < len(before.Content) {
+				b = before.Content[i]
+			}
+			if i < len(after.Content) {
+				a = after.Content[i]
+			}
+			diffNodes(fmt.Sprintf("%s[%d]", path, i), b, a, changes)
+		}
+		return
+	}
+	afterByName := map[string]*yaml.Node{}
+	for i, name := range afterNames {
+		afterByName[name] = after.Content[i]
+	}
+	beforeByName := map[string]*yaml.Node{}
+	for i, name := range beforeNames {
+		beforeByName[name] = before.Content[i]
+		diffNodes(path+selectorString("name", name), before.Content[i], afterByName[name], changes)
+	}
+	for i, name := range afterNames {
+		if _, found := beforeByName[name]; !found {
+			diffNodes(path+selectorString("name", name), nil, after.Content[i], changes)
+		}
+	}
+}
+
+// elementNames returns the `name` field of every element in the sequence, and
+// whether all elements are maps with a unique name.
+func elementNames(seq *yaml.Node) ([]string, bool) {
+	if len(seq.Content) == 0 {
+		return nil, true
+	}
+	seen := map[string]bool{}
+	var names []string
+	for _, elem := range seq.Content {
+		if elem = internal.ResolveAlias(elem); elem.Kind != yaml.MappingNode {
+			return nil, false
+		}
+		value, found := internal.MappingValue(elem, "name")
+		if !found || value.Kind != yaml.ScalarNode || seen[value.Value] {
+			return nil, false
+		}
+		name := value.Value
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, true
+}
+
+func joinFieldPath(path, key string) string {
+	return strings.TrimPrefix(path+fieldPathKeys(key), ".")
+}
+
+// nodeValue decodes a node to its plain Go value, e.g. string, int, map[string]interface{}.
+func nodeValue(node *yaml.Node) interface{} {
+	var v interface{}
+	if err := node.Decode(&v); err != nil {
+		return node.Value
+	}
+	return v
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	before, err := ParseKubeObject([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels:
+    app: nginx
+spec:
+  replicas: 3 # prod
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.14.2
+        args: [a, b]
+      - name: sidecar
+        image: sidecar:v1
+`))
+	require.NoError(t, err)
+	after, err := ParseKubeObject([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels:
+    tier: web
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: sidecar:v1
+      - name: nginx
+        image: nginx:1.21
+        args: [a, c, d]
+`))
+	require.NoError(t, err)
+
+	expected := []FieldChange{
+		{Type: FieldRemoved, Path: "metadata.labels.app", OldValue: "nginx"},
+		{Type: FieldAdded, Path: "metadata.labels.tier", NewValue: "web"},
+		{Type: FieldModified, Path: "spec.replicas", OldValue: 3, NewValue: 5},
+		{Type: FieldModified, Path: "spec.template.spec.containers[name=nginx].image", OldValue: "nginx:1.14.2", NewValue: "nginx:1.21"},
+		{Type: FieldModified, Path: "spec.template.spec.containers[name=nginx].args[1]", OldValue: "b", NewValue: "c"},
+		{Type: FieldAdded, Path: "spec.template.spec.containers[name=nginx].args[2]", NewValue: "d"},
+	}
+	changes := Diff(before, after)
+	assert.Equal(t, expected, changes)
+
+	results := FieldChangesToResults(changes[2:3], after, Info)
+	require.Len(t, results, 1)
+	assert.Equal(t, &Field{Path: "spec.replicas", CurrentValue: 3, ProposedValue: 5}, results[0].Field)
+	assert.Equal(t, "[info] apps/v1/Deployment/nginx spec.replicas: field spec.replicas changed from 3 to 5", results[0].String())
+
+	assert.Empty(t, Diff(before, before))
+}
+
+func TestDiffPathsCanBeParsed(t *testing.T) {
+	before, err := ParseKubeObject([]byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+spec:
+  containers:
+  - name: "web[0]"
+    image: nginx:1.14.2
+`))
+	require.NoError(t, err)
+	after := before.DeepCopy()
+	_, err = after.SetPath("nginx:1.21", `spec.containers[name="web[0]"].image`)
+	require.NoError(t, err)
+
+	changes := Diff(before, after)
+	require.Len(t, changes, 1)
+	assert.Equal(t, `spec.containers[name="web[0]"].image`, changes[0].Path)
+	image, err := after.GetPath(changes[0].Path)
+	require.NoError(t, err)
+	require.Len(t, image, 1)
+}
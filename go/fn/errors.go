@@ -16,11 +16,8 @@ package fn
 
 import (
 	"fmt"
-	"strings"
 )
 
-const pathDelimitor = "."
-
 // ErrMissingFnConfig raises error if a required functionConfig is missing.
 type ErrMissingFnConfig struct{}
 
@@ -34,6 +31,21 @@ func (ErrAttemptToTouchUpstreamIdentifier) Error() string {
 	return fmt.Sprintf("annotation %v is managed by kpt and should not be modified", UpstreamIdentifier)
 }
 
+// ErrLockedField is returned when a change to a KubeObject adds, modifies or
+// removes a field protected by a FieldLock.
+type ErrLockedField struct {
+	// Lock is the name of the FieldLock which protects the field.
+	Lock string
+	// Object is the KubeObject holding the field.
+	Object *KubeObject
+	// Path is the path of the locked field, e.g. `spec.selector`.
+	Path string
+}
+
+func (e *ErrLockedField) Error() string {
+	return fmt.Sprintf("field %v of %v is locked by %v and should not be modified", e.Path, e.Object.ShortString(), e.Lock)
+}
+
 type ErrInternalAnnotation struct {
 	Message string
 }
@@ -44,8 +56,7 @@ func (e *ErrInternalAnnotation) Error() string {
 
 // NewErrUnmatchedField returns a ErrUnmatchedField error with the specific field path of a KubeObject that has the mismatched data type.
 func NewErrUnmatchedField(obj SubObject, fields []string, expectedFieldType any) *ErrUnmatchedField {
-	relativefields := strings.Join(fields, pathDelimitor)
-	obj.fieldpath += pathDelimitor + relativefields
+	obj.fieldpath += fieldPathKeys(fields...)
 	return &ErrUnmatchedField{
 		SubObject: &obj, DataType: fmt.Sprintf("%T", expectedFieldType),
 	}
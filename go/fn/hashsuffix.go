@@ -0,0 +1,175 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
+)
+
+const (
+	// NameSuffixHashAnnotation opts a ConfigMap or a Secret in or out of the name
+	// suffix hash of AddNameSuffixHashes, with the "true" and "false" values.
+	NameSuffixHashAnnotation = "kpt.dev/name-suffix-hash"
+	// AppliedNameSuffixHashAnnotation records the content hash appended to the
+	// name of a ConfigMap or a Secret by AddNameSuffixHashes, so that the suffix
+	// is replaced instead of appended again when the content changes.
+	AppliedNameSuffixHashAnnotation = "kpt.dev/applied-name-suffix-hash"
+)
+
+// NameSuffixHash returns the content hash of a ConfigMap or a Secret. Like the
+// kustomize hash suffix, it is computed from the kind, the base name and the
+// data of the object, so it does not depend on the order of the keys, the
+// comments or the other metadata. baseName is the name without hash suffix.
+func NameSuffixHash(obj *KubeObject, baseName string) (string, error) {
+	content := map[string]interface{}{
+		"kind": obj.GetKind(),
+		"name": baseName,
+	}
+	fields := []string{"data", "binaryData"}
+	if obj.IsGroupKind(schema.GroupKind{Kind: "Secret"}) {
+		content["type"] = obj.GetString("type")
+		fields = []string{"data", "stringData"}
+	}
+	for _, field := range fields {
+		data, found, err := obj.NestedStringMap(field)
+		if err != nil {
+			return "", err
+		}
+		if found && len(data) > 0 {
+			content[field] = data
+		}
+	}
+	// encoding/json sorts the map keys.
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	return encodeHash(fmt.Sprintf("%x", sha256.Sum256(encoded))), nil
+}
+
+// encodeHash shortens the hex encoded hash to 10 characters, and replaces the
+// vowels and the digits which look like vowels, so that the hash never spells
+// a word. This is the same encoding as the kustomize hash suffix.
+func encodeHash(hex string) string {
+	enc := []rune(hex[:10])
+	for i := range enc {
+		switch enc[i] {
+		case '0':
+			enc[i] = 'g'
+		case '1':
+			enc[i] = 'h'
+		case '3':
+			enc[i] = 'k'
+		case 'a':
+			enc[i] = 'm'
+		case 'e':
+			enc[i] = 't'
+		}
+	}
+	return string(enc)
+}
+
+// needsNameSuffixHash tells whether AddNameSuffixHashes renames the KubeObject.
+func needsNameSuffixHash(obj *KubeObject) bool {
+	if !obj.IsGroupKind(schema.GroupKind{Kind: "ConfigMap"}) && !obj.IsGroupKind(schema.GroupKind{Kind: "Secret"}) {
+		return false
+	}
+	if obj.IsLocalConfig() {
+		return false
+	}
+	switch obj.GetAnnotation(NameSuffixHashAnnotation) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return obj.GetAnnotation(AppliedNameSuffixHashAnnotation) != "" || isGenerated(obj)
+}
+
+// isGenerated tells whether the KubeObject has been generated by a function,
+// i.e. it has not been read from a file of the package.
+func isGenerated(obj *KubeObject) bool {
+	return obj.PathAnnotation() == "" && obj.GetAnnotation(kioutil.LegacyPathAnnotation) == ""
+}
+
+// AddNameSuffixHashes appends the content hash to the name of the ConfigMaps
+// and Secrets of items, and updates the references to them in the other items,
+// e.g. the workload volumes and envFrom. This way, the workloads are rolled out
+// again when their configuration changes.
+//
+// Only the ConfigMaps and Secrets annotated with
+// `kpt.dev/name-suffix-hash: "true"`, generated by the previous functions, i.e.
+// without the `internal.config.kubernetes.io/path` annotation, or renamed
+// before are renamed, since the other objects of the package may be referenced
+// by name from outside the package. The local config objects and the objects annotated with
+// `kpt.dev/name-suffix-hash: "false"` are skipped.
+//
+// AddNameSuffixHashes is idempotent: the hash suffix of an already suffixed
+// object is replaced by the hash of the current content. It returns the changed
+// fields, see Rename.
+func AddNameSuffixHashes(items KubeObjects) ([]ObjectFieldChange, error) {
+	var changes []ObjectFieldChange
+	for _, obj := range items {
+		if !needsNameSuffixHash(obj) {
+			continue
+		}
+		baseName := obj.GetName()
+		if previous := obj.GetAnnotation(AppliedNameSuffixHashAnnotation); previous != "" {
+			baseName = strings.TrimSuffix(baseName, "-"+previous)
+		}
+		hash, err := NameSuffixHash(obj, baseName)
+		if err != nil {
+			return changes, fmt.Errorf("unable to hash %v with error: %w", obj.ShortString(), err)
+		}
+		renamed, err := Rename(items, obj, baseName+"-"+hash)
+		changes = append(changes, renamed...)
+		if err != nil {
+			return changes, err
+		}
+		if err := obj.SetAnnotation(AppliedNameSuffixHashAnnotation, hash); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// NameSuffixHasher is a Runner which appends the content hash to the name of
+// the ConfigMaps and Secrets, see AddNameSuffixHashes. It can be chained after
+// the functions generating the ConfigMaps and Secrets, e.g.
+//
+//	fn.AsMain(fn.WithContext(ctx, &fn.NameSuffixHasher{}))
+type NameSuffixHasher struct{}
+
+var _ Runner = &NameSuffixHasher{}
+
+func (*NameSuffixHasher) Run(_ *Context, _ *KubeObject, items KubeObjects, results *Results) bool {
+	changes, err := AddNameSuffixHashes(items)
+	if err != nil {
+		results.ErrorE(err)
+		return false
+	}
+	for _, c := range changes {
+		if c.Path == "metadata.name" {
+			results.Infof("renamed %v %q to %q", c.Object.GetKind(), c.OldValue, c.NewValue)
+		}
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameSuffixHash(t *testing.T) {
+	testcases := map[string]struct {
+		a, b  string
+		equal bool
+	}{
+		"key order and comments": {
+			a: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  a: "1"
+  b: "2"
+`,
+			b: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  labels:
+    app: app
+# the data
+data:
+  b: "2" # b
+  a: "1"
+`,
+			equal: true,
+		},
+		"data": {
+			a: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  a: "1"
+`,
+			b: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  a: "2"
+`,
+		},
+		"kind": {
+			a: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  a: MQ==
+`,
+			b: `apiVersion: v1
+kind: Secret
+metadata:
+  name: config
+data:
+  a: MQ==
+`,
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			a, err := ParseKubeObject([]byte(tc.a))
+			require.NoError(t, err)
+			b, err := ParseKubeObject([]byte(tc.b))
+			require.NoError(t, err)
+			hashA, err := NameSuffixHash(a, a.GetName())
+			require.NoError(t, err)
+			hashB, err := NameSuffixHash(b, b.GetName())
+			require.NoError(t, err)
+			assert.Len(t, hashA, 10)
+			assert.Equal(t, tc.equal, hashA == hashB)
+		})
+	}
+}
+
+func TestAddNameSuffixHashes(t *testing.T) {
+	items, err := ParseKubeObjects([]byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  mode: prod
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: static
+  annotations:
+    kpt.dev/name-suffix-hash: "false"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: package
+  annotations:
+    internal.config.kubernetes.io/path: package.yaml
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: opted-in
+  annotations:
+    internal.config.kubernetes.io/path: opted-in.yaml
+    kpt.dev/name-suffix-hash: "true"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app
+        envFrom:
+        - configMapRef:
+            name: config
+        - secretRef:
+            name: static
+        - configMapRef:
+            name: package
+        - configMapRef:
+            name: opted-in
+`))
+	require.NoError(t, err)
+	config, secret, pkg, optedIn, deployment := items[0], items[1], items[2], items[3], items[4]
+	hash, err := NameSuffixHash(config, "config")
+	require.NoError(t, err)
+	optedInHash, err := NameSuffixHash(optedIn, "opted-in")
+	require.NoError(t, err)
+
+	changes, err := AddNameSuffixHashes(items)
+	require.NoError(t, err)
+	assert.Len(t, changes, 4)
+	assert.Equal(t, "config-"+hash, config.GetName())
+	assert.Equal(t, hash, config.GetAnnotation(AppliedNameSuffixHashAnnotation))
+	assert.Equal(t, "static", secret.GetName())
+	assert.Equal(t, "package", pkg.GetName())
+	assert.Equal(t, "opted-in-"+optedInHash, optedIn.GetName())
+	assert.Equal(t, "true", optedIn.GetAnnotation(NameSuffixHashAnnotation))
+	refs, err := deployment.GetPath("spec.template.spec.containers[*].envFrom[*].*.name")
+	require.NoError(t, err)
+	require.Len(t, refs, 4)
+	assert.Equal(t, "config-"+hash, strings.TrimSpace(refs[0].String()))
+	assert.Equal(t, "static", strings.TrimSpace(refs[1].String()))
+	assert.Equal(t, "package", strings.TrimSpace(refs[2].String()))
+	assert.Equal(t, "opted-in-"+optedInHash, strings.TrimSpace(refs[3].String()))
+
+	// Idempotent, including once the generated objects are written to the package.
+	require.NoError(t, config.SetAnnotation(PathAnnotation, "config.yaml"))
+	changes, err = AddNameSuffixHashes(items)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, "config-"+hash, config.GetName())
+
+	// The suffix is replaced when the content changes.
+	require.NoError(t, config.SetNestedString("dev", "data", "mode"))
+	_, err = AddNameSuffixHashes(items)
+	require.NoError(t, err)
+	newHash := config.GetAnnotation(AppliedNameSuffixHashAnnotation)
+	assert.NotEqual(t, hash, newHash)
+	assert.Equal(t, "config-"+newHash, config.GetName())
+}
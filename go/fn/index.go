@@ -0,0 +1,317 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	v1 "github.com/GoogleContainerTools/kpt-functions-sdk/go/api/kptfile/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// indexKeys are the keys a KubeObject is indexed by.
+type indexKeys struct {
+	id        ResourceIdentifier
+	gk        schema.GroupKind
+	namespace string
+	labels    map[string]string
+}
+
+func keysOf(obj *KubeObject) indexKeys {
+	id := *obj.GetId()
+	return indexKeys{
+		id:        id,
+		gk:        schema.GroupKind{Group: id.Group, Kind: id.Kind},
+		namespace: id.Namespace,
+		labels:    obj.GetLabels(),
+	}
+}
+
+type label struct {
+	key, value string
+}
+
+// KubeObjectIndex is a collection of KubeObjects indexed by ResourceIdentifier,
+// GroupKind, namespace and label, for the functions which look up many
+// KubeObjects in large packages. The lookups return the KubeObjects in the
+// order they are added.
+//
+// The KubeObjects written with their setters, e.g. SetName, SetLabel or
+// SetNestedField, are re-indexed by the next lookup. A KubeObject whose YAML
+// nodes are modified directly must be re-indexed with Reindex. The index is
+// told of the writes by its KubeObjects, which keep it alive until it is
+// closed with Close.
+type KubeObjectIndex struct {
+	// items are the KubeObjects in order. The removed KubeObjects leave a nil
+	// hole until the next compaction.
+	items    KubeObjects
+	removed  int
+	position map[*KubeObject]int
+	keys     map[*KubeObject]indexKeys
+	// written are the KubeObjects written since the last lookup.
+	written map[*KubeObject]bool
+
+	byID        map[ResourceIdentifier]KubeObjects
+	byGroupKind map[schema.GroupKind]KubeObjects
+	byNamespace map[string]KubeObjects
+	byLabel     map[label]KubeObjects
+}
+
+// NewKubeObjectIndex returns a KubeObjectIndex of the items.
+func NewKubeObjectIndex(items KubeObjects) *KubeObjectIndex {
+	x := &KubeObjectIndex{
+		position:    map[*KubeObject]int{},
+		keys:        map[*KubeObject]indexKeys{},
+		written:     map[*KubeObject]bool{},
+		byID:        map[ResourceIdentifier]KubeObjects{},
+		byGroupKind: map[schema.GroupKind]KubeObjects{},
+		byNamespace: map[string]KubeObjects{},
+		byLabel:     map[label]KubeObjects{},
+	}
+	for _, obj := range items {
+		x.Add(obj)
+	}
+	return x
+}
+
+// Len returns the number of KubeObjects in the index.
+func (x *KubeObjectIndex) Len() int {
+	return len(x.items) - x.removed
+}
+
+// Items returns the KubeObjects in the order they are added.
+func (x *KubeObjectIndex) Items() KubeObjects {
+	x.compact()
+	items := make(KubeObjects, len(x.items))
+	copy(items, x.items)
+	return items
+}
+
+// Add adds the KubeObject to the index. Adding a KubeObject twice is a no-op.
+func (x *KubeObjectIndex) Add(obj *KubeObject) {
+	if _, found := x.position[obj]; found {
+		return
+	}
+	x.position[obj] = len(x.items)
+	x.items = append(x.items, obj)
+	x.index(obj)
+	x.watch(obj)
+}
+
+// Remove removes the KubeObject from the index, and returns whether it was found.
+func (x *KubeObjectIndex) Remove(obj *KubeObject) bool {
+	i, found := x.position[obj]
+	if !found {
+		return false
+	}
+	x.unindex(obj)
+	x.unwatch(obj)
+	delete(x.position, obj)
+	x.items[i] = nil
+	x.removed++
+	if x.removed > len(x.items)/2 {
+		x.compact()
+	}
+	return true
+}
+
+// replace replaces the KubeObject by another one at the same position.
+func (x *KubeObjectIndex) replace(old, obj *KubeObject) {
+	i, found := x.position[old]
+	if !found {
+		x.Add(obj)
+		return
+	}
+	if _, found := x.position[obj]; found {
+		return
+	}
+	x.unindex(old)
+	x.unwatch(old)
+	delete(x.position, old)
+	x.items[i] = obj
+	x.position[obj] = i
+	x.index(obj)
+	x.watch(obj)
+}
+
+// indexWatch is the owner of the functions an index registers to be told of the
+// writes to its KubeObjects.
+type indexWatch struct {
+	x   *KubeObjectIndex
+	obj *KubeObject
+}
+
+func (x *KubeObjectIndex) watch(obj *KubeObject) {
+	obj.obj.Watch(indexWatch{x: x, obj: obj}, func() { x.written[obj] = true })
+}
+
+func (x *KubeObjectIndex) unwatch(obj *KubeObject) {
+	obj.obj.Unwatch(indexWatch{x: x, obj: obj})
+	delete(x.written, obj)
+}
+
+// Close stops the index from tracking the writes to its KubeObjects, so that
+// they no longer keep it alive. The index must not be used once closed.
+func (x *KubeObjectIndex) Close() {
+	for obj := range x.position {
+		x.unwatch(obj)
+	}
+}
+
+// Reindex updates the keys of the KubeObject after its YAML nodes have been
+// modified directly.
+func (x *KubeObjectIndex) Reindex(obj *KubeObject) {
+	if _, found := x.position[obj]; !found {
+		return
+	}
+	if keys := keysOf(obj); !sameKeys(keys, x.keys[obj]) {
+		x.unindex(obj)
+		x.index(obj)
+	}
+}
+
+// Rename renames the KubeObject of the index and updates the references to it
+// in the other KubeObjects of the index, see Rename.
+func (x *KubeObjectIndex) Rename(obj *KubeObject, newName string) ([]ObjectFieldChange, error) {
+	changes, err := Rename(x.Items(), obj, newName)
+	x.Reindex(obj)
+	return changes, err
+}
+
+// Get returns the KubeObject with the ResourceIdentifier, ignoring its Version.
+// The Namespace follows the same convention as GetId, i.e. `default` for a
+// namespace scoped KubeObject without namespace. If several KubeObjects have
+// the same ResourceIdentifier, the first one is returned.
+func (x *KubeObjectIndex) Get(id ResourceIdentifier) (*KubeObject, bool) {
+	objs := x.byIdentifier(id)
+	if len(objs) == 0 {
+		return nil, false
+	}
+	return objs[0], true
+}
+
+// byIdentifier returns the KubeObjects with the ResourceIdentifier, ignoring its
+// Version.
+func (x *KubeObjectIndex) byIdentifier(id ResourceIdentifier) KubeObjects {
+	id.Version = ""
+	x.reindexWritten()
+	return append(KubeObjects(nil), x.byID[id]...)
+}
+
+// ByGroupKind returns the KubeObjects of the GroupKind.
+func (x *KubeObjectIndex) ByGroupKind(gk schema.GroupKind) KubeObjects {
+	x.reindexWritten()
+	return append(KubeObjects(nil), x.byGroupKind[gk]...)
+}
+
+// ByNamespace returns the KubeObjects in the namespace. The namespace follows
+// the same convention as GetId, i.e. `default` for the namespace scoped
+// KubeObjects without namespace, and UnknownNamespace for the cluster scoped
+// KubeObjects.
+func (x *KubeObjectIndex) ByNamespace(namespace string) KubeObjects {
+	x.reindexWritten()
+	return append(KubeObjects(nil), x.byNamespace[namespace]...)
+}
+
+// ByLabel returns the KubeObjects with the label `key: value`.
+func (x *KubeObjectIndex) ByLabel(key, value string) KubeObjects {
+	x.reindexWritten()
+	return append(KubeObjects(nil), x.byLabel[label{key: key, value: value}]...)
+}
+
+// GetRootKptfile returns the root Kptfile, see KubeObjects.GetRootKptfile.
+func (x *KubeObjectIndex) GetRootKptfile() *KubeObject {
+	kptfiles := x.ByGroupKind(schema.GroupKind{Group: v1.KptFileGroup, Kind: v1.KptFileKind})
+	return rootKptfile(kptfiles.Where(IsGVK(v1.KptFileGroup, v1.KptFileVersion, v1.KptFileKind)))
+}
+
+// reindexWritten re-indexes the KubeObjects written since the last lookup.
+func (x *KubeObjectIndex) reindexWritten() {
+	for obj := range x.written {
+		delete(x.written, obj)
+		x.Reindex(obj)
+	}
+}
+
+func (x *KubeObjectIndex) index(obj *KubeObject) {
+	keys := keysOf(obj)
+	x.keys[obj] = keys
+	x.byID[keys.id] = x.insert(x.byID[keys.id], obj)
+	x.byGroupKind[keys.gk] = x.insert(x.byGroupKind[keys.gk], obj)
+	x.byNamespace[keys.namespace] = x.insert(x.byNamespace[keys.namespace], obj)
+	for k, v := range keys.labels {
+		l := label{key: k, value: v}
+		x.byLabel[l] = x.insert(x.byLabel[l], obj)
+	}
+}
+
+func (x *KubeObjectIndex) unindex(obj *KubeObject) {
+	keys := x.keys[obj]
+	delete(x.keys, obj)
+	x.byID[keys.id] = without(x.byID[keys.id], obj)
+	x.byGroupKind[keys.gk] = without(x.byGroupKind[keys.gk], obj)
+	x.byNamespace[keys.namespace] = without(x.byNamespace[keys.namespace], obj)
+	for k, v := range keys.labels {
+		l := label{key: k, value: v}
+		x.byLabel[l] = without(x.byLabel[l], obj)
+	}
+}
+
+// insert inserts the KubeObject in the list, keeping the index order.
+func (x *KubeObjectIndex) insert(objs KubeObjects, obj *KubeObject) KubeObjects {
+	i := len(objs)
+	for i > 0 && x.position[objs[i-1]] > x.position[obj] {
+		i--
+	}
+	objs = append(objs, nil)
+	copy(objs[i+1:], objs[i:])
+	objs[i] = obj
+	return objs
+}
+
+func without(objs KubeObjects, obj *KubeObject) KubeObjects {
+	for i, o := range objs {
+		if o == obj {
+			return append(objs[:i:i], objs[i+1:]...)
+		}
+	}
+	return objs
+}
+
+// compact removes the holes left by the removed KubeObjects.
+func (x *KubeObjectIndex) compact() {
+	if x.removed == 0 {
+		return
+	}
+	items := make(KubeObjects, 0, len(x.items)-x.removed)
+	for _, obj := range x.items {
+		if obj != nil {
+			x.position[obj] = len(items)
+			items = append(items, obj)
+		}
+	}
+	x.items = items
+	x.removed = 0
+}
+
+func sameKeys(a, b indexKeys) bool {
+	if a.id != b.id || len(a.labels) != len(b.labels) {
+		return false
+	}
+	for k, v := range a.labels {
+		if w, found := b.labels[k]; !found || v != w {
+			return false
+		}
+	}
+	return true
+}
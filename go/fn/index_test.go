@@ -0,0 +1,131 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var indexResources = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  labels:
+    app: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+  labels:
+    app: web
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: prod
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: prod
+`
+
+func names(objs KubeObjects) []string {
+	var result []string
+	for _, obj := range objs {
+		result = append(result, fmt.Sprintf("%v/%v", obj.GetKind(), obj.GetName()))
+	}
+	return result
+}
+
+func TestKubeObjectIndex(t *testing.T) {
+	items, err := ParseKubeObjects([]byte(indexResources))
+	require.NoError(t, err)
+	x := NewKubeObjectIndex(items)
+	assert.Equal(t, 4, x.Len())
+
+	obj, found := x.Get(ResourceIdentifier{Kind: "ConfigMap", Namespace: "prod", Name: "config"})
+	assert.True(t, found)
+	assert.Equal(t, items[3], obj)
+	obj, found = x.Get(ResourceIdentifier{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "prod", Name: "web"})
+	assert.True(t, found)
+	assert.Equal(t, items[1], obj)
+	_, found = x.Get(ResourceIdentifier{Kind: "ConfigMap", Namespace: "default", Name: "other"})
+	assert.False(t, found)
+
+	assert.Equal(t, []string{"ConfigMap/config", "ConfigMap/config"}, names(x.ByGroupKind(schema.GroupKind{Kind: "ConfigMap"})))
+	assert.Equal(t, []string{"Deployment/web", "ConfigMap/config"}, names(x.ByNamespace("prod")))
+	assert.Equal(t, []string{"Namespace/prod"}, names(x.ByNamespace(UnknownNamespace)))
+	assert.Equal(t, []string{"ConfigMap/config", "Deployment/web"}, names(x.ByLabel("app", "web")))
+
+	// Remove.
+	assert.True(t, x.Remove(items[0]))
+	assert.False(t, x.Remove(items[0]))
+	assert.Equal(t, 3, x.Len())
+	assert.Equal(t, []string{"Deployment/web"}, names(x.ByLabel("app", "web")))
+	_, found = x.Get(ResourceIdentifier{Kind: "ConfigMap", Namespace: "default", Name: "config"})
+	assert.False(t, found)
+
+	// Add keeps the order of the lookups.
+	x.Add(items[0])
+	assert.Equal(t, []string{"Deployment/web", "Namespace/prod", "ConfigMap/config", "ConfigMap/config"}, names(x.Items()))
+	assert.Equal(t, []string{"Deployment/web", "ConfigMap/config"}, names(x.ByLabel("app", "web")))
+
+	// Rename.
+	_, err = x.Rename(items[3], "prod-config")
+	require.NoError(t, err)
+	_, found = x.Get(ResourceIdentifier{Kind: "ConfigMap", Namespace: "prod", Name: "config"})
+	assert.False(t, found)
+	obj, found = x.Get(ResourceIdentifier{Kind: "ConfigMap", Namespace: "prod", Name: "prod-config"})
+	assert.True(t, found)
+	assert.Equal(t, items[3], obj)
+
+	// The KubeObjects written with their setters are re-indexed by the lookups.
+	require.NoError(t, items[1].SetName("api"))
+	_, found = x.Get(ResourceIdentifier{Group: "apps", Kind: "Deployment", Namespace: "prod", Name: "api"})
+	assert.True(t, found)
+	require.NoError(t, items[1].SetLabel("app", "api"))
+	assert.Equal(t, []string{"ConfigMap/config"}, names(x.ByLabel("app", "web")))
+	assert.Equal(t, []string{"Deployment/api"}, names(x.ByLabel("app", "api")))
+
+	// The changes made to the YAML nodes directly need a Reindex.
+	require.NoError(t, items[1].obj.SetNestedString("backend", "metadata", "labels", "app"))
+	assert.Equal(t, []string{"Deployment/api"}, names(x.ByLabel("app", "api")))
+	x.Reindex(items[1])
+	assert.Empty(t, x.ByLabel("app", "api"))
+	assert.Equal(t, []string{"Deployment/api"}, names(x.ByLabel("app", "backend")))
+}
+
+func TestKubeObjectIndexClose(t *testing.T) {
+	items, err := ParseKubeObjects([]byte(indexResources))
+	require.NoError(t, err)
+	x := NewKubeObjectIndex(items)
+	require.NoError(t, items[0].SetName("renamed"))
+	assert.Len(t, x.written, 1)
+
+	// The closed index is no longer told of the writes.
+	x.Close()
+	assert.Empty(t, x.written)
+	require.NoError(t, items[1].SetName("renamed"))
+	assert.Empty(t, x.written)
+}
@@ -0,0 +1,387 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ErrAliasedField is returned by the writes to a field shared through a YAML
+// alias or merge key when the aliases are not copied on write.
+var ErrAliasedField = errors.New("the writes to the YAML aliases are disabled")
+
+// Aliases are the YAML documents parsed together, whose aliases can refer to
+// the anchors of each other. A write at an anchor first replaces the aliases
+// referring to it in the documents by copies, so that they keep their value. A
+// nil *Aliases knows no document and copies the shared values on write.
+type Aliases struct {
+	docs []*yaml.Node
+	// failOnWrite makes the writes to the shared values fail with an error
+	// wrapping ErrAliasedField instead of copying them.
+	failOnWrite bool
+}
+
+// NewAliases returns the Aliases of the YAML documents.
+func NewAliases(failOnWrite bool, docs ...*yaml.Node) *Aliases {
+	return &Aliases{docs: docs, failOnWrite: failOnWrite}
+}
+
+// WithFailOnWrite returns the Aliases of the same documents, whose writes to
+// the shared values fail if failOnWrite is set.
+func (a *Aliases) WithFailOnWrite(failOnWrite bool) *Aliases {
+	if a == nil {
+		return &Aliases{failOnWrite: failOnWrite}
+	}
+	return &Aliases{docs: a.docs, failOnWrite: failOnWrite}
+}
+
+// FailOnWrite tells whether the writes to the shared values fail.
+func (a *Aliases) FailOnWrite() bool {
+	return a != nil && a.failOnWrite
+}
+
+// find returns the aliases of the anchored node in the documents.
+func (a *Aliases) find(anchor *yaml.Node) []*yaml.Node {
+	if a == nil {
+		return nil
+	}
+	var found []*yaml.Node
+	var visit func(n *yaml.Node)
+	visit = func(n *yaml.Node) {
+		if n.Kind == yaml.AliasNode && n.Alias == anchor {
+			found = append(found, n)
+		}
+		for _, child := range n.Content {
+			visit(child)
+		}
+	}
+	for _, doc := range a.docs {
+		visit(doc)
+	}
+	return found
+}
+
+// detachAliases replaces the aliases of the anchored node by copies of the
+// node, so that it can be written without changing them, or returns an error
+// wrapping ErrAliasedField if the writes fail.
+func (a *Aliases) detachAliases(n *yaml.Node, key string) error {
+	if n == nil || n.Anchor == "" {
+		return nil
+	}
+	refs := a.find(n)
+	if len(refs) == 0 {
+		return nil
+	}
+	if a.FailOnWrite() {
+		return aliasWriteError(key, n)
+	}
+	for _, alias := range refs {
+		c := copyWithoutAnchors(n)
+		copyNodeComments(alias, c)
+		c.Line, c.Column = alias.Line, alias.Column
+		*alias = *c
+	}
+	n.Anchor = ""
+	return nil
+}
+
+// DetachAliases replaces the aliases of the anchored nodes of the tree by
+// copies, before the tree is replaced or removed. It fails like
+// WritableMappingValue.
+func (a *Aliases) DetachAliases(n *yaml.Node, key string) error {
+	if n == nil || n.Kind == yaml.AliasNode {
+		return nil
+	}
+	if err := a.detachAliases(n, key); err != nil {
+		return err
+	}
+	for _, child := range n.Content {
+		if err := a.DetachAliases(child, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveAlias returns the node an alias refers to, or the node itself.
+func ResolveAlias(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+func isMergeKey(k *yaml.Node) bool {
+	return k.Kind == yaml.ScalarNode && k.Value == "<<" && (k.Tag == yaml.MergeTag || k.Tag == "")
+}
+
+// UntagMergeKeys drops the tag of the merge keys, which the YAML encoder of
+// kyaml writes as `!!merge <<` otherwise.
+func UntagMergeKeys(nodes ...*yaml.Node) {
+	for _, n := range nodes {
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if isMergeKey(n.Content[i]) && n.Content[i].Style&yaml.TaggedStyle == 0 {
+					n.Content[i].Tag = ""
+				}
+			}
+		}
+		UntagMergeKeys(n.Content...)
+	}
+}
+
+// mergeSources returns the maps merged into the mapping node by its `<<` keys,
+// by order of precedence.
+func mergeSources(m *yaml.Node) []*yaml.Node {
+	var sources []*yaml.Node
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if !isMergeKey(m.Content[i]) {
+			continue
+		}
+		switch v := ResolveAlias(m.Content[i+1]); v.Kind {
+		case yaml.MappingNode:
+			sources = append(sources, v)
+		case yaml.SequenceNode:
+			for _, elem := range v.Content {
+				if elem = ResolveAlias(elem); elem.Kind == yaml.MappingNode {
+					sources = append(sources, elem)
+				}
+			}
+		}
+	}
+	return sources
+}
+
+// lookupField returns the value of key in the mapping node, following the
+// merge keys, and the merged map it comes from, nil if it is an own field.
+func lookupField(m *yaml.Node, key string) (value, source *yaml.Node, found bool) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if k, ok := asString(m.Content[i]); ok && k == key && !isMergeKey(m.Content[i]) {
+			return m.Content[i+1], nil, true
+		}
+	}
+	for _, s := range mergeSources(m) {
+		if v, _, found := lookupField(s, key); found {
+			return v, s, true
+		}
+	}
+	return nil, nil, false
+}
+
+// MappingValue returns the value of key in the mapping node, following the
+// aliases and the merge keys.
+func MappingValue(m *yaml.Node, key string) (*yaml.Node, bool) {
+	m = ResolveAlias(m)
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil, false
+	}
+	v, _, found := lookupField(m, key)
+	return ResolveAlias(v), found
+}
+
+// MappingFields returns the keys and the values of the mapping node, including
+// the merged ones, in order. The values follow the aliases.
+func MappingFields(m *yaml.Node) (keys, values []*yaml.Node) {
+	m = ResolveAlias(m)
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	var collect func(m *yaml.Node)
+	collect = func(m *yaml.Node) {
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if isMergeKey(m.Content[i]) || seen[m.Content[i].Value] {
+				continue
+			}
+			seen[m.Content[i].Value] = true
+			keys = append(keys, m.Content[i])
+			values = append(values, ResolveAlias(m.Content[i+1]))
+		}
+		for _, s := range mergeSources(m) {
+			collect(s)
+		}
+	}
+	collect(m)
+	return keys, values
+}
+
+// IsMergedField tells whether the field of the mapping node comes from a merge
+// key.
+func IsMergedField(m *yaml.Node, key string) bool {
+	_, source, found := lookupField(m, key)
+	return found && source != nil
+}
+
+func aliasWriteError(key string, shared *yaml.Node) error {
+	return fmt.Errorf("unable to write the field %q shared with the anchor &%v at line %d: %w", key, shared.Anchor, shared.Line, ErrAliasedField)
+}
+
+// WritableMappingValue returns the value of key in the mapping node for a
+// write. A value shared through an alias or a merge key is replaced by a copy
+// owned by the mapping node, or an error wrapping ErrAliasedField is returned
+// if the writes fail.
+func (a *Aliases) WritableMappingValue(m *yaml.Node, key string) (*yaml.Node, bool, error) {
+	v, source, found := lookupField(m, key)
+	if !found {
+		return nil, false, nil
+	}
+	shared := source
+	if v.Kind == yaml.AliasNode {
+		shared = ResolveAlias(v)
+	}
+	if shared == nil {
+		// The own value can be the anchor of aliases which must not change.
+		if err := a.detachAliases(v, key); err != nil {
+			return nil, true, err
+		}
+		return v, true, nil
+	}
+	if a.FailOnWrite() && shared.Anchor != "" {
+		return nil, true, aliasWriteError(key, shared)
+	}
+	owned := copyWithoutAnchors(ResolveAlias(v))
+	if source == nil {
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if m.Content[i+1] == v {
+				copyNodeComments(v, owned)
+				m.Content[i+1] = owned
+			}
+		}
+	} else {
+		m.Content = append(m.Content, buildStringNode(key), owned)
+	}
+	return owned, true, nil
+}
+
+// WritableElement returns the element of the sequence node for a write, see
+// WritableMappingValue.
+func (a *Aliases) WritableElement(s *yaml.Node, i int) (*yaml.Node, error) {
+	elem := s.Content[i]
+	if elem.Kind != yaml.AliasNode {
+		if err := a.detachAliases(elem, fmt.Sprintf("[%d]", i)); err != nil {
+			return nil, err
+		}
+		return elem, nil
+	}
+	if a.FailOnWrite() {
+		return nil, aliasWriteError(fmt.Sprintf("[%d]", i), ResolveAlias(elem))
+	}
+	owned := copyWithoutAnchors(ResolveAlias(elem))
+	copyNodeComments(elem, owned)
+	s.Content[i] = owned
+	return owned, nil
+}
+
+// InlineMerges replaces the merge keys of the mapping node by the fields they
+// merge, so that the merged fields can be removed. It fails like
+// WritableMappingValue. It is a no-op without merge keys.
+func (a *Aliases) InlineMerges(m *yaml.Node) error {
+	sources := mergeSources(m)
+	if len(sources) == 0 {
+		return nil
+	}
+	if a.FailOnWrite() {
+		return aliasWriteError("<<", sources[0])
+	}
+	keys, values := MappingFields(m)
+	var content []*yaml.Node
+	for i, k := range keys {
+		if v, source, _ := lookupField(m, k.Value); source == nil {
+			content = append(content, k, v)
+		} else {
+			content = append(content, copyWithoutAnchors(k), copyWithoutAnchors(values[i]))
+		}
+	}
+	m.Content = content
+	return nil
+}
+
+// copyWithoutAnchors copies the node, without its anchors which would be
+// defined twice otherwise.
+func copyWithoutAnchors(n *yaml.Node) *yaml.Node {
+	c := yaml.CopyYNode(n)
+	clearAnchors(c)
+	return c
+}
+
+func clearAnchors(n *yaml.Node) {
+	n.Anchor = ""
+	for _, child := range n.Content {
+		clearAnchors(child)
+	}
+}
+
+func copyNodeComments(from, to *yaml.Node) {
+	to.HeadComment = from.HeadComment
+	to.LineComment = from.LineComment
+	to.FootComment = from.FootComment
+}
+
+// copyNode copies the node like yaml.CopyYNode, with the aliases referring to
+// the copied anchors. The aliases referring to anchors outside of the node are
+// replaced by copies of the anchored values, so that the copy shares nothing
+// with the original.
+func copyNode(n *yaml.Node) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+	copies := map[*yaml.Node]*yaml.Node{}
+	var aliasCopies []*yaml.Node
+	var copyTree func(n *yaml.Node) *yaml.Node
+	copyTree = func(n *yaml.Node) *yaml.Node {
+		c := *n
+		copies[n] = &c
+		if n.Kind == yaml.AliasNode {
+			aliasCopies = append(aliasCopies, &c)
+		}
+		if len(n.Content) > 0 {
+			c.Content = make([]*yaml.Node, len(n.Content))
+			for i, child := range n.Content {
+				c.Content[i] = copyTree(child)
+			}
+		}
+		return &c
+	}
+	c := copyTree(n)
+	for _, alias := range aliasCopies {
+		if anchor, found := copies[alias.Alias]; found {
+			alias.Alias = anchor
+			continue
+		}
+		expanded := copyExpanded(alias)
+		copyNodeComments(alias, expanded)
+		expanded.Line, expanded.Column = alias.Line, alias.Column
+		*alias = *expanded
+	}
+	return c
+}
+
+// copyExpanded copies the node with the aliases replaced by copies of the
+// anchored values, and without anchors.
+func copyExpanded(n *yaml.Node) *yaml.Node {
+	c := *ResolveAlias(n)
+	c.Anchor = ""
+	if len(c.Content) > 0 {
+		content := make([]*yaml.Node, len(c.Content))
+		for i, child := range c.Content {
+			content[i] = copyExpanded(child)
+		}
+		c.Content = content
+	}
+	return &c
+}
@@ -29,7 +29,15 @@ func NewDoc(nodes ...*yaml.Node) *doc {
 	return &doc{nodes: nodes}
 }
 
+// ParseDoc parses the YAML documents, or the JSON values if the input is JSON.
 func ParseDoc(b []byte) (*doc, error) {
+	if IsJSON(b) {
+		nodes, err := parseJSON(b)
+		if err != nil {
+			return nil, err
+		}
+		return &doc{nodes: nodes}, nil
+	}
 	br := bytes.NewReader(b)
 
 	var nodes []*yaml.Node
@@ -49,8 +57,15 @@ func ParseDoc(b []byte) (*doc, error) {
 }
 
 func (d *doc) ToYAML() ([]byte, error) {
+	return d.ToYAMLWithOptions(&yaml.EncoderOptions{SeqIndent: yaml.CompactSequenceStyle})
+}
+
+// ToYAMLWithOptions encodes the documents with the sequence indentation of the
+// EncoderOptions.
+func (d *doc) ToYAMLWithOptions(opts *yaml.EncoderOptions) ([]byte, error) {
 	var w bytes.Buffer
-	encoder := yaml.NewEncoder(&w)
+	encoder := yaml.NewEncoderWithOptions(&w, opts)
+	UntagMergeKeys(d.nodes...)
 	for _, node := range d.nodes {
 		if node.Kind == yaml.DocumentNode {
 			if len(node.Content) == 0 {
@@ -66,6 +81,24 @@ func (d *doc) ToYAML() ([]byte, error) {
 	return w.Bytes(), nil
 }
 
+// ToJSON encodes the documents as JSON, one value per document.
+func (d *doc) ToJSON() ([]byte, error) {
+	var w bytes.Buffer
+	for _, node := range d.nodes {
+		b, err := ToJSON(node)
+		if err != nil {
+			return nil, err
+		}
+		w.Write(b)
+	}
+	return w.Bytes(), nil
+}
+
 func (d *doc) Elements() ([]*MapVariant, error) {
 	return ExtractObjects(d.nodes...)
 }
+
+// Nodes returns the YAML documents.
+func (d *doc) Nodes() []*yaml.Node {
+	return d.nodes
+}
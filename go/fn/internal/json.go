@@ -0,0 +1,232 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// IsJSON tells whether the input is a stream of JSON objects or arrays, rather
+// than YAML.
+func IsJSON(b []byte) bool {
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+	d := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		var v json.RawMessage
+		if err := d.Decode(&v); err == io.EOF {
+			return true
+		} else if err != nil {
+			return false
+		}
+	}
+}
+
+// parseJSON parses the JSON values of the input into YAML documents. Unlike the
+// YAML decoder, it accepts any JSON, e.g. indented with tabs, and keeps the
+// numbers as written.
+func parseJSON(b []byte) ([]*yaml.Node, error) {
+	p := &jsonParser{decoder: json.NewDecoder(bytes.NewReader(b))}
+	p.decoder.UseNumber()
+	for i, c := range b {
+		if c == '\n' {
+			p.lineEnds = append(p.lineEnds, i)
+		}
+	}
+	var nodes []*yaml.Node
+	for {
+		node, err := p.value()
+		if err == io.EOF {
+			return nodes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{node}, Line: node.Line, Column: 1})
+	}
+}
+
+type jsonParser struct {
+	decoder *json.Decoder
+	// lineEnds are the offsets of the line breaks of the input.
+	lineEnds []int
+}
+
+// line returns the line of the last token.
+func (p *jsonParser) line() int {
+	return sort.SearchInts(p.lineEnds, int(p.decoder.InputOffset())-1) + 1
+}
+
+func (p *jsonParser) value() (*yaml.Node, error) {
+	token, err := p.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	line := p.line()
+	switch t := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: yaml.NodeTagMap, Line: line}
+		if t == '[' {
+			node.Kind, node.Tag = yaml.SequenceNode, yaml.NodeTagSeq
+		}
+		for p.decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := p.decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagString, Value: key.(string), Line: p.line()})
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		// The closing delimiter.
+		if _, err := p.decoder.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagString, Value: t, Line: line}, nil
+	case json.Number:
+		tag := yaml.NodeTagInt
+		if strings.ContainsAny(t.String(), ".eE") {
+			tag = yaml.NodeTagFloat
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: t.String(), Line: line}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagBool, Value: strconv.FormatBool(t), Line: line}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagNull, Value: "null", Line: line}, nil
+	default:
+		return nil, fmt.Errorf("unexpected JSON token %v at line %d", t, line)
+	}
+}
+
+// ToJSON encodes the node as indented JSON. The numbers are kept as written
+// when they are valid JSON numbers, and the aliases and merge keys are
+// expanded.
+func ToJSON(node *yaml.Node) ([]byte, error) {
+	var compact bytes.Buffer
+	if err := writeJSON(&compact, node); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteString("\n")
+	return out.Bytes(), nil
+}
+
+func writeJSON(w *bytes.Buffer, node *yaml.Node) error {
+	node = ResolveAlias(node)
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			w.WriteString("null")
+			return nil
+		}
+		return writeJSON(w, node.Content[0])
+	case yaml.MappingNode:
+		keys, values := MappingFields(node)
+		w.WriteString("{")
+		for i := range keys {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			if err := writeJSONString(w, keys[i].Value); err != nil {
+				return err
+			}
+			w.WriteString(":")
+			if err := writeJSON(w, values[i]); err != nil {
+				return err
+			}
+		}
+		w.WriteString("}")
+	case yaml.SequenceNode:
+		w.WriteString("[")
+		for i, elem := range node.Content {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			if err := writeJSON(w, elem); err != nil {
+				return err
+			}
+		}
+		w.WriteString("]")
+	case yaml.ScalarNode:
+		return writeJSONScalar(w, node)
+	default:
+		return fmt.Errorf("unhandled node kind %v", node.Kind)
+	}
+	return nil
+}
+
+func writeJSONScalar(w *bytes.Buffer, node *yaml.Node) error {
+	switch node.ShortTag() {
+	case yaml.NodeTagNull:
+		w.WriteString("null")
+		return nil
+	case yaml.NodeTagBool, yaml.NodeTagInt, yaml.NodeTagFloat:
+		if isJSONNumber(node.Value) {
+			w.WriteString(node.Value)
+			return nil
+		}
+		// e.g. 0x1F, 1_000 or True, which JSON spells differently.
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			return err
+		}
+		if b, err := json.Marshal(v); err == nil {
+			w.Write(b)
+			return nil
+		}
+		// .inf and .nan have no JSON equivalent.
+	}
+	return writeJSONString(w, node.Value)
+}
+
+func isJSONNumber(s string) bool {
+	if s == "" || (s[0] != '-' && (s[0] < '0' || s[0] > '9')) {
+		return false
+	}
+	var n json.Number
+	return json.Unmarshal([]byte(s), &n) == nil
+}
+
+// writeJSONString writes the string without escaping the HTML characters.
+func writeJSONString(w *bytes.Buffer, s string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return err
+	}
+	// Encode adds a line break.
+	w.Truncate(w.Len() - 1)
+	return nil
+}
@@ -44,6 +44,69 @@ func NewStringMapVariant(m map[string]string) *MapVariant {
 
 type MapVariant struct {
 	node *yaml.Node
+	// aliases are the aliases of the documents the node was parsed with.
+	aliases *Aliases
+	// owner is the object holding the MapVariant, see SetOwner.
+	owner interface{}
+	// watchers are called by Touch, keyed by their owner.
+	watchers map[interface{}]func()
+}
+
+// Watch registers the function to be called when the MapVariant is written, e.g.
+// to invalidate an index of the KubeObjects. A new function of the same owner
+// replaces the previous one.
+func (o *MapVariant) Watch(owner interface{}, f func()) {
+	if o.watchers == nil {
+		o.watchers = map[interface{}]func(){}
+	}
+	o.watchers[owner] = f
+}
+
+// Unwatch removes the function registered by the owner.
+func (o *MapVariant) Unwatch(owner interface{}) {
+	delete(o.watchers, owner)
+}
+
+// Touch tells the watchers that the MapVariant has been written.
+func (o *MapVariant) Touch() {
+	for _, f := range o.watchers {
+		f()
+	}
+}
+
+// Aliases returns the aliases of the documents the MapVariant was parsed with,
+// see SetAliases.
+func (o *MapVariant) Aliases() *Aliases {
+	return o.aliases
+}
+
+// SetAliases sets the aliases of the documents the MapVariant was parsed with,
+// which are copied on write. The MapVariants of its fields inherit them.
+func (o *MapVariant) SetAliases(aliases *Aliases) {
+	o.aliases = aliases
+}
+
+// Owner returns the object holding the MapVariant, see SetOwner.
+func (o *MapVariant) Owner() interface{} {
+	return o.owner
+}
+
+// SetOwner sets the object holding the MapVariant, e.g. the fn.KubeObject of
+// the root map, so that it can be found from the MapVariant.
+func (o *MapVariant) SetOwner(owner interface{}) {
+	o.owner = owner
+}
+
+// child returns the MapVariant of a field of the MapVariant.
+func (o *MapVariant) child(node *yaml.Node) *MapVariant {
+	return &MapVariant{node: node, aliases: o.aliases}
+}
+
+// DeepCopy returns a copy of the MapVariant whose yaml.Node tree, including the
+// comments, is not shared with the original.
+func (o *MapVariant) DeepCopy() *MapVariant {
+	node := copyNode(o.node)
+	return &MapVariant{node: node, aliases: NewAliases(o.aliases.FailOnWrite(), node)}
 }
 
 func (o *MapVariant) GetKind() variantKind {
@@ -54,6 +117,8 @@ func (o *MapVariant) Node() *yaml.Node {
 	return o.node
 }
 
+// Entries returns the fields of the map, including the fields merged by the
+// `<<` merge keys.
 func (o *MapVariant) Entries() (map[string]variant, error) {
 	entries := make(map[string]variant)
 
@@ -63,12 +128,10 @@ func (o *MapVariant) Entries() (map[string]variant, error) {
 		return nil, fmt.Errorf("unexpected number of children for map %d", len(children))
 	}
 
-	for i := 0; i < len(children); i += 2 {
-		keyNode := children[i]
-		valueNode := children[i+1]
-
-		keyVariant := toVariant(keyNode)
-		valueVariant := toVariant(valueNode)
+	keys, values := MappingFields(ynode)
+	for i := range keys {
+		keyVariant := toVariant(keys[i])
+		valueVariant := toVariant(values[i])
 
 		switch keyVariant := keyVariant.(type) {
 		case *scalarVariant:
@@ -98,33 +161,33 @@ func (o *MapVariant) getVariant(key string) (variant, bool) {
 		return nil, found
 	}
 
-	v := toVariant(valueNode)
-	return v, true
+	switch v := toVariant(valueNode).(type) {
+	case *MapVariant:
+		v.aliases = o.aliases
+		return v, true
+	case *sliceVariant:
+		v.aliases = o.aliases
+		return v, true
+	default:
+		return v, true
+	}
 }
 
+// getValueNode returns the value of key, following the aliases and the merge
+// keys.
 func getValueNode(m *yaml.Node, key string) (*yaml.Node, bool) {
 	children := m.Content
 	if len(children)%2 != 0 {
 		log.Fatalf("unexpected number of children for map %d", len(children))
 	}
-
-	for i := 0; i < len(children); i += 2 {
-		keyNode := children[i]
-
-		k, ok := asString(keyNode)
-		if ok && k == key {
-			valueNode := children[i+1]
-			return valueNode, true
-		}
-	}
-	return nil, false
+	return MappingValue(m, key)
 }
 
-func (o *MapVariant) set(key string, val variant) {
-	o.setYAMLNode(key, val.Node())
+func (o *MapVariant) set(key string, val variant) error {
+	return o.setYAMLNode(key, val.Node())
 }
 
-func (o *MapVariant) setYAMLNode(key string, node *yaml.Node) {
+func (o *MapVariant) setYAMLNode(key string, node *yaml.Node) error {
 	children := o.node.Content
 	if len(children)%2 != 0 {
 		log.Fatalf("unexpected number of children for map %d", len(children))
@@ -137,24 +200,35 @@ func (o *MapVariant) setYAMLNode(key string, node *yaml.Node) {
 		if ok && k == key {
 			// TODO: Copy comments?
 			oldNode := children[i+1]
+			// The replaced node can be the anchor of aliases which must not change.
+			if err := o.aliases.DetachAliases(oldNode, key); err != nil {
+				return err
+			}
 			children[i+1] = node
 			children[i+1].FootComment = oldNode.FootComment
 			children[i+1].HeadComment = oldNode.HeadComment
 			children[i+1].LineComment = oldNode.LineComment
-			return
+			return nil
 		}
 	}
 
 	o.node.Content = append(o.node.Content, buildStringNode(key), node)
+	return nil
 }
 
 func (o *MapVariant) remove(key string) (bool, error) {
 	removed := false
 
-	children := o.node.Content
-	if len(children)%2 != 0 {
-		return false, fmt.Errorf("unexpected number of children for map %d", len(children))
+	if len(o.node.Content)%2 != 0 {
+		return false, fmt.Errorf("unexpected number of children for map %d", len(o.node.Content))
 	}
+	// A merged field can only be removed once the merge keys are inlined.
+	if IsMergedField(o.node, key) {
+		if err := o.aliases.InlineMerges(o.node); err != nil {
+			return false, err
+		}
+	}
+	children := o.node.Content
 
 	var keep []*yaml.Node
 	for i := 0; i < len(children); i += 2 {
@@ -162,6 +236,9 @@ func (o *MapVariant) remove(key string) (bool, error) {
 
 		k, ok := asString(keyNode)
 		if ok && k == key {
+			if err := o.aliases.DetachAliases(children[i+1], key); err != nil {
+				return removed, err
+			}
 			removed = true
 			continue
 		}
@@ -274,10 +351,12 @@ func (nodes yamlKeyValuePairs) Swap(i, j int) { nodes[i], nodes[j] = nodes[j], n
 // UpsertMap will return the field as a map if it exists and is a map,
 // otherwise it will insert a map at the specified field.
 // Note that if the value exists but is not a map, it will be replaced with a map.
+//
+// A map shared through a YAML alias or merge key is always copied on write,
+// since UpsertMap can't return an error.
 func (o *MapVariant) UpsertMap(field string) *MapVariant {
-	m := o.GetMap(field)
-	if m != nil {
-		return m
+	if node, found, _ := o.aliases.WithFailOnWrite(false).WritableMappingValue(o.node, field); found && node.Kind == yaml.MappingNode {
+		return o.child(node)
 	}
 
 	keyNode := &yaml.Node{
@@ -289,7 +368,7 @@ func (o *MapVariant) UpsertMap(field string) *MapVariant {
 		Kind: yaml.MappingNode,
 	}
 	o.node.Content = append(o.node.Content, keyNode, valueNode)
-	return &MapVariant{node: valueNode}
+	return o.child(valueNode)
 }
 
 // GetMap will return the field as a map if it exists and is a map,
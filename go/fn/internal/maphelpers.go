@@ -57,7 +57,9 @@ func (o *MapVariant) SetNestedValue(val variant, fields ...string) error {
 	var err error
 	for i := 0; i < n; i++ {
 		if i == n-1 {
-			current.set(fields[i], val)
+			if err := current.set(fields[i], val); err != nil {
+				return err
+			}
 		} else {
 			current, _, err = current.getMap(fields[i], true)
 			if err != nil {
@@ -93,9 +95,10 @@ func (o *MapVariant) GetNestedStringMap(fields ...string) (map[string]string, bo
 	if len(children)%2 != 0 {
 		return nil, found, fmt.Errorf("invalid yaml map node")
 	}
-	m := make(map[string]string, len(children)/2)
-	for i := 0; i < len(children); i = i + 2 {
-		m[children[i].Value] = children[i+1].Value
+	keys, values := MappingFields(v.Node())
+	m := make(map[string]string, len(keys))
+	for i := range keys {
+		m[keys[i].Value] = values[i].Value
 	}
 	return m, found, nil
 }
@@ -200,26 +203,29 @@ func (o *MapVariant) RemoveNestedField(fields ...string) (bool, error) {
 	current := o
 	n := len(fields)
 	for i := 0; i < n; i++ {
-		entry, found := current.getVariant(fields[i])
-		if !found {
-			return false, nil
-		}
-
 		if i == n-1 {
+			if _, found := current.getVariant(fields[i]); !found {
+				return false, nil
+			}
 			return current.remove(fields[i])
 		}
-		switch entry := entry.(type) {
-		case *MapVariant:
-			current = entry
-		default:
-			return false, fmt.Errorf("value is of unexpected type %T", entry)
+		node, found, err := current.aliases.WritableMappingValue(current.node, fields[i])
+		if err != nil || !found {
+			return false, err
+		}
+		if node.Kind != yaml.MappingNode {
+			return false, fmt.Errorf("value is of unexpected type %T", toVariant(node))
 		}
+		current = current.child(node)
 	}
 	return false, fmt.Errorf("unexpected code reached")
 }
 
 func (o *MapVariant) getMap(field string, create bool) (*MapVariant, bool, error) {
-	node, found := o.getVariant(field)
+	valueNode, found, err := o.aliases.WritableMappingValue(o.node, field)
+	if err != nil {
+		return nil, found, err
+	}
 
 	if !found {
 		if !create {
@@ -228,12 +234,11 @@ func (o *MapVariant) getMap(field string, create bool) (*MapVariant, bool, error
 		keyNode := buildStringNode(field)
 		valueNode := buildMappingNode()
 		o.node.Content = append(o.node.Content, keyNode, valueNode)
-		valueVariant := &MapVariant{node: valueNode}
-		return valueVariant, found, nil
+		return o.child(valueNode), found, nil
 	}
 
-	if node, ok := node.(*MapVariant); ok {
-		return node, found, nil
+	if valueNode.Kind == yaml.MappingNode {
+		return o.child(valueNode), found, nil
 	}
-	return nil, found, fmt.Errorf("incorrect type, was %T", node)
+	return nil, found, fmt.Errorf("incorrect type, was %T", toVariant(valueNode))
 }
@@ -18,9 +18,12 @@ import (
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
-// PrecomputedIsNamespaceScoped copies the sigs.k8s.io/kustomize/kyaml/openapi precomputedIsNamespaceScoped
+// PrecomputedIsNamespaceScoped copies the sigs.k8s.io/kustomize/kyaml/openapi precomputedIsNamespaceScoped, plus the
+// built-in kinds added in newer Kubernetes versions.
 var PrecomputedIsNamespaceScoped = map[yaml.TypeMeta]bool{
 	{APIVersion: "admissionregistration.k8s.io/v1", Kind: "MutatingWebhookConfiguration"}:        false,
+	{APIVersion: "admissionregistration.k8s.io/v1", Kind: "ValidatingAdmissionPolicy"}:           false,
+	{APIVersion: "admissionregistration.k8s.io/v1", Kind: "ValidatingAdmissionPolicyBinding"}:    false,
 	{APIVersion: "admissionregistration.k8s.io/v1", Kind: "ValidatingWebhookConfiguration"}:      false,
 	{APIVersion: "admissionregistration.k8s.io/v1beta1", Kind: "MutatingWebhookConfiguration"}:   false,
 	{APIVersion: "admissionregistration.k8s.io/v1beta1", Kind: "ValidatingWebhookConfiguration"}: false,
@@ -35,6 +38,7 @@ var PrecomputedIsNamespaceScoped = map[yaml.TypeMeta]bool{
 	{APIVersion: "apps/v1", Kind: "StatefulSet"}:                                                 true,
 	{APIVersion: "autoscaling/v1", Kind: "HorizontalPodAutoscaler"}:                              true,
 	{APIVersion: "autoscaling/v1", Kind: "Scale"}:                                                true,
+	{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler"}:                              true,
 	{APIVersion: "autoscaling/v2beta1", Kind: "HorizontalPodAutoscaler"}:                         true,
 	{APIVersion: "autoscaling/v2beta2", Kind: "HorizontalPodAutoscaler"}:                         true,
 	{APIVersion: "batch/v1", Kind: "CronJob"}:                                                    true,
@@ -49,8 +53,14 @@ var PrecomputedIsNamespaceScoped = map[yaml.TypeMeta]bool{
 	{APIVersion: "events.k8s.io/v1", Kind: "Event"}:                                              true,
 	{APIVersion: "events.k8s.io/v1beta1", Kind: "Event"}:                                         true,
 	{APIVersion: "extensions/v1beta1", Kind: "Ingress"}:                                          true,
+	{APIVersion: "flowcontrol.apiserver.k8s.io/v1", Kind: "FlowSchema"}:                          false,
+	{APIVersion: "flowcontrol.apiserver.k8s.io/v1", Kind: "PriorityLevelConfiguration"}:          false,
 	{APIVersion: "flowcontrol.apiserver.k8s.io/v1beta1", Kind: "FlowSchema"}:                     false,
 	{APIVersion: "flowcontrol.apiserver.k8s.io/v1beta1", Kind: "PriorityLevelConfiguration"}:     false,
+	{APIVersion: "flowcontrol.apiserver.k8s.io/v1beta2", Kind: "FlowSchema"}:                     false,
+	{APIVersion: "flowcontrol.apiserver.k8s.io/v1beta2", Kind: "PriorityLevelConfiguration"}:     false,
+	{APIVersion: "flowcontrol.apiserver.k8s.io/v1beta3", Kind: "FlowSchema"}:                     false,
+	{APIVersion: "flowcontrol.apiserver.k8s.io/v1beta3", Kind: "PriorityLevelConfiguration"}:     false,
 	{APIVersion: "networking.k8s.io/v1", Kind: "Ingress"}:                                        true,
 	{APIVersion: "networking.k8s.io/v1", Kind: "IngressClass"}:                                   false,
 	{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"}:                                  true,
@@ -73,6 +83,7 @@ var PrecomputedIsNamespaceScoped = map[yaml.TypeMeta]bool{
 	{APIVersion: "scheduling.k8s.io/v1beta1", Kind: "PriorityClass"}:                             false,
 	{APIVersion: "storage.k8s.io/v1", Kind: "CSIDriver"}:                                         false,
 	{APIVersion: "storage.k8s.io/v1", Kind: "CSINode"}:                                           false,
+	{APIVersion: "storage.k8s.io/v1", Kind: "CSIStorageCapacity"}:                                true,
 	{APIVersion: "storage.k8s.io/v1", Kind: "StorageClass"}:                                      false,
 	{APIVersion: "storage.k8s.io/v1", Kind: "VolumeAttachment"}:                                  false,
 	{APIVersion: "storage.k8s.io/v1beta1", Kind: "CSIDriver"}:                                    false,
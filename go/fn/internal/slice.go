@@ -20,6 +20,8 @@ import (
 
 type sliceVariant struct {
 	node *yaml.Node
+	// aliases are inherited by the elements, see MapVariant.SetAliases.
+	aliases *Aliases
 }
 
 func NewSliceVariant(s ...variant) *sliceVariant {
@@ -43,7 +45,11 @@ func (v *sliceVariant) Clear() {
 }
 
 func (v *sliceVariant) Elements() ([]*MapVariant, error) {
-	return ExtractObjects(v.node.Content...)
+	elements, err := ExtractObjects(v.node.Content...)
+	for _, e := range elements {
+		e.aliases = v.aliases
+	}
+	return elements, err
 }
 
 func (v *sliceVariant) Add(node variant) {
@@ -0,0 +1,91 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var deploymentYAML = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels:
+    app: nginx
+spec:
+  replicas: 3 # prod needs 3 replicas
+  template:
+    metadata:
+      labels:
+        app: nginx
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.14.2
+        resources:
+          limits:
+            cpu: 0.5
+            memory: 1024Mi
+`
+
+func TestUpdateFromTypedDeployment(t *testing.T) {
+	testcases := map[string]struct {
+		update   func(d *appsv1.Deployment)
+		expected string
+	}{
+		"no change": {
+			update:   func(d *appsv1.Deployment) {},
+			expected: deploymentYAML,
+		},
+		"one field": {
+			update: func(d *appsv1.Deployment) {
+				d.Spec.Template.Spec.Containers[0].Image = "nginx:1.21"
+			},
+			expected: strings.Replace(deploymentYAML, "nginx:1.14.2", "nginx:1.21", 1),
+		},
+		"new container": {
+			update: func(d *appsv1.Deployment) {
+				d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, corev1.Container{Name: "logger", Image: "logger:v1"})
+			},
+			expected: deploymentYAML + `      - name: logger
+        image: logger:v1
+`,
+		},
+		"removed field": {
+			update: func(d *appsv1.Deployment) {
+				d.Spec.Replicas = nil
+			},
+			expected: strings.Replace(deploymentYAML, "  replicas: 3 # prod needs 3 replicas\n", "", 1),
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			obj, err := fn.ParseKubeObject([]byte(deploymentYAML))
+			require.NoError(t, err)
+			var d appsv1.Deployment
+			require.NoError(t, obj.As(&d))
+			tc.update(&d)
+			require.NoError(t, obj.UpdateFrom(&d))
+			assert.Equal(t, tc.expected, obj.String())
+		})
+	}
+}
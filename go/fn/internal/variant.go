@@ -83,7 +83,9 @@ func buildBoolNode(b bool) *yaml.Node {
 	}
 }
 
+// toVariant returns the variant of the node, following the aliases.
 func toVariant(n *yaml.Node) variant {
+	n = ResolveAlias(n)
 	switch n.Kind {
 	case yaml.ScalarNode:
 		return &scalarVariant{node: n}
@@ -97,16 +99,44 @@ func toVariant(n *yaml.Node) variant {
 	}
 }
 
+func joinComments(first, second string) string {
+	if first == "" || second == "" {
+		return first + second
+	}
+	return first + "\n\n" + second
+}
+
 func ExtractObjects(nodes ...*yaml.Node) ([]*MapVariant, error) {
 	var objects []*MapVariant
 
 	for _, node := range nodes {
+		node = ResolveAlias(node)
 		switch node.Kind {
 		case yaml.DocumentNode:
 			children, err := ExtractObjects(node.Content...)
 			if err != nil {
 				return nil, err
 			}
+			if len(children) == 1 {
+				// Keep the document comments, which would be lost with the
+				// document node.
+				child := children[0].node
+				first := child
+				if len(child.Content) > 0 {
+					first = child.Content[0]
+				}
+				switch {
+				case node.HeadComment == "":
+				case first.HeadComment == "":
+					// The trailing line breaks keep the blank line after
+					// the document comment.
+					first.HeadComment = node.HeadComment + "\n\n"
+				default:
+					first.HeadComment = joinComments(node.HeadComment, first.HeadComment)
+				}
+				child.FootComment = joinComments(child.FootComment, node.FootComment)
+				node.HeadComment, node.FootComment = "", ""
+			}
 			objects = append(objects, children...)
 		case yaml.MappingNode:
 			objects = append(objects, &MapVariant{node: node})
@@ -191,7 +221,18 @@ func MapVariantToTypedObject(mv *MapVariant, ptr interface{}) error {
 	// that depends on built-in types (e.g. metav1.ObjectMeta, corev1.PodTemplate).
 	// To work around it, we rely on the json tags. We first convert mv to json
 	// and then unmarshal it to ptr.
-	j, err := yaml.NewRNode(mv.Node()).MarshalJSON()
+	var j []byte
+	var err error
+	if mv.Node().Kind == yaml.MappingNode {
+		j, err = yaml.NewRNode(mv.Node()).MarshalJSON()
+	} else {
+		// A MapVariant may wrap a scalar or a sequence node when it represents a
+		// value matched by a path expression.
+		var v interface{}
+		if err = mv.Node().Decode(&v); err == nil {
+			j, err = json.Marshal(v)
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -15,6 +15,10 @@
 package fn
 
 import (
+	"bytes"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+
 	"sigs.k8s.io/kustomize/kyaml/errors"
 	"sigs.k8s.io/kustomize/kyaml/kio"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
@@ -23,14 +27,47 @@ import (
 // byteReadWriter wraps kio.ByteReadWriter
 type byteReadWriter struct {
 	kio.ByteReadWriter
+	// json tells whether the input is a JSON ResourceList, which is replied in
+	// JSON.
+	json bool
+	// parse hardens the parsing of the input.
+	parse ParseOptions
+	// output tells how the ResourceList is written.
+	output OutputOptions
 }
 
 // Read decodes input bytes into a ResourceList
 func (rw *byteReadWriter) Read() (*ResourceList, error) {
+	opts := rw.parse
+	in, err := opts.readInput(rw.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if internal.IsJSON(in) {
+		// The JSON input is always a ResourceList, see
+		// https://github.com/kubernetes-sigs/kustomize/blob/master/cmd/config/docs/api-conventions/functions-spec.md
+		rw.json = true
+		return ParseResourceListWithOptions(in, opts)
+	}
+	rw.Reader = bytes.NewReader(in)
 	nodes, err := rw.ByteReadWriter.Read()
 	if err != nil {
 		return nil, err
 	}
+	if err := opts.checkItems(len(nodes)); err != nil {
+		return nil, err
+	}
+	// Check the nodes as parsed, before the KubeObjects are parsed from them.
+	ynodes := make([]*yaml.Node, 0, len(nodes)+1)
+	for _, n := range nodes {
+		ynodes = append(ynodes, n.YNode())
+	}
+	if rw.ByteReadWriter.FunctionConfig != nil {
+		ynodes = append(ynodes, rw.ByteReadWriter.FunctionConfig.YNode())
+	}
+	if err := opts.checkNodes(ynodes); err != nil {
+		return nil, err
+	}
 	var items KubeObjects
 	for _, n := range nodes {
 		obj, err := ParseKubeObject([]byte(n.MustString()))
@@ -51,8 +88,24 @@ func (rw *byteReadWriter) Read() (*ResourceList, error) {
 
 // Write writes a ResourceList into bytes
 func (rw *byteReadWriter) Write(rl *ResourceList) error {
+	if rw.json {
+		out, err := rl.toJSON(rw.output)
+		if err != nil {
+			return err
+		}
+		_, err = rw.Writer.Write(out)
+		return errors.Wrap(err)
+	}
+	if rw.output.PreserveFormat && rw.WrappingKind == kio.ResourceListKind {
+		out, err := rl.toPreservedYAML()
+		if err != nil {
+			return err
+		}
+		_, err = rw.Writer.Write(out)
+		return errors.Wrap(err)
+	}
 	if len(rl.Results) > 0 {
-		b, err := yaml.Marshal(rl.Results)
+		b, err := yaml.Marshal(rl.Results.redacted(rl.secretRedactor()))
 		if err != nil {
 			return errors.Wrap(err)
 		}
@@ -64,10 +117,11 @@ func (rw *byteReadWriter) Write(rl *ResourceList) error {
 	}
 	var nodes []*yaml.RNode
 	for _, item := range rl.Items {
-		node, err := yaml.Parse(item.String())
+		node, err := yaml.Parse(item.yamlString())
 		if err != nil {
 			return err
 		}
+		internal.UntagMergeKeys(node.YNode())
 		nodes = append(nodes, node)
 	}
 	return rw.ByteReadWriter.Write(nodes)
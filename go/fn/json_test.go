@@ -0,0 +1,145 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The input is indented with tabs, which YAML rejects.
+var jsonResourceList = "{\n" +
+	"\t\"kind\": \"ResourceList\",\n" +
+	"\t\"apiVersion\": \"config.kubernetes.io/v1\",\n" +
+	"\t\"items\": [{\n" +
+	"\t\t\"kind\": \"ConfigMap\",\n" +
+	"\t\t\"apiVersion\": \"v1\",\n" +
+	"\t\t\"metadata\": {\"name\": \"config\"},\n" +
+	"\t\t\"data\": {\"enabled\": \"true\", \"url\": \"https://example.com/?a=<b>&c\"},\n" +
+	"\t\t\"spec\": {\"ratio\": 1.0, \"limit\": 1e3, \"big\": 12345678901234567890, \"empty\": null, \"on\": false}\n" +
+	"\t}]\n" +
+	"}\n"
+
+var expectedJSONOutput = `{
+  "apiVersion": "config.kubernetes.io/v1",
+  "kind": "ResourceList",
+  "items": [
+    {
+      "kind": "ConfigMap",
+      "apiVersion": "v1",
+      "metadata": {
+        "name": "config",
+        "labels": {
+          "app": "web"
+        }
+      },
+      "data": {
+        "enabled": "true",
+        "url": "https://example.com/?a=<b>&c"
+      },
+      "spec": {
+        "ratio": 1.0,
+        "limit": 1e3,
+        "big": 12345678901234567890,
+        "empty": null,
+        "on": false
+      }
+    }
+  ]
+}
+`
+
+func TestRunJSON(t *testing.T) {
+	process := ResourceListProcessorFunc(func(rl *ResourceList) (bool, error) {
+		return true, rl.Items[0].SetLabel("app", "web")
+	})
+
+	out, err := Run(process, []byte(jsonResourceList))
+	require.NoError(t, err)
+	assert.Equal(t, expectedJSONOutput, string(out))
+
+	var w bytes.Buffer
+	require.NoError(t, Execute(process, strings.NewReader(jsonResourceList), &w))
+	assert.Equal(t, expectedJSONOutput, w.String())
+}
+
+func TestParseResourceListJSON(t *testing.T) {
+	rl, err := ParseResourceList([]byte(jsonResourceList))
+	require.NoError(t, err)
+	require.Len(t, rl.Items, 1)
+	enabled, _, _ := rl.Items[0].NestedString("data", "enabled")
+	assert.Equal(t, "true", enabled)
+	ratio, _, _ := rl.Items[0].NestedFloat64("spec", "ratio")
+	assert.Equal(t, 1.0, ratio)
+	assert.Contains(t, rl.Items[0].String(), `enabled: "true"`)
+
+	// A YAML flow mapping is not JSON.
+	rl, err = ParseResourceList([]byte(`{apiVersion: config.kubernetes.io/v1, kind: ResourceList}`))
+	require.NoError(t, err)
+	assert.Empty(t, rl.Items)
+}
+
+func TestToJSON(t *testing.T) {
+	rl, err := ParseResourceList([]byte(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: config
+    labels: &labels
+      app: web
+    annotations:
+      <<: *labels
+  data:
+    mode: 0x1F
+    replicas: 3
+    enabled: yes
+    path: /tmp # the path
+`))
+	require.NoError(t, err)
+	out, err := rl.ToJSON()
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "apiVersion": "config.kubernetes.io/v1",
+  "kind": "ResourceList",
+  "items": [
+    {
+      "apiVersion": "v1",
+      "kind": "ConfigMap",
+      "metadata": {
+        "name": "config",
+        "labels": {
+          "app": "web"
+        },
+        "annotations": {
+          "app": "web"
+        }
+      },
+      "data": {
+        "mode": 31,
+        "replicas": 3,
+        "enabled": "yes",
+        "path": "/tmp"
+      }
+    }
+  ]
+}
+`, string(out))
+}
@@ -0,0 +1,453 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// JSON Patch operations defined in RFC 6902.
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+	PatchOpMove    = "move"
+	PatchOpCopy    = "copy"
+	PatchOpTest    = "test"
+)
+
+// PatchOperation is a single RFC 6902 JSON Patch operation. Path and From are
+// RFC 6901 JSON pointers, e.g. `/spec/template/spec/containers/0/image`.
+type PatchOperation struct {
+	Op    string      `yaml:"op" json:"op"`
+	Path  string      `yaml:"path" json:"path"`
+	From  string      `yaml:"from,omitempty" json:"from,omitempty"`
+	Value interface{} `yaml:"value" json:"value"`
+}
+
+// ErrJSONPatch is returned when an operation of a JSON Patch cannot be applied.
+type ErrJSONPatch struct {
+	// Index is the index of the failed operation in the patch.
+	Index int
+	// Op is the failed operation.
+	Op string
+	// Path is the JSON pointer the failed operation applies to.
+	Path string
+	// Err is the cause.
+	Err error
+}
+
+func (e *ErrJSONPatch) Error() string {
+	return fmt.Sprintf("json patch operation %d (%s %q) failed: %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *ErrJSONPatch) Unwrap() error {
+	return e.Err
+}
+
+// ParseJSONPatch parses a RFC 6902 JSON Patch document, in either JSON or
+// YAML format, into PatchOperations.
+func ParseJSONPatch(in []byte) ([]PatchOperation, error) {
+	var ops []PatchOperation
+	if err := yaml.Unmarshal(in, &ops); err != nil {
+		return nil, fmt.Errorf("failed to parse json patch: %w", err)
+	}
+	return ops, nil
+}
+
+// ApplyJSONPatch applies the RFC 6902 JSON Patch operations to the KubeObject.
+// The operations are applied atomically: if any operation fails, the KubeObject
+// is left untouched and an *ErrJSONPatch tells which operation failed.
+// Comments and field order of the untouched fields are kept.
+func (o *KubeObject) ApplyJSONPatch(ops []PatchOperation) error {
+	return o.writeUnlocked(jsonPatchTarget(ops), func(o *SubObject) error {
+		doc := yaml.CopyYNode(o.obj.Node())
+		for i, op := range ops {
+			if err := applyPatchOperation(doc, op); err != nil {
+				return &ErrJSONPatch{Index: i, Op: op.Op, Path: op.Path, Err: err}
+			}
+		}
+		if doc.Kind != yaml.MappingNode {
+			return &ErrJSONPatch{Index: len(ops) - 1, Op: ops[len(ops)-1].Op, Path: ops[len(ops)-1].Path,
+				Err: fmt.Errorf("the patched document is not an object")}
+		}
+		*o.obj.Node() = *doc
+		return nil
+	})
+}
+
+// jsonPatchTarget returns the path segments of the common parent of the fields
+// modified by the operations, which the FieldLocks are checked against.
+func jsonPatchTarget(ops []PatchOperation) []pathSegment {
+	var target []pathSegment
+	first := true
+	for _, op := range ops {
+		pointers := []string{op.Path}
+		switch op.Op {
+		case PatchOpTest:
+			continue
+		case PatchOpMove:
+			pointers = append(pointers, op.From)
+		}
+		for _, pointer := range pointers {
+			segments := pointerSegments(pointer)
+			if first {
+				target, first = segments, false
+				continue
+			}
+			n := 0
+			for n < len(target) && n < len(segments) && target[n] == segments[n] {
+				n++
+			}
+			target = target[:n]
+		}
+	}
+	return target
+}
+
+// pointerSegments converts a JSON pointer to path segments. The pointer is cut
+// at the first numeric or `-` token, which can locate either a sequence element
+// or a field.
+func pointerSegments(pointer string) []pathSegment {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil
+	}
+	var segments []pathSegment
+	for _, t := range tokens {
+		if _, err := strconv.Atoi(t); err == nil || t == "-" {
+			break
+		}
+		segments = append(segments, pathSegment{kind: segmentField, key: t})
+	}
+	return segments
+}
+
+func applyPatchOperation(doc *yaml.Node, op PatchOperation) error {
+	switch op.Op {
+	case PatchOpAdd:
+		value, err := valueToYNode(op.Value)
+		if err != nil {
+			return err
+		}
+		return addNode(doc, op.Path, value)
+	case PatchOpRemove:
+		_, err := removeNode(doc, op.Path)
+		return err
+	case PatchOpReplace:
+		value, err := valueToYNode(op.Value)
+		if err != nil {
+			return err
+		}
+		target, err := findNode(doc, op.Path)
+		if err != nil {
+			return err
+		}
+		copyComments(target, value)
+		*target = *value
+		return nil
+	case PatchOpMove:
+		if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+			return fmt.Errorf("cannot move %q into its own child", op.From)
+		}
+		value, err := removeNode(doc, op.From)
+		if err != nil {
+			return err
+		}
+		return addNode(doc, op.Path, value)
+	case PatchOpCopy:
+		from, err := findNode(doc, op.From)
+		if err != nil {
+			return err
+		}
+		return addNode(doc, op.Path, yaml.CopyYNode(from))
+	case PatchOpTest:
+		target, err := findNode(doc, op.Path)
+		if err != nil {
+			return err
+		}
+		value, err := valueToYNode(op.Value)
+		if err != nil {
+			return err
+		}
+		equal, err := equalYNodes(target, value)
+		if err != nil {
+			return err
+		}
+		if !equal {
+			return fmt.Errorf("test failed: value is not equal to %v", op.Value)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// parsePointer splits a RFC 6901 JSON pointer into unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer %q: must start with '/'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// findNode returns the node the pointer refers to.
+func findNode(doc *yaml.Node, pointer string) (*yaml.Node, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	current := doc
+	for _, t := range tokens {
+		current, err = childNode(current, t)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+// findParent returns the parent node of the pointer and the last reference token.
+func findParent(doc *yaml.Node, pointer string) (*yaml.Node, string, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(tokens) == 0 {
+		return nil, "", fmt.Errorf("the operation cannot apply to the whole document")
+	}
+	current := doc
+	for _, t := range tokens[:len(tokens)-1] {
+		current, err = childNode(current, t)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return current, tokens[len(tokens)-1], nil
+}
+
+func childNode(node *yaml.Node, token string) (*yaml.Node, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == token {
+				return node.Content[i+1], nil
+			}
+		}
+		return nil, fmt.Errorf("field %q not found", token)
+	case yaml.SequenceNode:
+		i, err := sequenceIndex(token, len(node.Content))
+		if err != nil {
+			return nil, err
+		}
+		if i == len(node.Content) {
+			return nil, fmt.Errorf("index %q out of range", token)
+		}
+		return node.Content[i], nil
+	default:
+		return nil, fmt.Errorf("cannot reference %q in a scalar value", token)
+	}
+}
+
+// sequenceIndex converts a reference token to an index of a sequence of length n.
+// "-" refers to the (nonexistent) element after the last one.
+func sequenceIndex(token string, n int) (int, error) {
+	if token == "-" {
+		return n, nil
+	}
+	if len(token) > 1 && token[0] == '0' {
+		return 0, fmt.Errorf("invalid index %q: leading zeros are not allowed", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > n {
+		return 0, fmt.Errorf("index %q out of range", token)
+	}
+	return i, nil
+}
+
+func addNode(doc *yaml.Node, pointer string, value *yaml.Node) error {
+	if pointer == "" {
+		*doc = *value
+		return nil
+	}
+	parent, token, err := findParent(doc, pointer)
+	if err != nil {
+		return err
+	}
+	switch parent.Kind {
+	case yaml.MappingNode:
+		setMappingValue(parent, token, value)
+		return nil
+	case yaml.SequenceNode:
+		i, err := sequenceIndex(token, len(parent.Content))
+		if err != nil {
+			return err
+		}
+		parent.Content = append(parent.Content, nil)
+		copy(parent.Content[i+1:], parent.Content[i:])
+		parent.Content[i] = value
+		return nil
+	default:
+		return fmt.Errorf("cannot add %q to a scalar value", token)
+	}
+}
+
+func removeNode(doc *yaml.Node, pointer string) (*yaml.Node, error) {
+	parent, token, err := findParent(doc, pointer)
+	if err != nil {
+		return nil, err
+	}
+	switch parent.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(parent.Content); i += 2 {
+			if parent.Content[i].Value == token {
+				value := parent.Content[i+1]
+				parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf("field %q not found", token)
+	case yaml.SequenceNode:
+		i, err := sequenceIndex(token, len(parent.Content))
+		if err != nil {
+			return nil, err
+		}
+		if i == len(parent.Content) {
+			return nil, fmt.Errorf("index %q out of range", token)
+		}
+		value := parent.Content[i]
+		parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+		return value, nil
+	default:
+		return nil, fmt.Errorf("cannot remove %q from a scalar value", token)
+	}
+}
+
+// setMappingValue sets the value of key in a mapping node. An existing key keeps
+// its position and comments.
+func setMappingValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			copyComments(m.Content[i+1], value)
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagString, Value: key}, value)
+}
+
+// valueToYNode converts a value decoded from JSON or YAML to a yaml.Node.
+func valueToYNode(v interface{}) (*yaml.Node, error) {
+	if node, ok := v.(*yaml.Node); ok {
+		return yaml.CopyYNode(node), nil
+	}
+	// JSON is valid YAML. Going through JSON keeps the numbers as they are,
+	// e.g. 3 stays an integer instead of becoming the float 3.0.
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert value %v: %w", v, err)
+	}
+	doc := &yaml.Node{}
+	if err = yaml.Unmarshal(j, doc); err != nil {
+		return nil, fmt.Errorf("unable to convert value %v: %w", v, err)
+	}
+	node := doc.Content[0]
+	clearStyle(node)
+	return node, nil
+}
+
+// clearStyle resets the JSON flow and quoting styles so the node is emitted in
+// the block style.
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyle(child)
+	}
+}
+
+// equalYNodes compares the values of two nodes, ignoring comments and styles.
+func equalYNodes(a, b *yaml.Node) (bool, error) {
+	var va, vb interface{}
+	if err := a.Decode(&va); err != nil {
+		return false, err
+	}
+	if err := b.Decode(&vb); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(va, vb), nil
+}
+
+// ApplyMergePatch applies a RFC 7386 JSON Merge Patch to the KubeObject. Fields
+// set to null in the patch are removed, maps are merged recursively, and any
+// other value replaces the existing one. Comments and field order of the
+// existing fields are kept.
+func (o *KubeObject) ApplyMergePatch(patch *KubeObject) error {
+	if patch == nil {
+		return nil
+	}
+	return o.writeUnlocked(nil, func(o *SubObject) error {
+		mergePatchNode(o.obj.Node(), patch.obj.Node())
+		return nil
+	})
+}
+
+// mergePatchNode merges the patch mapping node into the target mapping node.
+func mergePatchNode(target, patch *yaml.Node) {
+	for i := 0; i+1 < len(patch.Content); i += 2 {
+		key, value := patch.Content[i].Value, patch.Content[i+1]
+		if value.Kind == yaml.ScalarNode && value.Tag == yaml.NodeTagNull {
+			for j := 0; j+1 < len(target.Content); j += 2 {
+				if target.Content[j].Value == key {
+					target.Content = append(target.Content[:j], target.Content[j+2:]...)
+					break
+				}
+			}
+			continue
+		}
+		if value.Kind == yaml.MappingNode {
+			var existing *yaml.Node
+			for j := 0; j+1 < len(target.Content); j += 2 {
+				if target.Content[j].Value == key {
+					existing = target.Content[j+1]
+					break
+				}
+			}
+			if existing != nil && existing.Kind == yaml.MappingNode {
+				mergePatchNode(existing, value)
+				continue
+			}
+			merged := &yaml.Node{Kind: yaml.MappingNode, Tag: yaml.NodeTagMap}
+			mergePatchNode(merged, value)
+			setMappingValue(target, key, merged)
+			continue
+		}
+		value = yaml.CopyYNode(value)
+		clearStyle(value)
+		setMappingValue(target, key, value)
+	}
+}
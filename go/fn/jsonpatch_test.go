@@ -0,0 +1,120 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var patchTarget = []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: example # the name
+  labels:
+    app: example
+data:
+  # the greeting
+  greeting: hello
+  count: "1"
+list:
+- a
+- b
+`)
+
+func TestApplyJSONPatch(t *testing.T) {
+	ops, err := ParseJSONPatch([]byte(`[
+  {"op": "test", "path": "/data/greeting", "value": "hello"},
+  {"op": "replace", "path": "/data/greeting", "value": "hi"},
+  {"op": "add", "path": "/metadata/labels/tier", "value": "web"},
+  {"op": "add", "path": "/list/1", "value": "c"},
+  {"op": "add", "path": "/list/-", "value": "d"},
+  {"op": "remove", "path": "/list/0"},
+  {"op": "copy", "from": "/metadata/labels", "path": "/spec"},
+  {"op": "move", "from": "/data/count", "path": "/data/total"},
+  {"op": "add", "path": "/replicas", "value": 3}
+]`))
+	require.NoError(t, err)
+	obj, err := ParseKubeObject(patchTarget)
+	require.NoError(t, err)
+	require.NoError(t, obj.ApplyJSONPatch(ops))
+	expected := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: example # the name
+  labels:
+    app: example
+    tier: web
+data:
+  # the greeting
+  greeting: hi
+  total: "1"
+list:
+- c
+- b
+- d
+spec:
+  app: example
+  tier: web
+replicas: 3
+`
+	assert.Equal(t, expected, obj.String())
+}
+
+func TestApplyJSONPatchError(t *testing.T) {
+	ops, err := ParseJSONPatch([]byte(`
+- op: replace
+  path: /data/greeting
+  value: hi
+- op: remove
+  path: /data/unknown
+`))
+	require.NoError(t, err)
+	obj, err := ParseKubeObject(patchTarget)
+	require.NoError(t, err)
+	err = obj.ApplyJSONPatch(ops)
+	var patchErr *ErrJSONPatch
+	require.True(t, errors.As(err, &patchErr))
+	assert.Equal(t, 1, patchErr.Index)
+	assert.Equal(t, "/data/unknown", patchErr.Path)
+	assert.Equal(t, `json patch operation 1 (remove "/data/unknown") failed: field "unknown" not found`, err.Error())
+	// The failed patch should not change the object.
+	assert.Equal(t, string(patchTarget), obj.String())
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	obj, err := ParseKubeObject(patchTarget)
+	require.NoError(t, err)
+	patch, err := ParseKubeObject([]byte(`{"metadata": {"labels": {"app": null, "tier": "web"}}, "data": {"greeting": "hi"}, "list": ["x"]}`))
+	require.NoError(t, err)
+	require.NoError(t, obj.ApplyMergePatch(patch))
+	expected := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: example # the name
+  labels:
+    tier: web
+data:
+  # the greeting
+  greeting: hi
+  count: "1"
+list:
+- x
+`
+	assert.Equal(t, expected, obj.String())
+}
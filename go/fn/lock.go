@@ -0,0 +1,468 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// LockedFieldsAnnotation lists the path expressions (see GetPath) of the
+// fields of a KubeObject which must not be modified, separated by commas, e.g.
+// `spec.replicas, spec.template.spec.containers[name=app].image`. The
+// annotation itself is locked as well. It is enforced by the
+// LockedFieldsAnnotationLock, which is one of the DefaultFieldLocks.
+const LockedFieldsAnnotation = "kpt.dev/locked-fields"
+
+// FieldLock protects some fields of the KubeObjects from being modified. The
+// FieldLocks of a KubeObject (see SetFieldLocks) are enforced by all the
+// setters of the KubeObject and its SubObjects, e.g. SetNestedField,
+// RemoveNestedField, SetSlice, UpsertMap, SetPath, UpdateFrom, the patches and
+// WalkReplace: a change which adds, modifies or removes a locked field fails
+// with an ErrLockedField error, and the KubeObject is left untouched.
+type FieldLock interface {
+	// Name identifies the FieldLock in the ErrLockedField errors.
+	Name() string
+	// LockedPaths returns the path expressions (see GetPath) of the locked
+	// fields of the KubeObject, as it is before the change. A locked path
+	// which matches no field locks the field from being added.
+	LockedPaths(obj *KubeObject) []string
+}
+
+type fieldLock struct {
+	name        string
+	lockedPaths func(obj *KubeObject) []string
+	// err is returned instead of an ErrLockedField if it is set.
+	err error
+}
+
+func (l *fieldLock) Name() string {
+	return l.name
+}
+
+func (l *fieldLock) LockedPaths(obj *KubeObject) []string {
+	return l.lockedPaths(obj)
+}
+
+// NewFieldLock returns a FieldLock which locks the paths returned by the
+// lockedPaths function.
+func NewFieldLock(name string, lockedPaths func(obj *KubeObject) []string) FieldLock {
+	return &fieldLock{name: name, lockedPaths: lockedPaths}
+}
+
+// LockPaths returns a FieldLock which locks the path expressions (see GetPath)
+// in the KubeObjects of the given GroupKind, e.g.
+//
+//	fn.LockPaths("selector", schema.GroupKind{Group: "apps", Kind: "Deployment"}, "spec.selector")
+//
+// The zero GroupKind locks the paths in all the KubeObjects.
+func LockPaths(name string, gk schema.GroupKind, paths ...string) FieldLock {
+	return NewFieldLock(name, func(obj *KubeObject) []string {
+		if gk != (schema.GroupKind{}) && obj.GroupKind() != gk {
+			return nil
+		}
+		return paths
+	})
+}
+
+// UpstreamIdentifierLock locks the kpt managed UpstreamIdentifier annotation.
+// It is one of the DefaultFieldLocks. The changes to the annotation fail with
+// ErrAttemptToTouchUpstreamIdentifier.
+func UpstreamIdentifierLock() FieldLock {
+	return &fieldLock{
+		name: "upstream-identifier",
+		lockedPaths: func(*KubeObject) []string {
+			return []string{fmt.Sprintf("metadata.annotations[%q]", UpstreamIdentifier)}
+		},
+		err: ErrAttemptToTouchUpstreamIdentifier{},
+	}
+}
+
+// LockedFieldsAnnotationLock locks the fields listed in the
+// LockedFieldsAnnotation of the KubeObjects. It is one of the
+// DefaultFieldLocks.
+func LockedFieldsAnnotationLock() FieldLock {
+	return NewFieldLock("locked-fields-annotation", func(obj *KubeObject) []string {
+		annotation, found, _ := obj.obj.GetNestedString("metadata", "annotations", LockedFieldsAnnotation)
+		if !found {
+			return nil
+		}
+		paths := []string{fmt.Sprintf("metadata.annotations[%q]", LockedFieldsAnnotation)}
+		for _, path := range strings.Split(annotation, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	})
+}
+
+// InternalAnnotationsLock locks the `internal.config.kubernetes.io/*`
+// annotations, which are managed by the orchestrator, e.g. the PathAnnotation.
+// It locks the internal annotations the KubeObject has, and prevents the known
+// ones from being added.
+func InternalAnnotationsLock() FieldLock {
+	return NewFieldLock("internal-annotations", func(obj *KubeObject) []string {
+		keys := map[string]bool{
+			IndexAnnotation:     true,
+			PathAnnotation:      true,
+			SeqIndentAnnotation: true,
+			IdAnnotation:        true,
+			InternalAnnotationsMigrationResourceIDAnnotation: true,
+		}
+		for k := range obj.GetAnnotations() {
+			if strings.HasPrefix(k, internalPrefix) {
+				keys[k] = true
+			}
+		}
+		paths := make([]string, 0, len(keys))
+		for k := range keys {
+			paths = append(paths, fmt.Sprintf("metadata.annotations[%q]", k))
+		}
+		sort.Strings(paths)
+		return paths
+	})
+}
+
+// immutableFields lists the fields which cannot be updated once the object is
+// created in the cluster.
+var immutableFields = map[schema.GroupKind][]string{
+	{Group: "apps", Kind: "Deployment"}:                              {"spec.selector"},
+	{Group: "apps", Kind: "ReplicaSet"}:                              {"spec.selector"},
+	{Group: "apps", Kind: "DaemonSet"}:                               {"spec.selector"},
+	{Group: "apps", Kind: "StatefulSet"}:                             {"spec.selector", "spec.serviceName", "spec.volumeClaimTemplates", "spec.podManagementPolicy"},
+	{Group: "batch", Kind: "Job"}:                                    {"spec.selector", "spec.template", "spec.completionMode"},
+	{Kind: "Service"}:                                                {"spec.clusterIP", "spec.clusterIPs"},
+	{Kind: "PersistentVolumeClaim"}:                                  {"spec.accessModes", "spec.storageClassName", "spec.volumeMode", "spec.selector"},
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}:        {"roleRef"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}: {"roleRef"},
+}
+
+// ImmutableFieldsLock locks the fields which the API server refuses to update,
+// e.g. the selector of a Deployment or the roleRef of a RoleBinding, as well as
+// the data of the ConfigMaps and Secrets marked `immutable: true`.
+func ImmutableFieldsLock() FieldLock {
+	return NewFieldLock("immutable-fields", func(obj *KubeObject) []string {
+		gk := obj.GroupKind()
+		if gk == (schema.GroupKind{Kind: "ConfigMap"}) || gk == (schema.GroupKind{Kind: "Secret"}) {
+			if immutable, _, _ := obj.obj.GetNestedBool("immutable"); immutable {
+				return []string{"immutable", "data", "binaryData", "stringData"}
+			}
+			return nil
+		}
+		return immutableFields[gk]
+	})
+}
+
+// DefaultFieldLocks returns the FieldLocks enforced by the setters of the
+// KubeObjects which have no FieldLocks set: the UpstreamIdentifierLock and the
+// LockedFieldsAnnotationLock.
+func DefaultFieldLocks() []FieldLock {
+	return []FieldLock{UpstreamIdentifierLock(), LockedFieldsAnnotationLock()}
+}
+
+// FieldLocks returns the FieldLocks enforced by the setters of the KubeObject.
+func (o *KubeObject) FieldLocks() []FieldLock {
+	if o.locks == nil {
+		return DefaultFieldLocks()
+	}
+	return o.locks
+}
+
+// SetFieldLocks sets the FieldLocks enforced by the setters of the KubeObject
+// and its SubObjects, in place of the DefaultFieldLocks.
+func (o *KubeObject) SetFieldLocks(locks ...FieldLock) {
+	o.locks = append([]FieldLock{}, locks...)
+}
+
+// AddFieldLocks adds FieldLocks to be enforced by the setters of the
+// KubeObject and its SubObjects, e.g. a function can call
+//
+//	rl.Items.AddFieldLocks(fn.InternalAnnotationsLock(), fn.ImmutableFieldsLock())
+//
+// before running. The objects added by ResourceList.UpsertObjectToItems get
+// the FieldLocks of the items.
+func (o *KubeObject) AddFieldLocks(locks ...FieldLock) {
+	o.SetFieldLocks(append(o.FieldLocks(), locks...)...)
+}
+
+// SetFieldLocks sets the FieldLocks of all the KubeObjects.
+func (o KubeObjects) SetFieldLocks(locks ...FieldLock) {
+	for _, obj := range o {
+		obj.SetFieldLocks(locks...)
+	}
+}
+
+// AddFieldLocks adds the FieldLocks to all the KubeObjects.
+func (o KubeObjects) AddFieldLocks(locks ...FieldLock) {
+	for _, obj := range o {
+		obj.AddFieldLocks(locks...)
+	}
+}
+
+// fieldLocks returns the FieldLocks set on the first KubeObject which has some.
+func (o KubeObjects) fieldLocks() []FieldLock {
+	for _, obj := range o {
+		if obj.locks != nil {
+			return obj.locks
+		}
+	}
+	return nil
+}
+
+// rootNode returns the node of the KubeObject holding the SubObject.
+func (o *SubObject) rootNode() *internal.MapVariant {
+	if o.root != nil {
+		return o.root
+	}
+	return o.obj
+}
+
+// aliases returns the aliases of the documents the KubeObject holding the
+// SubObject was parsed with.
+func (o *SubObject) aliases() *internal.Aliases {
+	return o.rootNode().Aliases()
+}
+
+// rootObject returns the KubeObject holding the SubObject.
+func (o *SubObject) rootObject() *KubeObject {
+	if owner, ok := o.rootNode().Owner().(*KubeObject); ok && owner.obj == o.rootNode() {
+		return owner
+	}
+	return &KubeObject{SubObject: SubObject{parentGVK: o.parentGVK, obj: o.rootNode()}}
+}
+
+// fieldSegments converts the plain field names of the setters to path segments.
+func fieldSegments(fields ...string) []pathSegment {
+	segments := make([]pathSegment, 0, len(fields))
+	for _, f := range fields {
+		segments = append(segments, pathSegment{kind: segmentField, key: f})
+	}
+	return segments
+}
+
+// writeUnlocked runs write on the SubObject, unless it modifies a field locked
+// by a FieldLock of the KubeObject. target locates the changed fields in the
+// SubObject, nil meaning the whole SubObject. When target overlaps a locked
+// field, the locked fields are compared before and after the write, and the
+// write is undone if it fails or changes one of them.
+func (o *SubObject) writeUnlocked(target []pathSegment, write func(o *SubObject) error) error {
+	if o == nil || o.obj == nil {
+		return write(o)
+	}
+	// The aliases of the whole document are copied on write.
+	o.obj.SetAliases(o.aliases())
+	// Let the indexes of the KubeObject know it may have changed.
+	defer o.rootNode().Touch()
+	root := o.rootObject()
+	locks := root.FieldLocks()
+	if len(locks) == 0 {
+		return write(o)
+	}
+	location, found := o.location()
+	if !found {
+		// The SubObject has been detached from its KubeObject.
+		return write(o)
+	}
+	target = append(location, target...)
+
+	type lockedPath struct {
+		lock     FieldLock
+		segments []pathSegment
+		before   []pathMatch
+	}
+	var lockedPaths []lockedPath
+	for _, lock := range locks {
+		for _, path := range lock.LockedPaths(root) {
+			segments, err := parsePath(path)
+			if err != nil {
+				return fmt.Errorf("invalid locked path of field lock %v: %w", lock.Name(), err)
+			}
+			if segmentsOverlap(segments, target) {
+				lockedPaths = append(lockedPaths, lockedPath{lock: lock, segments: segments, before: copyMatches(root.resolvePath(segments))})
+			}
+		}
+	}
+	if len(lockedPaths) == 0 {
+		return write(o)
+	}
+
+	snapshot := takeSnapshot(root.obj.Node())
+	if err := write(o); err != nil {
+		snapshot.restore()
+		return err
+	}
+	for _, locked := range lockedPaths {
+		if fieldpath, changed := lockedFieldChanged(locked.before, root.resolvePath(locked.segments)); changed {
+			snapshot.restore()
+			if l, ok := locked.lock.(*fieldLock); ok && l.err != nil {
+				return l.err
+			}
+			return &ErrLockedField{Lock: locked.lock.Name(), Object: root, Path: fieldpath}
+		}
+	}
+	return nil
+}
+
+// nodeSnapshot holds the state of the nodes of a YAML tree, so that a write can
+// be undone in place, keeping the nodes held by the SubObjects. The aliases of
+// the other documents which a write at an anchor replaces by copies are not
+// restored: they keep their values.
+type nodeSnapshot map[*yaml.Node]yaml.Node
+
+func takeSnapshot(root *yaml.Node) nodeSnapshot {
+	s := nodeSnapshot{}
+	s.add(root)
+	return s
+}
+
+func (s nodeSnapshot) add(n *yaml.Node) {
+	if _, found := s[n]; found {
+		return
+	}
+	saved := *n
+	saved.Content = append([]*yaml.Node(nil), n.Content...)
+	s[n] = saved
+	for _, child := range n.Content {
+		s.add(child)
+	}
+}
+
+func (s nodeSnapshot) restore() {
+	for n, saved := range s {
+		*n = saved
+	}
+}
+
+// copyMatches copies the matched nodes, so that they keep their values when
+// the KubeObject is written.
+func copyMatches(matches []pathMatch) []pathMatch {
+	copied := make([]pathMatch, 0, len(matches))
+	for _, m := range matches {
+		copied = append(copied, pathMatch{node: internal.NewMap(m.node).DeepCopy().Node(), fieldpath: m.fieldpath})
+	}
+	return copied
+}
+
+// lockedFieldChanged compares the fields matched by a locked path before and
+// after the change, and returns the path of the first changed field.
+func lockedFieldChanged(beforeMatches, afterMatches []pathMatch) (string, bool) {
+	afterNodes := map[string][]*yaml.Node{}
+	for _, m := range afterMatches {
+		afterNodes[m.fieldpath] = append(afterNodes[m.fieldpath], m.node)
+	}
+	beforeNodes := map[string][]*yaml.Node{}
+	for _, m := range beforeMatches {
+		beforeNodes[m.fieldpath] = append(beforeNodes[m.fieldpath], m.node)
+	}
+	for _, m := range append(beforeMatches, afterMatches...) {
+		b, a := beforeNodes[m.fieldpath], afterNodes[m.fieldpath]
+		if len(b) != len(a) {
+			return strings.TrimPrefix(m.fieldpath, "."), true
+		}
+		for i := range b {
+			var changes []FieldChange
+			diffNodes("", b[i], a[i], &changes)
+			if len(changes) > 0 {
+				return strings.TrimPrefix(m.fieldpath, "."), true
+			}
+		}
+	}
+	return "", false
+}
+
+// segmentsOverlap tells whether two paths may locate the same field, or a field
+// and one of its parents.
+func segmentsOverlap(a, b []pathSegment) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if !segmentsCompatible(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func segmentsCompatible(a, b pathSegment) bool {
+	isField := func(s pathSegment) bool {
+		return s.kind == segmentField || s.kind == segmentFieldWildcard
+	}
+	switch {
+	case isField(a) != isField(b):
+		return false
+	case a.kind == segmentField && b.kind == segmentField:
+		return a.key == b.key
+	case a.kind == segmentIndex && b.kind == segmentIndex:
+		return a.index == b.index
+	default:
+		// Wildcards and selectors may match anything.
+		return true
+	}
+}
+
+// location returns the path segments from the KubeObject to the SubObject. They
+// are parsed from the fieldpath, the KubeObject is only searched for the
+// SubObject when the fieldpath is ambiguous, e.g. a selector matching several
+// sequence elements.
+func (o *SubObject) location() ([]pathSegment, bool) {
+	if o.root == nil {
+		return []pathSegment{}, true
+	}
+	if segments, err := parsePath(o.FieldPath()); err == nil {
+		if node, found := resolveLocation(o.root.Node(), segments); found && node == o.obj.Node() {
+			return segments, true
+		}
+	}
+	return nodeLocation(o.root.Node(), o.obj.Node())
+}
+
+// resolveLocation returns the single node located by the path segments.
+func resolveLocation(root *yaml.Node, segments []pathSegment) (*yaml.Node, bool) {
+	node := root
+	for _, seg := range segments {
+		matches, _ := matchSegment(pathMatch{node: node}, seg, nil, false)
+		if len(matches) != 1 {
+			return nil, false
+		}
+		node = matches[0].node
+	}
+	return node, true
+}
+
+// nodeLocation returns the path segments from the root node to the target node.
+func nodeLocation(root, target *yaml.Node) ([]pathSegment, bool) {
+	if root == target {
+		return []pathSegment{}, true
+	}
+	switch root.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if location, found := nodeLocation(root.Content[i+1], target); found {
+				return append([]pathSegment{{kind: segmentField, key: root.Content[i].Value}}, location...), true
+			}
+		}
+	case yaml.SequenceNode:
+		for i, elem := range root.Content {
+			if location, found := nodeLocation(elem, target); found {
+				return append([]pathSegment{{kind: segmentIndex, index: i}}, location...), true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,367 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var lockedDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    kpt.dev/locked-fields: spec.replicas, spec.template.spec.containers[name=app].image
+    internal.config.kubernetes.io/path: app.yaml
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: app
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:v1
+      - name: sidecar
+        image: sidecar:v1
+`
+
+func TestFieldLocks(t *testing.T) {
+	testcases := map[string]struct {
+		locks  []FieldLock
+		write  func(o *KubeObject) error
+		lock   string
+		path   string
+		locked bool
+	}{
+		"set locked field": {
+			write:  func(o *KubeObject) error { return o.SetNestedInt(5, "spec", "replicas") },
+			lock:   "locked-fields-annotation",
+			path:   "spec.replicas",
+			locked: true,
+		},
+		"set locked field to the same value": {
+			write: func(o *KubeObject) error { return o.SetNestedInt(3, "spec", "replicas") },
+		},
+		"set unlocked field": {
+			write: func(o *KubeObject) error {
+				_, err := o.SetPath("sidecar:v2", "spec.template.spec.containers[name=sidecar].image")
+				return err
+			},
+		},
+		"set locked field of SubObject": {
+			write: func(o *KubeObject) error {
+				containers, _, err := o.NestedSlice("spec", "template", "spec", "containers")
+				if err != nil {
+					return err
+				}
+				return containers[0].SetNestedString("app:v2", "image")
+			},
+			lock:   "locked-fields-annotation",
+			path:   "spec.template.spec.containers[name=app].image",
+			locked: true,
+		},
+		"set path": {
+			write: func(o *KubeObject) error {
+				_, err := o.SetPath("app:v2", "spec.template.spec.containers[*].image")
+				return err
+			},
+			lock:   "locked-fields-annotation",
+			path:   "spec.template.spec.containers[name=app].image",
+			locked: true,
+		},
+		"remove parent": {
+			write: func(o *KubeObject) error {
+				_, err := o.RemoveNestedField("spec")
+				return err
+			},
+			lock:   "locked-fields-annotation",
+			path:   "spec.replicas",
+			locked: true,
+		},
+		"set slice": {
+			write: func(o *KubeObject) error {
+				podSpec, _, err := o.NestedSubObject("spec", "template", "spec")
+				if err != nil {
+					return err
+				}
+				return podSpec.SetSlice(nil, "containers")
+			},
+			lock:   "locked-fields-annotation",
+			path:   "spec.template.spec.containers[name=app].image",
+			locked: true,
+		},
+		"unlock": {
+			write:  func(o *KubeObject) error { return o.SetAnnotation(LockedFieldsAnnotation, "") },
+			lock:   "locked-fields-annotation",
+			path:   `metadata.annotations["kpt.dev/locked-fields"]`,
+			locked: true,
+		},
+		"immutable fields": {
+			locks: []FieldLock{ImmutableFieldsLock()},
+			write: func(o *KubeObject) error {
+				return o.SetNestedStringMap(map[string]string{"app": "other"}, "spec", "selector", "matchLabels")
+			},
+			lock:   "immutable-fields",
+			path:   "spec.selector",
+			locked: true,
+		},
+		"internal annotations": {
+			locks: []FieldLock{InternalAnnotationsLock()},
+			write: func(o *KubeObject) error {
+				_, err := o.RemoveNestedField("metadata", "annotations", PathAnnotation)
+				return err
+			},
+			lock:   "internal-annotations",
+			path:   `metadata.annotations["internal.config.kubernetes.io/path"]`,
+			locked: true,
+		},
+		"add locked field": {
+			locks:  []FieldLock{LockPaths("strategy", schema.GroupKind{Group: "apps", Kind: "Deployment"}, "spec.strategy")},
+			write:  func(o *KubeObject) error { return o.SetNestedString("Recreate", "spec", "strategy", "type") },
+			lock:   "strategy",
+			path:   "spec.strategy",
+			locked: true,
+		},
+		"json patch": {
+			write: func(o *KubeObject) error {
+				return o.ApplyJSONPatch([]PatchOperation{
+					{Op: PatchOpAdd, Path: "/spec/minReadySeconds", Value: 10},
+					{Op: PatchOpReplace, Path: "/spec/replicas", Value: 5},
+				})
+			},
+			lock:   "locked-fields-annotation",
+			path:   "spec.replicas",
+			locked: true,
+		},
+		"json patch of unlocked fields": {
+			write: func(o *KubeObject) error {
+				return o.ApplyJSONPatch([]PatchOperation{{Op: PatchOpReplace, Path: "/spec/template/spec/containers/1/image", Value: "sidecar:v2"}})
+			},
+		},
+		"merge patch": {
+			write: func(o *KubeObject) error {
+				patch, err := ParseKubeObject([]byte("spec:\n  replicas: 5\n"))
+				if err != nil {
+					return err
+				}
+				return o.ApplyMergePatch(patch)
+			},
+			lock:   "locked-fields-annotation",
+			path:   "spec.replicas",
+			locked: true,
+		},
+		"strategic merge patch": {
+			write: func(o *KubeObject) error {
+				patch, err := ParseKubeObject([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:v2
+`))
+				if err != nil {
+					return err
+				}
+				return o.ApplyStrategicMergePatch(patch)
+			},
+			lock:   "locked-fields-annotation",
+			path:   "spec.template.spec.containers[name=app].image",
+			locked: true,
+		},
+		"walk replace": {
+			write: func(o *KubeObject) error {
+				return o.Walk(func(path []PathElement, node *SubObject) WalkAction {
+					var s string
+					if node.IsScalar() && node.As(&s) == nil && s == "app:v1" {
+						return WalkReplace("app:v2")
+					}
+					return WalkContinue
+				})
+			},
+			lock:   "locked-fields-annotation",
+			path:   "spec.template.spec.containers[name=app].image",
+			locked: true,
+		},
+		"other kind": {
+			locks: []FieldLock{LockPaths("strategy", schema.GroupKind{Group: "apps", Kind: "StatefulSet"}, "spec.strategy")},
+			write: func(o *KubeObject) error { return o.SetNestedString("Recreate", "spec", "strategy", "type") },
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			obj, err := ParseKubeObject([]byte(lockedDeployment))
+			require.NoError(t, err)
+			obj.AddFieldLocks(tc.locks...)
+			err = tc.write(obj)
+			if !tc.locked {
+				assert.NoError(t, err)
+				return
+			}
+			var lockErr *ErrLockedField
+			require.True(t, errors.As(err, &lockErr), "unexpected error %v", err)
+			assert.Equal(t, tc.lock, lockErr.Lock)
+			assert.Equal(t, tc.path, lockErr.Path)
+			assert.Equal(t, lockedDeployment, obj.String())
+		})
+	}
+}
+
+func TestImmutableConfigMap(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  mode: prod
+`))
+	require.NoError(t, err)
+	obj.AddFieldLocks(ImmutableFieldsLock())
+	require.NoError(t, obj.SetNestedString("dev", "data", "mode"))
+	require.NoError(t, obj.SetNestedBool(true, "immutable"))
+	err = obj.SetNestedString("prod", "data", "mode")
+	var lockErr *ErrLockedField
+	require.True(t, errors.As(err, &lockErr), "unexpected error %v", err)
+	assert.Equal(t, "data", lockErr.Path)
+	assert.EqualError(t, lockErr, "field data of Resource(apiVersion=v1, kind=ConfigMap, namespace=, name=config) is locked by immutable-fields and should not be modified")
+}
+
+func TestRemoveLockedEmptyAnnotations(t *testing.T) {
+	input := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  annotations: {}
+`
+	obj, err := ParseKubeObject([]byte(input))
+	require.NoError(t, err)
+	obj.AddFieldLocks(LockPaths("annotations", schema.GroupKind{}, "metadata.annotations"))
+	err = obj.RemoveAnnotationsIfEmpty()
+	var lockErr *ErrLockedField
+	require.True(t, errors.As(err, &lockErr), "unexpected error %v", err)
+	assert.Equal(t, "metadata.annotations", lockErr.Path)
+	assert.Equal(t, input, obj.String())
+}
+
+func TestLockedUpsertMap(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(lockedDeployment))
+	require.NoError(t, err)
+	obj.AddFieldLocks(LockPaths("strategy", schema.GroupKind{}, "spec.strategy"))
+
+	strategy := obj.GetMap("spec").UpsertMap("strategy")
+	require.NoError(t, strategy.SetNestedString("Recreate", "type"))
+	assert.Equal(t, lockedDeployment, obj.String())
+	// The existing maps are returned.
+	template := obj.GetMap("spec").UpsertMap("template")
+	require.NoError(t, template.SetNestedString("web", "metadata", "labels", "tier"))
+	tier, _, _ := obj.NestedString("spec", "template", "metadata", "labels", "tier")
+	assert.Equal(t, "web", tier)
+}
+
+func TestLockedWriteIsUndone(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(lockedDeployment))
+	require.NoError(t, err)
+	obj.AddFieldLocks(LockPaths("replicas", schema.GroupKind{}, "spec.replicas"))
+	spec := obj.GetMap("spec")
+
+	// The patch sets a free field before the locked one.
+	patch, err := ParseKubeObject([]byte(`spec:
+  paused: true
+  replicas: 5
+`))
+	require.NoError(t, err)
+	var lockErr *ErrLockedField
+	require.True(t, errors.As(obj.ApplyMergePatch(patch), &lockErr))
+	assert.Equal(t, lockedDeployment, obj.String())
+
+	// The SubObjects taken before the refused write still write the KubeObject.
+	require.NoError(t, spec.SetNestedBool(true, "paused"))
+	paused, _, _ := obj.NestedBool("spec", "paused")
+	assert.True(t, paused)
+}
+
+func TestFieldLocksPerObject(t *testing.T) {
+	rl, err := ParseResourceList([]byte(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: config
+  data:
+    mode: prod
+`))
+	require.NoError(t, err)
+	rl.Items.AddFieldLocks(LockPaths("data", schema.GroupKind{}, "data"))
+	var lockErr *ErrLockedField
+	assert.True(t, errors.As(rl.Items[0].SetNestedString("dev", "data", "mode"), &lockErr))
+
+	// The objects added to the items are locked as well.
+	added := NewEmptyKubeObject()
+	require.NoError(t, added.SetAPIVersion("v1"))
+	require.NoError(t, added.SetKind("ConfigMap"))
+	require.NoError(t, added.SetName("other"))
+	require.NoError(t, rl.UpsertObjectToItems(added, nil, false))
+	assert.True(t, errors.As(added.SetNestedString("dev", "data", "mode"), &lockErr))
+
+	// The other objects are not.
+	other := NewEmptyKubeObject()
+	assert.NoError(t, other.SetNestedString("dev", "data", "mode"))
+}
+
+func TestLocation(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+spec:
+  containers:
+  - name: app
+    image: app:v1
+  - name: app
+    image: app:v2
+`))
+	require.NoError(t, err)
+	var locations []string
+	err = obj.Walk(func(path []PathElement, node *SubObject) WalkAction {
+		if len(path) == 3 {
+			location, found := node.location()
+			require.True(t, found)
+			actual, found := resolveLocation(obj.obj.Node(), location)
+			require.True(t, found)
+			assert.Same(t, node.obj.Node(), actual)
+			var segments []string
+			for _, seg := range location {
+				segments = append(segments, seg.String())
+			}
+			locations = append(locations, strings.Join(segments, " "))
+		}
+		return WalkContinue
+	})
+	require.NoError(t, err)
+	// The elements selected by an ambiguous name are located by index.
+	assert.Equal(t, []string{"spec containers [0]", "spec containers [1]"}, locations)
+}
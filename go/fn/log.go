@@ -19,10 +19,14 @@ import (
 	"os"
 )
 
+// Log writes the operands to stderr, like fmt.Println. The Secret values are
+// redacted if EnableSecretRedaction is on.
 func Log(in ...interface{}) {
-	fmt.Fprintln(os.Stderr, in...)
+	fmt.Fprint(os.Stderr, redactText(fmt.Sprintln(in...)))
 }
 
+// Logf writes the operands to stderr, like fmt.Printf. The Secret values are
+// redacted if EnableSecretRedaction is on.
 func Logf(format string, in ...interface{}) {
-	fmt.Fprintf(os.Stderr, format, in...)
+	fmt.Fprint(os.Stderr, redactText(fmt.Sprintf(format, in...)))
 }
@@ -0,0 +1,621 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// APIMigration is the migration of an API version which is no longer served by
+// the Kubernetes API server to its replacement.
+type APIMigration struct {
+	// From is the removed API version.
+	From schema.GroupVersionKind
+	// To is the replacement, empty if the API is removed without replacement.
+	To schema.GroupVersionKind
+	// RemovedIn is the Kubernetes minor version which stopped serving From,
+	// e.g. `1.22`.
+	RemovedIn string
+
+	// convert restructures the fields which differ between the two versions.
+	// It gets the object node, before apiVersion is changed.
+	convert func(obj *yaml.Node) error
+}
+
+// HasReplacement tells whether the removed API version has a replacement.
+func (m *APIMigration) HasReplacement() bool {
+	return !m.To.Empty()
+}
+
+func (m *APIMigration) String() string {
+	if !m.HasReplacement() {
+		return fmt.Sprintf("%v %v is removed in Kubernetes %v without replacement", m.From.GroupVersion(), m.From.Kind, m.RemovedIn)
+	}
+	return fmt.Sprintf("%v %v is removed in Kubernetes %v, use %v instead", m.From.GroupVersion(), m.From.Kind, m.RemovedIn, m.To.GroupVersion())
+}
+
+func gvk(apiVersion, kind string) schema.GroupVersionKind {
+	return schema.FromAPIVersionAndKind(apiVersion, kind)
+}
+
+// apiMigrations follows the Kubernetes deprecated API migration guide,
+// https://kubernetes.io/docs/reference/using-api/deprecation-guide/.
+var apiMigrations = []APIMigration{
+	// 1.16
+	{From: gvk("extensions/v1beta1", "Deployment"), To: gvk("apps/v1", "Deployment"), RemovedIn: "1.16", convert: convertExtensionsDeployment},
+	{From: gvk("extensions/v1beta1", "DaemonSet"), To: gvk("apps/v1", "DaemonSet"), RemovedIn: "1.16", convert: convertExtensionsDaemonSet},
+	{From: gvk("extensions/v1beta1", "ReplicaSet"), To: gvk("apps/v1", "ReplicaSet"), RemovedIn: "1.16", convert: defaultSelector},
+	{From: gvk("extensions/v1beta1", "NetworkPolicy"), To: gvk("networking.k8s.io/v1", "NetworkPolicy"), RemovedIn: "1.16"},
+	{From: gvk("extensions/v1beta1", "PodSecurityPolicy"), To: gvk("policy/v1beta1", "PodSecurityPolicy"), RemovedIn: "1.16"},
+	{From: gvk("apps/v1beta1", "Deployment"), To: gvk("apps/v1", "Deployment"), RemovedIn: "1.16", convert: convertAppsV1beta1Deployment},
+	{From: gvk("apps/v1beta1", "StatefulSet"), To: gvk("apps/v1", "StatefulSet"), RemovedIn: "1.16", convert: convertAppsV1beta1StatefulSet},
+	{From: gvk("apps/v1beta2", "Deployment"), To: gvk("apps/v1", "Deployment"), RemovedIn: "1.16", convert: defaultSelector},
+	{From: gvk("apps/v1beta2", "DaemonSet"), To: gvk("apps/v1", "DaemonSet"), RemovedIn: "1.16", convert: defaultSelector},
+	{From: gvk("apps/v1beta2", "ReplicaSet"), To: gvk("apps/v1", "ReplicaSet"), RemovedIn: "1.16", convert: defaultSelector},
+	{From: gvk("apps/v1beta2", "StatefulSet"), To: gvk("apps/v1", "StatefulSet"), RemovedIn: "1.16", convert: defaultSelector},
+
+	// 1.22
+	{From: gvk("admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration"), To: gvk("admissionregistration.k8s.io/v1", "MutatingWebhookConfiguration"), RemovedIn: "1.22", convert: convertWebhooks},
+	{From: gvk("admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration"), To: gvk("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration"), RemovedIn: "1.22", convert: convertWebhooks},
+	{From: gvk("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition"), To: gvk("apiextensions.k8s.io/v1", "CustomResourceDefinition"), RemovedIn: "1.22", convert: convertCRD},
+	{From: gvk("apiregistration.k8s.io/v1beta1", "APIService"), To: gvk("apiregistration.k8s.io/v1", "APIService"), RemovedIn: "1.22"},
+	{From: gvk("certificates.k8s.io/v1beta1", "CertificateSigningRequest"), To: gvk("certificates.k8s.io/v1", "CertificateSigningRequest"), RemovedIn: "1.22", convert: convertCSR},
+	{From: gvk("coordination.k8s.io/v1beta1", "Lease"), To: gvk("coordination.k8s.io/v1", "Lease"), RemovedIn: "1.22"},
+	{From: gvk("extensions/v1beta1", "Ingress"), To: gvk("networking.k8s.io/v1", "Ingress"), RemovedIn: "1.22", convert: convertIngress},
+	{From: gvk("networking.k8s.io/v1beta1", "Ingress"), To: gvk("networking.k8s.io/v1", "Ingress"), RemovedIn: "1.22", convert: convertIngress},
+	{From: gvk("networking.k8s.io/v1beta1", "IngressClass"), To: gvk("networking.k8s.io/v1", "IngressClass"), RemovedIn: "1.22"},
+	{From: gvk("rbac.authorization.k8s.io/v1beta1", "ClusterRole"), To: gvk("rbac.authorization.k8s.io/v1", "ClusterRole"), RemovedIn: "1.22"},
+	{From: gvk("rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding"), To: gvk("rbac.authorization.k8s.io/v1", "ClusterRoleBinding"), RemovedIn: "1.22"},
+	{From: gvk("rbac.authorization.k8s.io/v1beta1", "Role"), To: gvk("rbac.authorization.k8s.io/v1", "Role"), RemovedIn: "1.22"},
+	{From: gvk("rbac.authorization.k8s.io/v1beta1", "RoleBinding"), To: gvk("rbac.authorization.k8s.io/v1", "RoleBinding"), RemovedIn: "1.22"},
+	{From: gvk("scheduling.k8s.io/v1beta1", "PriorityClass"), To: gvk("scheduling.k8s.io/v1", "PriorityClass"), RemovedIn: "1.22"},
+	{From: gvk("storage.k8s.io/v1beta1", "CSIDriver"), To: gvk("storage.k8s.io/v1", "CSIDriver"), RemovedIn: "1.22"},
+	{From: gvk("storage.k8s.io/v1beta1", "CSINode"), To: gvk("storage.k8s.io/v1", "CSINode"), RemovedIn: "1.22"},
+	{From: gvk("storage.k8s.io/v1beta1", "StorageClass"), To: gvk("storage.k8s.io/v1", "StorageClass"), RemovedIn: "1.22"},
+	{From: gvk("storage.k8s.io/v1beta1", "VolumeAttachment"), To: gvk("storage.k8s.io/v1", "VolumeAttachment"), RemovedIn: "1.22"},
+
+	// 1.25
+	{From: gvk("autoscaling/v2beta1", "HorizontalPodAutoscaler"), To: gvk("autoscaling/v2", "HorizontalPodAutoscaler"), RemovedIn: "1.25", convert: convertHPAMetrics},
+	{From: gvk("batch/v1beta1", "CronJob"), To: gvk("batch/v1", "CronJob"), RemovedIn: "1.25"},
+	{From: gvk("discovery.k8s.io/v1beta1", "EndpointSlice"), To: gvk("discovery.k8s.io/v1", "EndpointSlice"), RemovedIn: "1.25", convert: convertEndpointSlice},
+	{From: gvk("events.k8s.io/v1beta1", "Event"), To: gvk("events.k8s.io/v1", "Event"), RemovedIn: "1.25"},
+	{From: gvk("node.k8s.io/v1beta1", "RuntimeClass"), To: gvk("node.k8s.io/v1", "RuntimeClass"), RemovedIn: "1.25"},
+	{From: gvk("policy/v1beta1", "PodDisruptionBudget"), To: gvk("policy/v1", "PodDisruptionBudget"), RemovedIn: "1.25", convert: convertPDB},
+	{From: gvk("policy/v1beta1", "PodSecurityPolicy"), RemovedIn: "1.25"},
+
+	// 1.26
+	{From: gvk("autoscaling/v2beta2", "HorizontalPodAutoscaler"), To: gvk("autoscaling/v2", "HorizontalPodAutoscaler"), RemovedIn: "1.26"},
+	{From: gvk("flowcontrol.apiserver.k8s.io/v1beta1", "FlowSchema"), To: gvk("flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema"), RemovedIn: "1.26"},
+	{From: gvk("flowcontrol.apiserver.k8s.io/v1beta1", "PriorityLevelConfiguration"), To: gvk("flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration"), RemovedIn: "1.26"},
+
+	// 1.27
+	{From: gvk("storage.k8s.io/v1beta1", "CSIStorageCapacity"), To: gvk("storage.k8s.io/v1", "CSIStorageCapacity"), RemovedIn: "1.27"},
+
+	// 1.29
+	{From: gvk("flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema"), To: gvk("flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema"), RemovedIn: "1.29"},
+	{From: gvk("flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration"), To: gvk("flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration"), RemovedIn: "1.29", convert: convertPriorityLevelShares},
+
+	// 1.32
+	{From: gvk("flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema"), To: gvk("flowcontrol.apiserver.k8s.io/v1", "FlowSchema"), RemovedIn: "1.32"},
+	{From: gvk("flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration"), To: gvk("flowcontrol.apiserver.k8s.io/v1", "PriorityLevelConfiguration"), RemovedIn: "1.32", convert: defaultPriorityLevelShares},
+}
+
+// parseMinorVersion returns the minor version of a Kubernetes 1.x version, e.g.
+// 22 for `v1.22.3`. An empty version is newer than all the known removals.
+func parseMinorVersion(version string) (int, error) {
+	if version == "" {
+		return math.MaxInt, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, fmt.Errorf("invalid Kubernetes version %q, expect a 1.x version, e.g. `1.25`", version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid Kubernetes version %q, expect a 1.x version, e.g. `1.25`", version)
+	}
+	return minor, nil
+}
+
+// FindAPIMigration returns the migration of the API version if it is no longer
+// served by the given Kubernetes version, e.g. `1.25`, or nil otherwise. An
+// empty kubernetesVersion means the latest Kubernetes version.
+func FindAPIMigration(gvk schema.GroupVersionKind, kubernetesVersion string) (*APIMigration, error) {
+	target, err := parseMinorVersion(kubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	for i := range apiMigrations {
+		m := &apiMigrations[i]
+		if m.From != gvk {
+			continue
+		}
+		// The removal versions are well-formed.
+		removedIn, _ := parseMinorVersion(m.RemovedIn)
+		if removedIn <= target {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// findAPIMigrations returns the migrations from the API version to the first
+// one served by the given Kubernetes version, e.g. extensions/v1beta1 to
+// networking.k8s.io/v1 through networking.k8s.io/v1beta1 for an Ingress. The
+// last migration has no replacement if the chain ends with a removed API.
+func findAPIMigrations(gvk schema.GroupVersionKind, kubernetesVersion string) ([]*APIMigration, error) {
+	var migrations []*APIMigration
+	for {
+		m, err := FindAPIMigration(gvk, kubernetesVersion)
+		if err != nil || m == nil {
+			return migrations, err
+		}
+		migrations = append(migrations, m)
+		if !m.HasReplacement() {
+			return migrations, nil
+		}
+		gvk = m.To
+	}
+}
+
+// describeAPIMigrations describes a chain of migrations, e.g. `extensions/v1beta1
+// PodSecurityPolicy is removed in Kubernetes 1.16, use policy/v1beta1 instead,
+// which is removed in Kubernetes 1.25 without replacement`.
+func describeAPIMigrations(migrations []*APIMigration) string {
+	msg := migrations[0].String()
+	for _, m := range migrations[1:] {
+		if m.HasReplacement() {
+			msg += fmt.Sprintf(", which is removed in Kubernetes %v, use %v instead", m.RemovedIn, m.To.GroupVersion())
+		} else {
+			msg += fmt.Sprintf(", which is removed in Kubernetes %v without replacement", m.RemovedIn)
+		}
+	}
+	return msg
+}
+
+// MigrateAPIVersion converts the KubeObject from an API version which is no
+// longer served by the given Kubernetes version, e.g. `1.25`, to its
+// replacement, following the migrations of several versions if needed, e.g.
+// extensions/v1beta1 to networking.k8s.io/v1 for an Ingress. An empty
+// kubernetesVersion means the latest Kubernetes version.
+//
+// The fields whose schema differs are restructured, e.g. the `serviceName` and
+// `servicePort` of an Ingress backend become `service.name` and
+// `service.port.number`, and the defaults which differ between the versions are
+// set explicitly, so that the behavior of the object does not change. The
+// comments are kept. The KubeObject is unchanged if it can't be migrated, e.g.
+// because its API is removed without replacement. It returns the changed
+// fields.
+func MigrateAPIVersion(obj *KubeObject, kubernetesVersion string) ([]FieldChange, error) {
+	migrations, err := findAPIMigrations(obj.GroupVersionKind(), kubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	migrated := obj.DeepCopy()
+	for _, m := range migrations {
+		if !m.HasReplacement() {
+			return nil, fmt.Errorf("unable to migrate %v: %v", obj.ShortString(), m)
+		}
+		if m.convert != nil {
+			if err := m.convert(migrated.obj.Node()); err != nil {
+				return nil, fmt.Errorf("unable to migrate %v to %v: %w", obj.ShortString(), m.To.GroupVersion(), err)
+			}
+		}
+		if err := migrated.SetAPIVersion(m.To.GroupVersion().String()); err != nil {
+			return nil, err
+		}
+	}
+	changes := Diff(obj, migrated)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	err = obj.writeUnlocked(nil, func(o *SubObject) error {
+		*o.obj.Node() = *migrated.obj.Node()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// APIVersionMigrator is a Runner which migrates the KubeObjects whose API
+// versions are no longer served by KubernetesVersion, see MigrateAPIVersion.
+// With ReportOnly, it only emits a Warning Result for each of them. It can be
+// configured with a functionConfig like
+//
+//	apiVersion: fn.kpt.dev/v1alpha1
+//	kind: APIVersionMigrator
+//	kubernetesVersion: "1.25"
+//	reportOnly: true
+type APIVersionMigrator struct {
+	// KubernetesVersion is the target Kubernetes version, e.g. `1.25`. The
+	// latest Kubernetes version if empty.
+	KubernetesVersion string `json:"kubernetesVersion,omitempty" yaml:"kubernetesVersion,omitempty"`
+	// ReportOnly reports the KubeObjects to migrate without changing them.
+	ReportOnly bool `json:"reportOnly,omitempty" yaml:"reportOnly,omitempty"`
+}
+
+var _ Runner = &APIVersionMigrator{}
+
+func (m *APIVersionMigrator) Run(_ *Context, _ *KubeObject, items KubeObjects, results *Results) bool {
+	if _, err := parseMinorVersion(m.KubernetesVersion); err != nil {
+		results.ErrorE(err)
+		return false
+	}
+	success := true
+	for _, obj := range items {
+		migrations, _ := findAPIMigrations(obj.GroupVersionKind(), m.KubernetesVersion)
+		if len(migrations) == 0 {
+			continue
+		}
+		if m.ReportOnly {
+			// Propose the final replacement, unless the chain ends with a
+			// removed API.
+			result := ConfigObjectResult(describeAPIMigrations(migrations), obj, Warning)
+			if last := migrations[len(migrations)-1]; last.HasReplacement() {
+				result.Field = &Field{Path: "apiVersion", CurrentValue: obj.GetAPIVersion(), ProposedValue: last.To.GroupVersion().String()}
+			}
+			*results = append(*results, result)
+			continue
+		}
+		apiVersion := obj.GetAPIVersion()
+		if _, err := MigrateAPIVersion(obj, m.KubernetesVersion); err != nil {
+			*results = append(*results, ConfigObjectResult(err.Error(), obj, Error))
+			success = false
+			continue
+		}
+		*results = append(*results, ConfigObjectResult(fmt.Sprintf("migrated from %v", apiVersion), obj, Info))
+	}
+	return success
+}
+
+// mappingValue returns the value of key in a mapping node, nil if not found.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// nestedMappingValue returns the value at the path of fields, nil if not found.
+func nestedMappingValue(m *yaml.Node, fields ...string) *yaml.Node {
+	for _, field := range fields {
+		m = mappingValue(m, field)
+	}
+	return m
+}
+
+// renameMappingKey renames key in a mapping node, keeping its position and
+// comments. It returns the value, nil if not found.
+func renameMappingKey(m *yaml.Node, key, newKey string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i].Value = newKey
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// removeMappingKey removes key from a mapping node and returns its value, nil
+// if not found.
+func removeMappingKey(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			value := m.Content[i+1]
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return value
+		}
+	}
+	return nil
+}
+
+// setMappingDefault sets key to value in a mapping node, unless it is set.
+func setMappingDefault(m *yaml.Node, key string, value *yaml.Node) {
+	if m != nil && m.Kind == yaml.MappingNode && mappingValue(m, key) == nil {
+		setMappingValue(m, key, value)
+	}
+}
+
+// sequenceElements returns the elements of a sequence node, nil if it is not a
+// sequence.
+func sequenceElements(s *yaml.Node) []*yaml.Node {
+	if s == nil || s.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return s.Content
+}
+
+func newMappingNode(keyValues ...*yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: yaml.NodeTagMap, Content: keyValues}
+}
+
+func newStringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagString, Value: value}
+}
+
+func newIntNode(value int) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagInt, Value: strconv.Itoa(value)}
+}
+
+// defaultSelector sets the `spec.selector` of a workload to the labels of its
+// Pod template, which the removed versions defaulted to but apps/v1 requires.
+func defaultSelector(obj *yaml.Node) error {
+	spec := mappingValue(obj, "spec")
+	if spec == nil || mappingValue(spec, "selector") != nil {
+		return nil
+	}
+	labels := nestedMappingValue(spec, "template", "metadata", "labels")
+	if labels == nil || len(labels.Content) == 0 {
+		return fmt.Errorf("spec.selector is required and can't be defaulted from the Pod template labels")
+	}
+	setMappingValue(spec, "selector", newMappingNode(newStringNode("matchLabels"), yaml.CopyYNode(labels)))
+	return nil
+}
+
+// setRollingUpdateDefaults sets the `maxSurge` and `maxUnavailable` of a
+// Deployment, unless it uses the Recreate strategy.
+func setRollingUpdateDefaults(spec *yaml.Node, maxSurge, maxUnavailable int) {
+	if spec == nil || spec.Kind != yaml.MappingNode {
+		return
+	}
+	setMappingDefault(spec, "strategy", newMappingNode())
+	strategy := mappingValue(spec, "strategy")
+	if t := mappingValue(strategy, "type"); t != nil && t.Value != "RollingUpdate" {
+		return
+	}
+	setMappingDefault(strategy, "rollingUpdate", newMappingNode())
+	rollingUpdate := mappingValue(strategy, "rollingUpdate")
+	setMappingDefault(rollingUpdate, "maxSurge", newIntNode(maxSurge))
+	setMappingDefault(rollingUpdate, "maxUnavailable", newIntNode(maxUnavailable))
+}
+
+// convertExtensionsDeployment sets the extensions/v1beta1 defaults which differ
+// in apps/v1: a rolling update of one Pod at a time, and neither a limit of the
+// revision history nor a progress deadline.
+func convertExtensionsDeployment(obj *yaml.Node) error {
+	spec := mappingValue(obj, "spec")
+	// The rollbacks are removed from apps/v1.
+	removeMappingKey(spec, "rollbackTo")
+	setRollingUpdateDefaults(spec, 1, 1)
+	setMappingDefault(spec, "revisionHistoryLimit", newIntNode(math.MaxInt32))
+	setMappingDefault(spec, "progressDeadlineSeconds", newIntNode(math.MaxInt32))
+	return defaultSelector(obj)
+}
+
+// convertAppsV1beta1Deployment sets the apps/v1beta1 revision history limit,
+// which is 10 in apps/v1.
+func convertAppsV1beta1Deployment(obj *yaml.Node) error {
+	spec := mappingValue(obj, "spec")
+	removeMappingKey(spec, "rollbackTo")
+	setMappingDefault(spec, "revisionHistoryLimit", newIntNode(2))
+	return defaultSelector(obj)
+}
+
+func convertExtensionsDaemonSet(obj *yaml.Node) error {
+	spec := mappingValue(obj, "spec")
+	removeMappingKey(spec, "templateGeneration")
+	// extensions/v1beta1 defaults to OnDelete, apps/v1 to RollingUpdate.
+	setMappingDefault(spec, "updateStrategy", newMappingNode(newStringNode("type"), newStringNode("OnDelete")))
+	return defaultSelector(obj)
+}
+
+func convertAppsV1beta1StatefulSet(obj *yaml.Node) error {
+	// apps/v1beta1 defaults to OnDelete, apps/v1 to RollingUpdate.
+	setMappingDefault(mappingValue(obj, "spec"), "updateStrategy", newMappingNode(newStringNode("type"), newStringNode("OnDelete")))
+	return defaultSelector(obj)
+}
+
+// convertWebhooks sets the admissionregistration.k8s.io/v1beta1 defaults which
+// changed in v1, and checks the sideEffects are allowed in v1.
+func convertWebhooks(obj *yaml.Node) error {
+	for i, webhook := range sequenceElements(mappingValue(obj, "webhooks")) {
+		if webhook.Kind != yaml.MappingNode {
+			continue
+		}
+		name := fmt.Sprintf("webhooks[%d]", i)
+		if n := mappingValue(webhook, "name"); n != nil && n.Value != "" {
+			name = n.Value
+		}
+		sideEffects := mappingValue(webhook, "sideEffects")
+		if sideEffects == nil || (sideEffects.Value != "None" && sideEffects.Value != "NoneOnDryRun") {
+			value := "Unknown"
+			if sideEffects != nil {
+				value = sideEffects.Value
+			}
+			return fmt.Errorf("webhook %q has sideEffects %v, which must be None or NoneOnDryRun", name, value)
+		}
+		setMappingDefault(webhook, "admissionReviewVersions", &yaml.Node{Kind: yaml.SequenceNode, Tag: yaml.NodeTagSeq, Content: []*yaml.Node{newStringNode("v1beta1")}})
+		setMappingDefault(webhook, "failurePolicy", newStringNode("Ignore"))
+		setMappingDefault(webhook, "matchPolicy", newStringNode("Exact"))
+		setMappingDefault(webhook, "timeoutSeconds", newIntNode(30))
+	}
+	return nil
+}
+
+// convertCRD rejects the apiextensions.k8s.io/v1beta1 CustomResourceDefinitions:
+// v1 requires structural schemas, which can't be derived automatically.
+func convertCRD(_ *yaml.Node) error {
+	return fmt.Errorf("the schemas of a CustomResourceDefinition must be migrated manually")
+}
+
+// convertCSR sets the certificates.k8s.io/v1beta1 default usages, which v1
+// requires. The default signerName of v1beta1 can't be requested in v1.
+func convertCSR(obj *yaml.Node) error {
+	spec := mappingValue(obj, "spec")
+	if mappingValue(spec, "signerName") == nil {
+		return fmt.Errorf("spec.signerName is required")
+	}
+	setMappingDefault(spec, "usages", &yaml.Node{Kind: yaml.SequenceNode, Tag: yaml.NodeTagSeq, Content: []*yaml.Node{
+		newStringNode("digital signature"), newStringNode("key encipherment"),
+	}})
+	return nil
+}
+
+// convertIngress renames `spec.backend` to `spec.defaultBackend`, converts the
+// service backends and defaults the pathType, which networking.k8s.io/v1
+// requires.
+func convertIngress(obj *yaml.Node) error {
+	spec := mappingValue(obj, "spec")
+	if backend := renameMappingKey(spec, "backend", "defaultBackend"); backend != nil {
+		convertIngressBackend(backend)
+	}
+	for _, rule := range sequenceElements(mappingValue(spec, "rules")) {
+		for _, path := range sequenceElements(nestedMappingValue(rule, "http", "paths")) {
+			setMappingDefault(path, "pathType", newStringNode("ImplementationSpecific"))
+			if backend := mappingValue(path, "backend"); backend != nil {
+				convertIngressBackend(backend)
+			}
+		}
+	}
+	return nil
+}
+
+// convertIngressBackend converts `serviceName` and `servicePort` to `service`.
+func convertIngressBackend(backend *yaml.Node) {
+	for i := 0; i+1 < len(backend.Content); i += 2 {
+		if backend.Content[i].Value != "serviceName" {
+			continue
+		}
+		service := newMappingNode(newStringNode("name"), backend.Content[i+1])
+		backend.Content[i].Value = "service"
+		backend.Content[i+1] = service
+		if port := removeMappingKey(backend, "servicePort"); port != nil {
+			key := "name"
+			if port.Tag == yaml.NodeTagInt {
+				key = "number"
+			}
+			setMappingValue(service, "port", newMappingNode(newStringNode(key), port))
+		}
+		return
+	}
+}
+
+// convertHPAMetrics converts the autoscaling/v2beta1 metric targets to the
+// MetricTarget of autoscaling/v2.
+func convertHPAMetrics(obj *yaml.Node) error {
+	for _, metric := range sequenceElements(nestedMappingValue(obj, "spec", "metrics")) {
+		if source := mappingValue(metric, "resource"); source != nil {
+			convertMetricTarget(source)
+		}
+		if source := mappingValue(metric, "pods"); source != nil {
+			convertMetricIdentifier(source, "selector")
+			convertMetricTarget(source)
+		}
+		if source := mappingValue(metric, "object"); source != nil {
+			renameMappingKey(source, "target", "describedObject")
+			convertMetricIdentifier(source, "selector")
+			convertMetricTarget(source)
+		}
+		if source := mappingValue(metric, "external"); source != nil {
+			convertMetricIdentifier(source, "metricSelector")
+			convertMetricTarget(source)
+		}
+	}
+	return nil
+}
+
+// convertMetricIdentifier moves `metricName` and the selector to `metric`.
+func convertMetricIdentifier(source *yaml.Node, selectorKey string) {
+	name := removeMappingKey(source, "metricName")
+	if name == nil {
+		return
+	}
+	metric := newMappingNode(newStringNode("name"), name)
+	if selector := removeMappingKey(source, selectorKey); selector != nil {
+		setMappingValue(metric, "selector", selector)
+	}
+	setMappingValue(source, "metric", metric)
+}
+
+// convertMetricTarget moves the target values to `target`.
+func convertMetricTarget(source *yaml.Node) {
+	targets := []struct{ from, targetType, to string }{
+		{"targetAverageUtilization", "Utilization", "averageUtilization"},
+		{"targetAverageValue", "AverageValue", "averageValue"},
+		{"averageValue", "AverageValue", "averageValue"},
+		{"targetValue", "Value", "value"},
+	}
+	for _, t := range targets {
+		if value := removeMappingKey(source, t.from); value != nil {
+			setMappingValue(source, "target", newMappingNode(
+				newStringNode("type"), newStringNode(t.targetType),
+				newStringNode(t.to), value))
+			return
+		}
+	}
+}
+
+// convertEndpointSlice moves the `kubernetes.io/hostname` topology of the
+// endpoints to `nodeName`, and renames `topology` to `deprecatedTopology`.
+func convertEndpointSlice(obj *yaml.Node) error {
+	for _, endpoint := range sequenceElements(mappingValue(obj, "endpoints")) {
+		topology := renameMappingKey(endpoint, "topology", "deprecatedTopology")
+		if topology == nil {
+			continue
+		}
+		if hostname := removeMappingKey(topology, "kubernetes.io/hostname"); hostname != nil {
+			setMappingDefault(endpoint, "nodeName", hostname)
+		}
+		if len(topology.Content) == 0 {
+			removeMappingKey(endpoint, "deprecatedTopology")
+		}
+	}
+	return nil
+}
+
+// convertPDB rejects the empty selectors, which select no Pod in policy/v1beta1
+// but all the Pods of the namespace in policy/v1.
+func convertPDB(obj *yaml.Node) error {
+	if selector := nestedMappingValue(obj, "spec", "selector"); selector != nil && len(selector.Content) == 0 {
+		return fmt.Errorf("the empty spec.selector selects all the Pods in policy/v1 instead of none")
+	}
+	return nil
+}
+
+// convertPriorityLevelShares renames the `assuredConcurrencyShares` of a
+// limited priority level to `nominalConcurrencyShares`.
+func convertPriorityLevelShares(obj *yaml.Node) error {
+	renameMappingKey(nestedMappingValue(obj, "spec", "limited"), "assuredConcurrencyShares", "nominalConcurrencyShares")
+	return nil
+}
+
+// defaultPriorityLevelShares sets the zero `nominalConcurrencyShares` to 30,
+// which flowcontrol.apiserver.k8s.io/v1beta3 defaults it to but v1 keeps as
+// zero.
+func defaultPriorityLevelShares(obj *yaml.Node) error {
+	if shares := nestedMappingValue(obj, "spec", "limited", "nominalConcurrencyShares"); shares != nil && shares.Value == "0" {
+		shares.Value = "30"
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateAPIVersion(t *testing.T) {
+	testcases := map[string]struct {
+		input             string
+		kubernetesVersion string
+		expected          string
+		expectedErr       string
+	}{
+		"ingress": {
+			input: `apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: web
+spec:
+  backend:
+    serviceName: default # the fallback
+    servicePort: 80
+  rules:
+  - host: example.com
+    http:
+      paths:
+      - path: /
+        backend:
+          serviceName: web
+          servicePort: http
+`,
+			expected: `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+spec:
+  defaultBackend:
+    service:
+      name: default # the fallback
+      port:
+        number: 80
+  rules:
+  - host: example.com
+    http:
+      paths:
+      - path: /
+        backend:
+          service:
+            name: web
+            port:
+              name: http
+        pathType: ImplementationSpecific
+`,
+		},
+		"daemonset defaults": {
+			input: `apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: agent
+spec:
+  templateGeneration: 2
+  template:
+    metadata:
+      labels:
+        app: agent
+`,
+			expected: `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+spec:
+  template:
+    metadata:
+      labels:
+        app: agent
+  updateStrategy:
+    type: OnDelete
+  selector:
+    matchLabels:
+      app: agent
+`,
+		},
+		"extensions deployment defaults": {
+			input: `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  rollbackTo:
+    revision: 1
+  template:
+    metadata:
+      labels:
+        app: web
+`,
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+  strategy:
+    rollingUpdate:
+      maxSurge: 1
+      maxUnavailable: 1
+  revisionHistoryLimit: 2147483647
+  progressDeadlineSeconds: 2147483647
+  selector:
+    matchLabels:
+      app: web
+`,
+		},
+		"recreate deployment": {
+			input: `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  strategy:
+    type: Recreate
+  revisionHistoryLimit: 5
+  selector:
+    matchLabels:
+      app: web
+`,
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  strategy:
+    type: Recreate
+  revisionHistoryLimit: 5
+  selector:
+    matchLabels:
+      app: web
+  progressDeadlineSeconds: 2147483647
+`,
+		},
+		"apps deployment defaults": {
+			input: `apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+`,
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  revisionHistoryLimit: 2
+`,
+		},
+		"priority level shares": {
+			input: `apiVersion: flowcontrol.apiserver.k8s.io/v1beta1
+kind: PriorityLevelConfiguration
+metadata:
+  name: batch
+spec:
+  type: Limited
+  limited:
+    assuredConcurrencyShares: 0
+`,
+			expected: `apiVersion: flowcontrol.apiserver.k8s.io/v1
+kind: PriorityLevelConfiguration
+metadata:
+  name: batch
+spec:
+  type: Limited
+  limited:
+    nominalConcurrencyShares: 30
+`,
+		},
+		"priority level still served": {
+			input: `apiVersion: flowcontrol.apiserver.k8s.io/v1beta2
+kind: PriorityLevelConfiguration
+metadata:
+  name: batch
+spec:
+  type: Limited
+  limited:
+    assuredConcurrencyShares: 0
+`,
+			kubernetesVersion: "1.29",
+			expected: `apiVersion: flowcontrol.apiserver.k8s.io/v1beta3
+kind: PriorityLevelConfiguration
+metadata:
+  name: batch
+spec:
+  type: Limited
+  limited:
+    nominalConcurrencyShares: 0
+`,
+		},
+		"hpa metrics": {
+			input: `apiVersion: autoscaling/v2beta1
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  metrics:
+  - type: Resource
+    resource:
+      name: cpu
+      targetAverageUtilization: 80
+  - type: External
+    external:
+      metricName: queue_length
+      metricSelector:
+        matchLabels:
+          queue: jobs
+      targetValue: 30
+`,
+			expected: `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  metrics:
+  - type: Resource
+    resource:
+      name: cpu
+      target:
+        type: Utilization
+        averageUtilization: 80
+  - type: External
+    external:
+      metric:
+        name: queue_length
+        selector:
+          matchLabels:
+            queue: jobs
+      target:
+        type: Value
+        value: 30
+`,
+		},
+		"same schema": {
+			input: `apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+`,
+			expected: `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+`,
+		},
+		"still served": {
+			input: `apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+`,
+			kubernetesVersion: "1.24",
+			expected: `apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+`,
+		},
+		"several versions": {
+			input: `apiVersion: extensions/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: restricted
+`,
+			kubernetesVersion: "v1.22.3",
+			expected: `apiVersion: policy/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: restricted
+`,
+		},
+		"no replacement": {
+			input: `apiVersion: extensions/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: restricted
+`,
+			expectedErr: "unable to migrate Resource(apiVersion=extensions/v1beta1, kind=PodSecurityPolicy, namespace=, name=restricted): policy/v1beta1 PodSecurityPolicy is removed in Kubernetes 1.25 without replacement",
+		},
+		"empty pdb selector": {
+			input: `apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: web
+spec:
+  selector: {}
+`,
+			expectedErr: "unable to migrate Resource(apiVersion=policy/v1beta1, kind=PodDisruptionBudget, namespace=, name=web) to policy/v1: the empty spec.selector selects all the Pods in policy/v1 instead of none",
+		},
+		"webhook side effects": {
+			input: `apiVersion: admissionregistration.k8s.io/v1beta1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: policy
+webhooks:
+- name: policy.example.com
+`,
+			expectedErr: `webhook "policy.example.com" has sideEffects Unknown, which must be None or NoneOnDryRun`,
+		},
+		"webhook without name": {
+			input: `apiVersion: admissionregistration.k8s.io/v1beta1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: policy
+webhooks:
+- not a webhook
+- {}
+`,
+			expectedErr: `webhook "webhooks[1]" has sideEffects Unknown, which must be None or NoneOnDryRun`,
+		},
+		"invalid version": {
+			input: `apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+`,
+			kubernetesVersion: "latest",
+			expectedErr:       `invalid Kubernetes version "latest"`,
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			obj, err := ParseKubeObject([]byte(tc.input))
+			require.NoError(t, err)
+			_, err = MigrateAPIVersion(obj, tc.kubernetesVersion)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				assert.Equal(t, tc.input, obj.String())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, obj.String())
+		})
+	}
+}
+
+func TestAPIVersionMigrator(t *testing.T) {
+	items, err := ParseKubeObjects([]byte(`apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`))
+	require.NoError(t, err)
+
+	results := new(Results)
+	migrator := &APIVersionMigrator{KubernetesVersion: "1.25", ReportOnly: true}
+	assert.True(t, migrator.Run(nil, nil, items, results))
+	require.Len(t, *results, 1)
+	assert.Equal(t, "[warning] batch/v1beta1/CronJob/backup apiVersion: batch/v1beta1 CronJob is removed in Kubernetes 1.25, use batch/v1 instead", (*results)[0].String())
+	assert.Equal(t, "batch/v1beta1", items[0].GetAPIVersion())
+
+	results = new(Results)
+	migrator.ReportOnly = false
+	assert.True(t, migrator.Run(nil, nil, items, results))
+	require.Len(t, *results, 1)
+	assert.Equal(t, "[info] batch/v1/CronJob/backup: migrated from batch/v1beta1", (*results)[0].String())
+	assert.Equal(t, "batch/v1", items[0].GetAPIVersion())
+}
+
+func TestAPIVersionMigratorReportChain(t *testing.T) {
+	items, err := ParseKubeObjects([]byte(`apiVersion: extensions/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: restricted
+---
+apiVersion: flowcontrol.apiserver.k8s.io/v1beta1
+kind: FlowSchema
+metadata:
+  name: batch
+`))
+	require.NoError(t, err)
+
+	results := new(Results)
+	migrator := &APIVersionMigrator{ReportOnly: true}
+	assert.True(t, migrator.Run(nil, nil, items, results))
+	require.Len(t, *results, 2)
+	assert.Equal(t, "[warning] extensions/v1beta1/PodSecurityPolicy/restricted: extensions/v1beta1 PodSecurityPolicy is removed in Kubernetes 1.16, use policy/v1beta1 instead, which is removed in Kubernetes 1.25 without replacement", (*results)[0].String())
+	assert.Nil(t, (*results)[0].Field)
+	assert.Equal(t, "flowcontrol.apiserver.k8s.io/v1", (*results)[1].Field.ProposedValue)
+}
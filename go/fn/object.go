@@ -31,21 +31,47 @@ import (
 // KubeObject presents a k8s object.
 type KubeObject struct {
 	SubObject
+	// scopes resolves the namespace scope of the KubeObject. nil means only
+	// the built-in kinds are known.
+	scopes *ScopeResolver
+	// locks are the FieldLocks enforced by the setters. nil means the
+	// DefaultFieldLocks.
+	locks []FieldLock
 }
 
-// ParseKubeObjects parses input byte slice to multiple KubeObjects.
+// ParseKubeObjects parses input byte slice to multiple KubeObjects, with the
+// default ParseOptions.
 func ParseKubeObjects(in []byte) ([]*KubeObject, error) {
+	return ParseKubeObjectsWithOptions(in, ParseOptions{})
+}
+
+// ParseKubeObjectsWithOptions parses input byte slice to multiple KubeObjects.
+// It returns an ErrUnsafeInput if the input is rejected by the ParseOptions.
+func ParseKubeObjectsWithOptions(in []byte, opts ParseOptions) ([]*KubeObject, error) {
+	if err := opts.checkSize(in); err != nil {
+		return nil, fmt.Errorf("failed to parse input bytes: %w", err)
+	}
 	doc, err := internal.ParseDoc(in)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse input bytes: %w", err)
 	}
+	if err := opts.checkItems(len(doc.Nodes())); err != nil {
+		return nil, fmt.Errorf("failed to parse input bytes: %w", err)
+	}
+	if err := opts.checkNodes(doc.Nodes()); err != nil {
+		return nil, fmt.Errorf("failed to parse input bytes: %w", err)
+	}
 	objects, err := doc.Elements()
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract objects: %w", err)
 	}
+	// The aliases of an object can refer to the anchors of the previous ones.
+	aliases := internal.NewAliases(false, doc.Nodes()...)
 	var kubeObjects []*KubeObject
 	for _, obj := range objects {
-		kubeObjects = append(kubeObjects, asKubeObject(obj))
+		obj.SetAliases(aliases)
+		kubeObject := asKubeObject(obj)
+		kubeObjects = append(kubeObjects, kubeObject)
 	}
 	return kubeObjects, nil
 }
@@ -145,8 +171,13 @@ func (o *SubObject) NestedSlice(fields ...string) (SliceSubObjects, bool, error)
 		return nil, found, err
 	}
 	var val []*SubObject
-	for _, obj := range objects {
-		val = append(val, &SubObject{obj: obj})
+	for i, obj := range objects {
+		val = append(val, &SubObject{
+			obj:       obj,
+			parentGVK: o.parentGVK,
+			fieldpath: fmt.Sprintf("%s%s[%d]", o.fieldpath, fieldPathKeys(fields...), i),
+			root:      o.rootNode(),
+		})
 	}
 	return val, true, nil
 }
@@ -166,7 +197,8 @@ func (o *SubObject) NestedSubObject(fields ...string) (SubObject, bool, error) {
 	rn.SetYNode(m.Node())
 	variant.obj = internal.NewMap(rn.YNode())
 	variant.parentGVK = o.parentGVK
-	variant.fieldpath = o.fieldpath + "." + strings.Join(fields, ".")
+	variant.fieldpath = o.fieldpath + fieldPathKeys(fields...)
+	variant.root = o.rootNode()
 	return variant, true, nil
 }
 
@@ -181,7 +213,7 @@ func (o *SubObject) NestedResource(ptr interface{}, fields ...string) (bool, err
 	}
 	m, found, err := o.obj.GetNestedMap(fields...)
 	if err != nil {
-		o.fieldpath = o.fieldpath + "." + strings.Join(fields, ".")
+		o.fieldpath = o.fieldpath + fieldPathKeys(fields...)
 		return found, NewErrUnmatchedField(*o, fields, ptr)
 	}
 	if !found {
@@ -222,34 +254,26 @@ func (o *SubObject) NestedStringSlice(fields ...string) ([]string, bool, error)
 // RemoveNestedField removes the field located by fields if found. It returns if the field
 // is found and a potential error.
 func (o *SubObject) RemoveNestedField(fields ...string) (bool, error) {
-	found, err := func() (bool, error) {
+	found := false
+	err := o.writeUnlocked(fieldSegments(fields...), func(o *SubObject) error {
 		if o == nil {
-			return false, fmt.Errorf("the object doesn't exist")
+			return fmt.Errorf("the object doesn't exist")
 		}
-		return o.obj.RemoveNestedField(fields...)
-	}()
+		var err error
+		found, err = o.obj.RemoveNestedField(fields...)
+		return err
+	})
 	if err != nil {
 		return found, fmt.Errorf("unable to remove fields %v with error: %w", fields, err)
 	}
 	return found, nil
 }
 
-// onLockedFields locks the SubObject fields which are expected for kpt internal use only.
-func (o *SubObject) onLockedFields(val interface{}, fields ...string) error {
-	if o.hasUpstreamIdentifier(val, fields...) {
-		return ErrAttemptToTouchUpstreamIdentifier{}
-	}
-	return nil
-}
-
 // SetNestedField sets a nested field located by fields to the value provided as val. val
 // should not be a yaml.RNode. If you want to deal with yaml.RNode, you should
 // use Get method and modify the underlying yaml.Node.
 func (o *SubObject) SetNestedField(val interface{}, fields ...string) error {
-	if err := o.onLockedFields(val, fields...); err != nil {
-		return err
-	}
-	err := func() error {
+	err := o.writeUnlocked(fieldSegments(fields...), func(o *SubObject) error {
 		if val == nil {
 			return fmt.Errorf("the passed-in object must not be nil")
 		}
@@ -259,10 +283,14 @@ func (o *SubObject) SetNestedField(val interface{}, fields ...string) error {
 		if o.obj == nil {
 			o.obj = internal.NewMap(nil)
 		}
-		kind := reflect.ValueOf(val).Kind()
-		if kind == reflect.Ptr {
-			kind = reflect.TypeOf(val).Elem().Kind()
+		rv := reflect.ValueOf(val)
+		if rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return fmt.Errorf("the passed-in object must not be nil")
+			}
+			rv = rv.Elem()
 		}
+		kind := rv.Kind()
 
 		switch kind {
 		case reflect.Struct, reflect.Map:
@@ -277,50 +305,29 @@ func (o *SubObject) SetNestedField(val interface{}, fields ...string) error {
 				return err
 			}
 			return o.obj.SetNestedSlice(s, fields...)
+		// The scalar values are read through reflect so that custom types like
+		// `type Protocol string` are handled the same as their underlying types.
 		case reflect.String:
-			var s string
-			switch val := val.(type) {
-			case string:
-				s = val
-			case *string:
-				s = *val
-			}
-			return o.obj.SetNestedString(s, fields...)
-		case reflect.Int, reflect.Int64:
-			var i int
-			switch val := val.(type) {
-			case int:
-				i = val
-			case *int:
-				i = *val
-			case int64:
-				i = int(val)
-			case *int64:
-				i = int(*val)
+			return o.obj.SetNestedString(rv.String(), fields...)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return o.obj.SetNestedInt(int(rv.Int()), fields...)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if rv.Uint() > math.MaxInt {
+				return fmt.Errorf("%d overflows int", rv.Uint())
 			}
-			return o.obj.SetNestedInt(i, fields...)
-		case reflect.Float64:
-			var f float64
-			switch val := val.(type) {
-			case float64:
-				f = val
-			case *float64:
-				f = *val
-			}
-			return o.obj.SetNestedFloat(f, fields...)
+			return o.obj.SetNestedInt(int(rv.Uint()), fields...)
+		case reflect.Float32, reflect.Float64:
+			return o.obj.SetNestedFloat(rv.Float(), fields...)
 		case reflect.Bool:
-			var b bool
-			switch val := val.(type) {
-			case bool:
-				b = val
-			case *bool:
-				b = *val
-			}
-			return o.obj.SetNestedBool(b, fields...)
+			return o.obj.SetNestedBool(rv.Bool(), fields...)
 		default:
 			return fmt.Errorf("unhandled kind %s", kind)
 		}
-	}()
+	})
+	if _, ok := err.(ErrAttemptToTouchUpstreamIdentifier); ok {
+		// It has always been returned as is.
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("unable to set %v at fields %v with error: %w", val, fields, err)
 	}
@@ -352,50 +359,109 @@ func (o *SubObject) SetNestedStringSlice(value []string, fields ...string) error
 	return o.SetNestedField(value, fields...)
 }
 
+// fieldNodes returns the key and the value nodes of the field located by fields.
+// If no fields are given, it returns the SubObject's own node and a nil key.
+func (o *SubObject) fieldNodes(fields ...string) (*yaml.Node, *yaml.Node, bool, error) {
+	if len(fields) == 0 {
+		return nil, o.obj.Node(), true, nil
+	}
+	parent := o.obj
+	if len(fields) > 1 {
+		m, found, err := o.obj.GetNestedMap(fields[:len(fields)-1]...)
+		if !found || err != nil {
+			return nil, nil, found, err
+		}
+		parent = m
+	}
+	content := parent.Node().Content
+	for i := 0; i+1 < len(content); i += 2 {
+		if content[i].Value == fields[len(fields)-1] {
+			return content[i], content[i+1], true, nil
+		}
+	}
+	return nil, nil, false, nil
+}
+
 // LineComment returns the line comment, if the target field exist and a
-// potential error.
-func (o *KubeObject) LineComment(fields ...string) (string, bool, error) {
-	rn, found, err := o.obj.GetRNode(fields...)
+// potential error. If no fields are given, it returns the line comment of the
+// SubObject itself, e.g. a sequence element visited by Walk. For a field whose
+// value is a block map or sequence, the comment is on the field key, e.g.
+//
+//	args: # kpt-set: ${args}
+//	- a
+func (o *SubObject) LineComment(fields ...string) (string, bool, error) {
+	key, value, found, err := o.fieldNodes(fields...)
 	if !found || err != nil {
 		return "", found, err
 	}
-	return rn.YNode().LineComment, true, nil
+	return lineCommentNode(key, value).LineComment, true, nil
 }
 
 // HeadComment returns the head comment, if the target field exist and a
-// potential error.
-func (o *KubeObject) HeadComment(fields ...string) (string, bool, error) {
-	rn, found, err := o.obj.GetRNode(fields...)
+// potential error. If no fields are given, it returns the head comment of the
+// SubObject itself.
+func (o *SubObject) HeadComment(fields ...string) (string, bool, error) {
+	key, value, found, err := o.fieldNodes(fields...)
 	if !found || err != nil {
 		return "", found, err
 	}
-	return rn.YNode().HeadComment, true, nil
+	return headCommentNode(key, value).HeadComment, true, nil
 }
 
-func (o *KubeObject) SetLineComment(comment string, fields ...string) error {
-	rn, found, err := o.obj.GetRNode(fields...)
+// SetLineComment sets the line comment of the target field, on the node
+// LineComment reads it from.
+func (o *SubObject) SetLineComment(comment string, fields ...string) error {
+	key, value, found, err := o.fieldNodes(fields...)
 	if err != nil {
 		return err
 	}
 	if !found {
 		return fmt.Errorf("can't set line comment because the field doesn't exist")
 	}
-	rn.YNode().LineComment = comment
+	lineCommentNode(key, value).LineComment = comment
 	return nil
 }
 
-func (o *KubeObject) SetHeadComment(comment string, fields ...string) error {
-	rn, found, err := o.obj.GetRNode(fields...)
+// SetHeadComment sets the head comment of the target field, on the node
+// HeadComment reads it from.
+func (o *SubObject) SetHeadComment(comment string, fields ...string) error {
+	key, value, found, err := o.fieldNodes(fields...)
 	if err != nil {
 		return err
 	}
 	if !found {
 		return fmt.Errorf("can't set head comment because the field doesn't exist")
 	}
-	rn.YNode().HeadComment = comment
+	headCommentNode(key, value).HeadComment = comment
 	return nil
 }
 
+// lineCommentNode returns the node holding the line comment of a field: the
+// one which has it already, otherwise the one the YAML encoder writes it for,
+// i.e. the key for a block map or sequence and the value otherwise.
+func lineCommentNode(key, value *yaml.Node) *yaml.Node {
+	switch {
+	case key == nil || value.LineComment != "":
+		return value
+	case key.LineComment != "":
+		return key
+	case (value.Kind == yaml.MappingNode || value.Kind == yaml.SequenceNode) && value.Style&yaml.FlowStyle == 0:
+		return key
+	default:
+		return value
+	}
+}
+
+// headCommentNode returns the node holding the head comment of a field: the
+// one which has it already, otherwise the key, which the YAML encoder writes
+// it for.
+func headCommentNode(key, value *yaml.Node) *yaml.Node {
+	if key == nil || value.HeadComment != "" {
+		return value
+	}
+	return key
+}
+
 // As converts a KubeObject to the desired typed object. ptr must be
 // a pointer to a typed object.
 func (o *SubObject) As(ptr interface{}) error {
@@ -435,8 +501,21 @@ func NewFromTypedObject(v interface{}) (*KubeObject, error) {
 	return asKubeObject(m), nil
 }
 
-// String serializes the object in yaml format.
+// String returns the YAML representation of the SubObject. The Secret values
+// are redacted if EnableSecretRedaction is on.
 func (o *SubObject) String() string {
+	node := o.obj.Node()
+	if secretRedactionEnabled() {
+		node = o.redactedNode()
+	}
+	doc := internal.NewDoc([]*yaml.Node{node}...)
+	s, _ := doc.ToYAML()
+	return string(s)
+}
+
+// yamlString returns the YAML representation of the SubObject, without
+// redaction.
+func (o *SubObject) yamlString() string {
 	doc := internal.NewDoc([]*yaml.Node{o.obj.Node()}...)
 	s, _ := doc.ToYAML()
 	return string(s)
@@ -530,7 +609,7 @@ func (o *KubeObject) GetAPIVersion() string {
 }
 
 func (o *KubeObject) SetAPIVersion(apiVersion string) error {
-	return o.obj.SetNestedString(apiVersion, "apiVersion")
+	return o.SetNestedField(apiVersion, "apiVersion")
 }
 
 func (o *KubeObject) GetKind() string {
@@ -556,15 +635,17 @@ func (o *KubeObject) GetNamespace() string {
 	return s
 }
 
-// IsNamespaceScoped tells whether a k8s resource is namespace scoped. If the KubeObject resource is a customized, it
-// determines the namespace scope by checking whether `metadata.namespace` is set.
+// IsNamespaceScoped tells whether a k8s resource is namespace scoped. If the scope of the KubeObject kind is unknown
+// (see Scope), it determines the namespace scope by checking whether `metadata.namespace` is set.
 func (o *KubeObject) IsNamespaceScoped() bool {
-	tm := yaml.TypeMeta{Kind: o.GetKind(), APIVersion: o.GetAPIVersion()}
-	if nsScoped, ok := internal.PrecomputedIsNamespaceScoped[tm]; ok {
-		return nsScoped
+	switch o.Scope() {
+	case NamespaceScoped:
+		return true
+	case ClusterScoped:
+		return false
+	default:
+		return o.HasNamespace()
 	}
-	// TODO(yuwenma): parse the resource openapi schema to know its scope status.
-	return o.HasNamespace()
 }
 
 // IsClusterScoped tells whether a resource is cluster scoped.
@@ -587,7 +668,7 @@ func (o *KubeObject) SetAnnotation(k, v string) error {
 		return ErrAttemptToTouchUpstreamIdentifier{}
 	}
 	if err := o.SetNestedField(v, "metadata", "annotations", k); err != nil {
-		return fmt.Errorf("cannot set metadata annotations '%v': %v", k, err)
+		return fmt.Errorf("cannot set metadata annotations '%v': %w", k, err)
 	}
 	return nil
 }
@@ -623,7 +704,7 @@ func (o *KubeObject) RemoveAnnotationsIfEmpty() error {
 		return err
 	}
 	if found && len(annotations) == 0 {
-		_, err = o.obj.RemoveNestedField("metadata", "annotations")
+		_, err = o.RemoveNestedField("metadata", "annotations")
 		return err
 	}
 	return nil
@@ -703,6 +784,18 @@ func (o KubeObjects) String() string {
 	return strings.Join(elems, "\n---\n")
 }
 
+// DeepCopy returns a copy of the KubeObjects where every KubeObject is deep copied.
+func (o KubeObjects) DeepCopy() KubeObjects {
+	if o == nil {
+		return nil
+	}
+	copied := make(KubeObjects, 0, len(o))
+	for _, obj := range o {
+		copied = append(copied, obj.DeepCopy())
+	}
+	return copied
+}
+
 // Where will return the subset of objects in KubeObjects such that f(object) returns 'true'.
 func (o KubeObjects) Where(f func(*KubeObject) bool) KubeObjects {
 	var result KubeObjects
@@ -750,8 +843,13 @@ func IsGroupKind(gk schema.GroupKind) func(*KubeObject) bool {
 }
 
 // GetRootKptfile returns the root Kptfile. Nested kpt packages can have multiple Kptfile files of the same GVKNN.
+// Use KubeObjectIndex.GetRootKptfile for repeated lookups in large packages.
 func (o KubeObjects) GetRootKptfile() *KubeObject {
-	kptfiles := o.Where(IsGVK(v1.KptFileGroup, v1.KptFileVersion, v1.KptFileKind))
+	return rootKptfile(o.Where(IsGVK(v1.KptFileGroup, v1.KptFileVersion, v1.KptFileKind)))
+}
+
+// rootKptfile returns the Kptfile with the shortest path.
+func rootKptfile(kptfiles KubeObjects) *KubeObject {
 	if len(kptfiles) == 0 {
 		return nil
 	}
@@ -806,9 +904,32 @@ func (o *KubeObject) IsEmpty() bool {
 	return yaml.IsYNodeEmptyMap(o.obj.Node())
 }
 
+// DeepCopy returns a copy of the KubeObject. The whole YAML tree is copied,
+// including the comments and the internal annotations, so changes to the copy
+// do not affect the original.
+func (o *KubeObject) DeepCopy() *KubeObject {
+	if o == nil {
+		return nil
+	}
+	copied := newKubeObject(*o.SubObject.DeepCopy())
+	copied.scopes = o.scopes
+	copied.locks = o.locks
+	return copied
+}
+
 func NewEmptyKubeObject() *KubeObject {
 	subObject := SubObject{parentGVK: schema.GroupVersionKind{}, obj: internal.NewMap(nil), fieldpath: ""}
-	return &KubeObject{subObject}
+	return newKubeObject(subObject)
+}
+
+// newKubeObject returns the KubeObject of the SubObject, which its SubObjects
+// can find from their root node, see rootObject.
+func newKubeObject(o SubObject) *KubeObject {
+	obj := &KubeObject{SubObject: o}
+	if o.obj != nil {
+		o.obj.SetOwner(obj)
+	}
+	return obj
 }
 
 func asKubeObject(mapVariant *internal.MapVariant) *KubeObject {
@@ -816,7 +937,7 @@ func asKubeObject(mapVariant *internal.MapVariant) *KubeObject {
 	version, _, _ := mapVariant.GetNestedString("version")
 	kind, _, _ := mapVariant.GetNestedString("kind")
 	gvk := schema.GroupVersionKind{Group: group, Version: version, Kind: kind}
-	return &KubeObject{SubObject{parentGVK: gvk, obj: mapVariant, fieldpath: ""}}
+	return newKubeObject(SubObject{parentGVK: gvk, obj: mapVariant, fieldpath: ""})
 }
 
 func (o *KubeObject) node() *internal.MapVariant {
@@ -833,11 +954,37 @@ type SubObject struct {
 	parentGVK schema.GroupVersionKind
 	fieldpath string
 	obj       *internal.MapVariant
+	// root is the KubeObject holding the SubObject. It is nil for a KubeObject.
+	root *internal.MapVariant
+}
+
+// DeepCopy returns a copy of the SubObject which does not share any YAML node
+// with the original.
+func (o *SubObject) DeepCopy() *SubObject {
+	if o == nil {
+		return nil
+	}
+	var obj *internal.MapVariant
+	if o.obj != nil {
+		obj = o.obj.DeepCopy()
+	}
+	return &SubObject{parentGVK: o.parentGVK, fieldpath: o.fieldpath, obj: obj}
 }
 
+// UpsertMap returns the map of the field k, which is created, or replaces a
+// value which is not a map. If the field is locked (see FieldLock), it is left
+// unchanged and the returned SubObject is a new map detached from the
+// KubeObject.
 func (o *SubObject) UpsertMap(k string) *SubObject {
-	m := o.obj.UpsertMap(k)
-	return &SubObject{obj: m, parentGVK: o.parentGVK, fieldpath: o.fieldpath + "." + k}
+	var m *internal.MapVariant
+	err := o.writeUnlocked(fieldSegments(k), func(o *SubObject) error {
+		m = o.obj.UpsertMap(k)
+		return nil
+	})
+	if err != nil {
+		return &SubObject{obj: internal.NewMap(nil), parentGVK: o.parentGVK, fieldpath: o.fieldpath + fieldPathKeys(k)}
+	}
+	return &SubObject{obj: m, parentGVK: o.parentGVK, fieldpath: o.fieldpath + fieldPathKeys(k), root: o.rootNode()}
 }
 
 // GetMap accepts a single key `k` whose value is expected to be a map. It returns
@@ -850,7 +997,7 @@ func (o *SubObject) GetMap(k string) *SubObject {
 		return nil
 	}
 	rn.SetYNode(val.Node())
-	return &SubObject{obj: internal.NewMap(rn.YNode()), parentGVK: o.parentGVK, fieldpath: o.fieldpath + "." + k}
+	return &SubObject{obj: internal.NewMap(rn.YNode()), parentGVK: o.parentGVK, fieldpath: o.fieldpath + fieldPathKeys(k), root: o.rootNode()}
 }
 
 // GetBool accepts a single key `k` whose value is expected to be a boolean. It returns
@@ -887,11 +1034,13 @@ func (o *SubObject) GetSlice(k string) SliceSubObjects {
 
 // SetSlice sets the SliceSubObjects to the given field. It creates the field if not exists. If returns error if the field exists but not a slice type.
 func (o *SubObject) SetSlice(objects SliceSubObjects, field string) error {
-	s := internal.NewSliceVariant()
-	for _, element := range objects {
-		s.Add(element.obj)
-	}
-	return o.obj.SetNestedSlice(s, field)
+	return o.writeUnlocked(fieldSegments(field), func(o *SubObject) error {
+		s := internal.NewSliceVariant()
+		for _, element := range objects {
+			s.Add(element.obj)
+		}
+		return o.obj.SetNestedSlice(s, field)
+	})
 }
 
 type SliceSubObjects []*SubObject
@@ -17,6 +17,7 @@ package fn
 import (
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/go-errors/errors"
@@ -814,6 +815,7 @@ items:
 	kptfile := rl.Items.GetRootKptfile()
 	assert.NotEmpty(t, kptfile)
 	assert.Equal(t, "ghost-root", kptfile.GetName())
+	assert.Same(t, kptfile, NewKubeObjectIndex(rl.Items).GetRootKptfile())
 }
 
 func TestEmptyGetRootKptfile(t *testing.T) {
@@ -854,3 +856,100 @@ metadata:
 		t.Fatalf("unexpected result from GroupVersionKind(); got %v; want %v", got, want)
 	}
 }
+
+func TestDeepCopy(t *testing.T) {
+	input := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: template # the template
+  annotations:
+    internal.config.kubernetes.io/path: cm.yaml
+data:
+  # the greeting
+  greeting: hello
+`)
+	original, err := ParseKubeObject(input)
+	require.NoError(t, err)
+	copied := original.DeepCopy()
+	assert.Equal(t, original.String(), copied.String())
+
+	require.NoError(t, copied.SetName("variant"))
+	require.NoError(t, copied.SetNestedString("hi", "data", "greeting"))
+	require.NoError(t, copied.SetHeadComment("", "data", "greeting"))
+	assert.Equal(t, string(input), original.String())
+
+	items := KubeObjects{original}
+	copiedItems := items.DeepCopy()
+	require.NoError(t, copiedItems[0].SetName("another"))
+	assert.Equal(t, "template", items[0].GetName())
+
+	data := original.GetMap("data")
+	copiedData := data.DeepCopy()
+	require.NoError(t, copiedData.SetNestedString("bye", "greeting"))
+	assert.Equal(t, "hello", data.GetString("greeting"))
+}
+
+func TestCommentsRoundTrip(t *testing.T) {
+	input := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  # the name
+  name: config # kpt-set: ${name}
+spec:
+  args: # kpt-set: ${args}
+  - a
+  flow: [a, b] # the flow list
+  nested: # the nested map
+    key: value
+`
+	testcases := map[string]struct {
+		fields []string
+		line   string
+		head   string
+	}{
+		"scalar": {
+			fields: []string{"metadata", "name"},
+			line:   "# kpt-set: ${name}",
+			head:   "# the name",
+		},
+		"block sequence": {
+			fields: []string{"spec", "args"},
+			line:   "# kpt-set: ${args}",
+		},
+		"flow sequence": {
+			fields: []string{"spec", "flow"},
+			line:   "# the flow list",
+		},
+		"block map": {
+			fields: []string{"spec", "nested"},
+			line:   "# the nested map",
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			obj, err := ParseKubeObject([]byte(input))
+			require.NoError(t, err)
+			line, found, err := obj.LineComment(tc.fields...)
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, tc.line, line)
+			head, _, err := obj.HeadComment(tc.fields...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.head, head)
+
+			// Setting the comments just read changes nothing.
+			require.NoError(t, obj.SetLineComment(line, tc.fields...))
+			require.NoError(t, obj.SetHeadComment(head, tc.fields...))
+			assert.Equal(t, input, obj.String())
+
+			require.NoError(t, obj.SetLineComment("# updated", tc.fields...))
+			require.NoError(t, obj.SetHeadComment("# head", tc.fields...))
+			line, _, _ = obj.LineComment(tc.fields...)
+			head, _, _ = obj.HeadComment(tc.fields...)
+			assert.Equal(t, "# updated", line)
+			assert.Equal(t, "# head", head)
+			assert.Equal(t, 1, strings.Count(obj.String(), "# updated"))
+			assert.Equal(t, 1, strings.Count(obj.String(), "# head"))
+		})
+	}
+}
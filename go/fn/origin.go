@@ -15,7 +15,6 @@ package fn
 
 import (
 	"fmt"
-	"reflect"
 	"regexp"
 	"strings"
 )
@@ -46,34 +45,16 @@ func (r *ResourceIdentifier) String() string {
 	return fmt.Sprintf("%v|%v|%v|%v", r.Group, r.Kind, r.Namespace, r.Name)
 }
 
-// hasUpstreamIdentifier determines whether the args are touching the kpt only annotation "internal.kpt.dev/upstream-identifier"
-func (o *SubObject) hasUpstreamIdentifier(val interface{}, fields ...string) bool {
-	kind := reflect.ValueOf(val).Kind()
-	if kind == reflect.Ptr {
-		kind = reflect.TypeOf(val).Elem().Kind()
-	}
-	switch kind {
-	case reflect.String:
-		if fields[len(fields)-1] == UpstreamIdentifier {
-			return true
-		}
-	case reflect.Map:
-		if fields[len(fields)-1] == "annotations" {
-			for _, key := range reflect.ValueOf(val).MapKeys() {
-				if key.String() == UpstreamIdentifier {
-					return true
-				}
-			}
-		}
-	}
-	return false
-}
-
+// effectiveNamespace returns the namespace used in the ResourceIdentifier. The
+// namespace set in `metadata.namespace` is always used, even by a cluster scoped
+// resource which has it set by mistake, so that the ResourceIdentifier and the
+// upstream identifier don't depend on the known scopes. A namespace scoped
+// resource without namespace uses DefaultNamespace.
 func (o *KubeObject) effectiveNamespace() string {
 	if o.HasNamespace() {
 		return o.GetNamespace()
 	}
-	if o.IsNamespaceScoped() {
+	if o.Scope() == NamespaceScoped {
 		return DefaultNamespace
 	}
 	return UnknownNamespace
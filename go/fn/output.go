@@ -0,0 +1,104 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// OutputOptions tells how the ResourceList is written, by ToYAMLWithOptions or
+// as an optional argument of AsMain, Run and Execute. The zero value sorts
+// the items and encodes them with the compact sequence indentation, which is the
+// default.
+type OutputOptions struct {
+	// PreserveFormat keeps the items in their input order, and encodes each
+	// item with the sequence indentation recorded in its SeqIndentAnnotation,
+	// `compact` or `wide`. The key order, the quoting style and the comments of
+	// the items are kept in both modes. A function changing a single field
+	// then changes a single line of the package.
+	PreserveFormat bool
+}
+
+func (opts OutputOptions) applyTo(r *runOptions) {
+	r.output = opts
+}
+
+// toPreservedYAML encodes the ResourceList with each item in its own sequence
+// indentation.
+func (rl *ResourceList) toPreservedYAML() ([]byte, error) {
+	items := rl.Items
+	rl.Items = nil
+	ynode, err := rl.toYNode()
+	rl.Items = items
+	if err != nil {
+		return nil, err
+	}
+	// toYNode starts with the apiVersion and the kind.
+	head := &yaml.Node{Kind: yaml.MappingNode, Content: ynode.Content[:4]}
+	tail := &yaml.Node{Kind: yaml.MappingNode, Content: ynode.Content[4:]}
+
+	out, err := internal.NewDoc(head).ToYAML()
+	if err != nil {
+		return nil, err
+	}
+	w := bytes.NewBuffer(out)
+	if len(items) > 0 {
+		w.WriteString("items:\n")
+		for _, item := range items {
+			style := yaml.CompactSequenceStyle
+			if item.GetAnnotation(SeqIndentAnnotation) == string(yaml.WideSequenceStyle) {
+				style = yaml.WideSequenceStyle
+			}
+			b, err := internal.NewDoc(item.node().Node()).ToYAMLWithOptions(&yaml.EncoderOptions{SeqIndent: style})
+			if err != nil {
+				return nil, err
+			}
+			writeSequenceItem(w, string(b))
+		}
+	}
+	if len(tail.Content) > 0 {
+		b, err := internal.NewDoc(tail).ToYAML()
+		if err != nil {
+			return nil, err
+		}
+		w.Write(b)
+	}
+	return w.Bytes(), nil
+}
+
+// writeSequenceItem writes the YAML of an item of a compact block sequence. Its
+// leading comments are written before the dash, like the encoder does.
+func writeSequenceItem(w *bytes.Buffer, item string) {
+	lines := strings.SplitAfter(strings.TrimSuffix(item, "\n"), "\n")
+	leading := true
+	for _, line := range lines {
+		switch {
+		case leading && (strings.HasPrefix(line, "#") || strings.TrimSpace(line) == ""):
+			w.WriteString(line)
+		case leading:
+			w.WriteString("- " + line)
+			leading = false
+		case line == "\n":
+			w.WriteString(line)
+		default:
+			w.WriteString("  " + line)
+		}
+	}
+	w.WriteString("\n")
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var formattedResourceList = `apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+# the web server
+- kind: Deployment
+  apiVersion: apps/v1
+  metadata:
+    name: 'web'
+    annotations:
+      internal.config.kubernetes.io/seqindent: wide
+  spec:
+    template:
+      spec:
+        containers:
+          - name: "nginx" # the server
+            image: nginx:1.0
+            args:
+              - |
+                --greeting=hello
+                world
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: api
+    annotations:
+      internal.config.kubernetes.io/seqindent: compact
+  spec:
+    template:
+      spec:
+        containers:
+        - name: api
+          image: api:1.0
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: admin
+functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: fn-config
+`
+
+func TestToYAMLWithOptions(t *testing.T) {
+	rl, err := ParseResourceList([]byte(formattedResourceList))
+	require.NoError(t, err)
+	found, err := rl.Items[0].SetPath("nginx:2.0", "spec.template.spec.containers[name=nginx].image")
+	require.NoError(t, err)
+	require.True(t, found)
+
+	out, err := rl.ToYAMLWithOptions(OutputOptions{PreserveFormat: true})
+	require.NoError(t, err)
+	assert.Equal(t, strings.Replace(formattedResourceList, "nginx:1.0", "nginx:2.0", 1), string(out))
+
+	out, err = rl.ToYAMLWithOptions(OutputOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: admin
+`)
+	assert.Contains(t, string(out), `        containers:
+        - name: "nginx" # the server
+`)
+}
+
+func TestExecutePreserveFormat(t *testing.T) {
+	noop := ResourceListProcessorFunc(func(rl *ResourceList) (bool, error) {
+		return true, nil
+	})
+	var out bytes.Buffer
+	err := Execute(noop, strings.NewReader(formattedResourceList), &out, OutputOptions{PreserveFormat: true})
+	require.NoError(t, err)
+	assert.Equal(t, formattedResourceList, out.String())
+
+	preserved, err := Run(noop, []byte(formattedResourceList), OutputOptions{PreserveFormat: true})
+	require.NoError(t, err)
+	assert.Equal(t, formattedResourceList, string(preserved))
+	sorted, err := Run(noop, []byte(formattedResourceList))
+	require.NoError(t, err)
+	assert.NotEqual(t, formattedResourceList, string(sorted))
+}
+
+func TestDocumentComments(t *testing.T) {
+	testcases := map[string]string{
+		"head and foot": `# Copyright 2022 Google LLC
+
+# the config
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+# end of the config
+
+# end of the file
+`,
+		"head only": `# Copyright 2022 Google LLC
+
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`,
+	}
+	for name, input := range testcases {
+		t.Run(name, func(t *testing.T) {
+			obj, err := ParseKubeObject([]byte(input))
+			require.NoError(t, err)
+			assert.Equal(t, input, obj.String())
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ParseOptions hardens the parsing of untrusted inputs, by
+// ParseKubeObjectsWithOptions, ParseResourceListWithOptions or as an optional
+// argument of AsMain, Run and Execute. A function processing untrusted packages
+// can call
+//
+//	fn.AsMain(runner, fn.HardenedParseOptions())
+//
+// The zero value accepts any input, which is the default. The limits are
+// disabled when zero.
+type ParseOptions struct {
+	// Strict rejects the duplicate mapping keys, which are silently kept
+	// otherwise.
+	Strict bool
+	// MaxSize is the maximum size of the input in bytes.
+	MaxSize int
+	// MaxDepth is the maximum nesting depth of the maps and sequences.
+	MaxDepth int
+	// MaxItems is the maximum number of KubeObjects, i.e. of YAML documents for
+	// ParseKubeObjects and of ResourceList.items for ParseResourceList.
+	MaxItems int
+	// MaxAliasExpansion is the maximum number of YAML nodes the aliases of the
+	// input expand to, in total. It protects the consumers which expand the
+	// aliases, e.g. As, from the `billion laughs` inputs.
+	MaxAliasExpansion int
+}
+
+// HardenedParseOptions returns ParseOptions suitable for the untrusted inputs,
+// with limits well above the needs of the real packages.
+func HardenedParseOptions() ParseOptions {
+	return ParseOptions{
+		Strict:            true,
+		MaxSize:           64 << 20,
+		MaxDepth:          200,
+		MaxItems:          10000,
+		MaxAliasExpansion: 100000,
+	}
+}
+
+func (opts ParseOptions) applyTo(r *runOptions) {
+	r.parse = opts
+}
+
+// ErrUnsafeInput is returned when the input is rejected by the ParseOptions.
+type ErrUnsafeInput struct {
+	Message string
+}
+
+func (e *ErrUnsafeInput) Error() string {
+	return e.Message
+}
+
+func isUnsafeInput(err error) bool {
+	var e *ErrUnsafeInput
+	return errors.As(err, &e)
+}
+
+func (opts ParseOptions) checkSize(in []byte) error {
+	if opts.MaxSize > 0 && len(in) > opts.MaxSize {
+		return &ErrUnsafeInput{Message: fmt.Sprintf("the input size of %d bytes exceeds the limit of %d bytes", len(in), opts.MaxSize)}
+	}
+	return nil
+}
+
+// readInput reads the input, up to just above the size limit.
+func (opts ParseOptions) readInput(r io.Reader) ([]byte, error) {
+	if opts.MaxSize > 0 {
+		r = io.LimitReader(r, int64(opts.MaxSize)+1)
+	}
+	in, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return in, opts.checkSize(in)
+}
+
+func (opts ParseOptions) checkItems(count int) error {
+	if opts.MaxItems > 0 && count > opts.MaxItems {
+		return &ErrUnsafeInput{Message: fmt.Sprintf("the %d items exceed the limit of %d items", count, opts.MaxItems)}
+	}
+	return nil
+}
+
+// checkNodes checks the depth, the duplicate keys and the alias expansion of the
+// parsed YAML documents.
+func (opts ParseOptions) checkNodes(nodes []*yaml.Node) error {
+	c := nodeChecker{opts: opts, expanded: map[*yaml.Node]int{}}
+	for _, node := range nodes {
+		if err := c.check(node, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type nodeChecker struct {
+	opts ParseOptions
+	// expanded caches the expanded size of the anchored nodes.
+	expanded map[*yaml.Node]int
+	// aliased is the total expanded size of the aliases seen so far.
+	aliased int
+}
+
+func (c *nodeChecker) check(node *yaml.Node, depth int) error {
+	switch node.Kind {
+	case yaml.AliasNode:
+		if c.opts.MaxAliasExpansion > 0 {
+			c.aliased += c.expandedSize(node.Alias)
+			if c.aliased > c.opts.MaxAliasExpansion {
+				return &ErrUnsafeInput{Message: fmt.Sprintf("the aliases expand to more than %d nodes at line %d", c.opts.MaxAliasExpansion, node.Line)}
+			}
+		}
+		return nil
+	case yaml.MappingNode, yaml.SequenceNode:
+		depth++
+		if c.opts.MaxDepth > 0 && depth > c.opts.MaxDepth {
+			return &ErrUnsafeInput{Message: fmt.Sprintf("the nesting depth exceeds the limit of %d at line %d", c.opts.MaxDepth, node.Line)}
+		}
+	}
+	if node.Kind == yaml.MappingNode && c.opts.Strict {
+		keys := map[string]*yaml.Node{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				continue
+			}
+			if first, found := keys[key.Value]; found {
+				return &ErrUnsafeInput{Message: fmt.Sprintf("duplicate key %q at line %d, first defined at line %d", key.Value, key.Line, first.Line)}
+			}
+			keys[key.Value] = key
+		}
+	}
+	for _, child := range node.Content {
+		if err := c.check(child, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandedSize returns the number of nodes of node once its aliases are
+// expanded, capped to just above the limit so that it can't overflow.
+func (c *nodeChecker) expandedSize(node *yaml.Node) int {
+	if node == nil {
+		return 0
+	}
+	if size, found := c.expanded[node]; found {
+		return size
+	}
+	limit := c.opts.MaxAliasExpansion + 1
+	// An anchor containing itself is invalid YAML, count it as too large.
+	c.expanded[node] = limit
+	size := 1
+	if node.Kind == yaml.AliasNode {
+		size = c.expandedSize(node.Alias)
+	}
+	for _, child := range node.Content {
+		if size += c.expandedSize(child); size > limit {
+			size = limit
+			break
+		}
+	}
+	c.expanded[node] = size
+	return size
+}
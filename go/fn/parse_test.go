@@ -0,0 +1,162 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var aliasBomb = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: bomb
+  annotations:
+    a: &a ["lol", "lol", "lol", "lol", "lol", "lol", "lol", "lol", "lol", "lol"]
+    b: &b [*a, *a, *a, *a, *a, *a, *a, *a, *a, *a]
+    c: &c [*b, *b, *b, *b, *b, *b, *b, *b, *b, *b]
+    d: &d [*c, *c, *c, *c, *c, *c, *c, *c, *c, *c]
+`
+
+func TestParseOptions(t *testing.T) {
+	testcases := map[string]struct {
+		input       string
+		opts        ParseOptions
+		expectedErr string
+	}{
+		"duplicate keys are kept by default": {
+			input: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  name: second
+`,
+		},
+		"strict duplicate keys": {
+			input: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  name: second
+`,
+			opts:        ParseOptions{Strict: true},
+			expectedErr: `duplicate key "name" at line 5, first defined at line 4`,
+		},
+		"size": {
+			input:       aliasBomb,
+			opts:        ParseOptions{MaxSize: 100},
+			expectedErr: "bytes exceeds the limit of 100 bytes",
+		},
+		"depth": {
+			input: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: deep
+  annotations:
+    a: [[[[x]]]]
+`,
+			opts:        ParseOptions{MaxDepth: 5},
+			expectedErr: "the nesting depth exceeds the limit of 5 at line 6",
+		},
+		"items": {
+			input:       indexResources,
+			opts:        ParseOptions{MaxItems: 3},
+			expectedErr: "the 4 items exceed the limit of 3 items",
+		},
+		"alias bomb": {
+			input:       aliasBomb,
+			opts:        ParseOptions{MaxAliasExpansion: 1000},
+			expectedErr: "the aliases expand to more than 1000 nodes at line 8",
+		},
+		"hardened": {
+			input: aliasBomb,
+			opts:  HardenedParseOptions(),
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseKubeObjectsWithOptions([]byte(tc.input), tc.opts)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.expectedErr)
+			var unsafe *ErrUnsafeInput
+			assert.True(t, errors.As(err, &unsafe))
+		})
+	}
+}
+
+func TestRunUnsafeInput(t *testing.T) {
+	input := `apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: a
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: b
+`
+	processed := false
+	out, err := Run(ResourceListProcessorFunc(func(rl *ResourceList) (bool, error) {
+		processed = true
+		return true, nil
+	}), []byte(input), ParseOptions{MaxItems: 1})
+	assert.ErrorContains(t, err, "the 2 items exceed the limit of 1 items")
+	assert.False(t, processed)
+	rl, err := ParseResourceList(out)
+	require.NoError(t, err)
+	require.Len(t, rl.Results, 1)
+	assert.Equal(t, Error, rl.Results[0].Severity)
+	assert.Equal(t, "failed to parse input bytes: the 2 items exceed the limit of 1 items", rl.Results[0].Message)
+}
+
+func TestExecuteUnsafeInput(t *testing.T) {
+	input := `apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: first
+    name: second
+functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: config
+`
+	noop := ResourceListProcessorFunc(func(rl *ResourceList) (bool, error) {
+		return true, nil
+	})
+	var out bytes.Buffer
+	require.NoError(t, Execute(noop, strings.NewReader(input), &out))
+
+	out.Reset()
+	err := Execute(noop, strings.NewReader(input), &out, OutputOptions{PreserveFormat: true}, ParseOptions{Strict: true})
+	assert.ErrorContains(t, err, `duplicate key "name" at line 8, first defined at line 7`)
+	rl, err := ParseResourceList(out.Bytes())
+	require.NoError(t, err)
+	require.Len(t, rl.Results, 1)
+	assert.Equal(t, Error, rl.Results[0].Severity)
+}
@@ -0,0 +1,521 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// pathSegmentKind tells how a path expression segment matches the YAML nodes.
+type pathSegmentKind int
+
+const (
+	// segmentField matches the value of a map key, e.g. `spec`.
+	segmentField pathSegmentKind = iota
+	// segmentFieldWildcard matches all the values of a map, e.g. `labels.*`.
+	segmentFieldWildcard
+	// segmentIndex matches a sequence element by its index, e.g. `containers[0]`.
+	segmentIndex
+	// segmentSelector matches the sequence elements whose field equals a value, e.g. `containers[name=nginx]`.
+	segmentSelector
+	// segmentElementWildcard matches all the sequence elements, e.g. `containers[*]`.
+	segmentElementWildcard
+)
+
+// pathSegment is a single parsed step of a path expression.
+type pathSegment struct {
+	kind  pathSegmentKind
+	key   string
+	value string
+	index int
+}
+
+func (s pathSegment) String() string {
+	switch s.kind {
+	case segmentField:
+		return strings.TrimPrefix(fieldPathKeys(s.key), ".")
+	case segmentFieldWildcard:
+		return "*"
+	case segmentIndex:
+		return fmt.Sprintf("[%d]", s.index)
+	case segmentSelector:
+		return selectorString(s.key, s.value)
+	default:
+		return "[*]"
+	}
+}
+
+// parsePath parses a path expression into segments. The supported syntax is:
+//   - `a.b.c` selects nested map fields.
+//   - `a["b.c"]` or `a['b.c']` selects a map field whose key contains dots.
+//   - `a.*` selects all the values of map `a`.
+//   - `a[0]` selects the first element of sequence `a`.
+//   - `a[name=nginx]` selects the elements of sequence `a` whose `name` field is "nginx".
+//   - `a[*]` selects all the elements of sequence `a`.
+func parsePath(path string) ([]pathSegment, error) {
+	var segments []pathSegment
+	p := strings.TrimPrefix(path, ".")
+	if p == "" {
+		return nil, fmt.Errorf("invalid path expression %q: path is empty", path)
+	}
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			if p == "" || p[0] == '.' || p[0] == '[' {
+				return nil, fmt.Errorf("invalid path expression %q: empty field name", path)
+			}
+		case '[':
+			end := closingBracket(p)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path expression %q: missing closing bracket", path)
+			}
+			seg, err := parseBracket(p[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path expression %q: %w", path, err)
+			}
+			segments = append(segments, seg)
+			p = p[end+1:]
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			name := p[:end]
+			if name == "*" {
+				segments = append(segments, pathSegment{kind: segmentFieldWildcard})
+			} else {
+				segments = append(segments, pathSegment{kind: segmentField, key: name})
+			}
+			p = p[end:]
+		}
+	}
+	return segments, nil
+}
+
+// closingBracket returns the index of the bracket that closes the one at p[0],
+// skipping the brackets inside quoted strings.
+func closingBracket(p string) int {
+	var quote byte
+	for i := 1; i < len(p); i++ {
+		switch {
+		case quote != 0:
+			if p[i] == quote {
+				quote = 0
+			}
+		case p[i] == '"' || p[i] == '\'':
+			quote = p[i]
+		case p[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseBracket(content string) (pathSegment, error) {
+	content = strings.TrimSpace(content)
+	switch {
+	case content == "":
+		return pathSegment{}, fmt.Errorf("empty brackets")
+	case content == "*":
+		return pathSegment{kind: segmentElementWildcard}, nil
+	case isQuoted(content):
+		return pathSegment{kind: segmentField, key: content[1 : len(content)-1]}, nil
+	}
+	if i, err := strconv.Atoi(content); err == nil {
+		if i < 0 {
+			return pathSegment{}, fmt.Errorf("negative index %d", i)
+		}
+		return pathSegment{kind: segmentIndex, index: i}, nil
+	}
+	k, v, ok := strings.Cut(content, "=")
+	if !ok {
+		return pathSegment{}, fmt.Errorf("unexpected selector %q, expect `*`, an index or `key=value`", content)
+	}
+	k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+	if isQuoted(v) {
+		v = v[1 : len(v)-1]
+	}
+	if k == "" {
+		return pathSegment{}, fmt.Errorf("selector %q has an empty key", content)
+	}
+	return pathSegment{kind: segmentSelector, key: k, value: v}, nil
+}
+
+// fieldPathKeys returns the path expression of the nested map keys, each one
+// starting with a dot, or quoted in brackets if it can't be parsed back as a
+// plain field name, e.g. `.metadata.annotations["config.kubernetes.io/local-config"]`.
+func fieldPathKeys(keys ...string) string {
+	var sb strings.Builder
+	for _, key := range keys {
+		if key == "" || key == "*" || strings.ContainsAny(key, `.[]`) {
+			sb.WriteString("[" + quotePathString(key) + "]")
+		} else {
+			sb.WriteString("." + key)
+		}
+	}
+	return sb.String()
+}
+
+// selectorString returns the path expression of a selector, with the value
+// quoted if it can't be parsed back as is.
+func selectorString(key, value string) string {
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, `[]"'`) {
+		value = quotePathString(value)
+	}
+	return fmt.Sprintf("[%s=%s]", key, value)
+}
+
+// quotePathString quotes the string for a path expression, which has no
+// escape sequence.
+func quotePathString(s string) string {
+	if strings.Contains(s, `"`) {
+		return "'" + s + "'"
+	}
+	return `"` + s + `"`
+}
+
+func isQuoted(s string) bool {
+	return len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0]
+}
+
+// pathMatch is a YAML node matched by a path expression together with its
+// resolved fieldpath.
+type pathMatch struct {
+	node      *yaml.Node
+	fieldpath string
+}
+
+// matchSegment returns the children of node that match seg, following the
+// aliases and the merge keys. For a write, the matched children shared through
+// an alias or a merge key are copied first, see SetAliasWriteMode.
+func matchSegment(m pathMatch, seg pathSegment, aliases *internal.Aliases, write bool) ([]pathMatch, error) {
+	var matches []pathMatch
+	node := internal.ResolveAlias(m.node)
+	field := func(key string) error {
+		value, found := internal.MappingValue(node, key)
+		if write {
+			var err error
+			if value, found, err = aliases.WritableMappingValue(node, key); err != nil {
+				return err
+			}
+		}
+		if found {
+			matches = append(matches, pathMatch{node: value, fieldpath: m.fieldpath + fieldPathKeys(key)})
+		}
+		return nil
+	}
+	element := func(i int, fieldpath string) error {
+		elem := internal.ResolveAlias(node.Content[i])
+		if write {
+			var err error
+			if elem, err = aliases.WritableElement(node, i); err != nil {
+				return err
+			}
+		}
+		matches = append(matches, pathMatch{node: elem, fieldpath: fieldpath})
+		return nil
+	}
+	switch seg.kind {
+	case segmentField:
+		if node.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+		if err := field(seg.key); err != nil {
+			return nil, err
+		}
+	case segmentFieldWildcard:
+		if node.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+		keys, _ := internal.MappingFields(node)
+		for _, key := range keys {
+			if err := field(key.Value); err != nil {
+				return nil, err
+			}
+		}
+	case segmentIndex:
+		if node.Kind != yaml.SequenceNode || seg.index >= len(node.Content) {
+			return nil, nil
+		}
+		if err := element(seg.index, m.fieldpath+seg.String()); err != nil {
+			return nil, err
+		}
+	case segmentSelector:
+		if node.Kind != yaml.SequenceNode {
+			return nil, nil
+		}
+		for i, elem := range node.Content {
+			if elementMatches(elem, seg) {
+				if err := element(i, m.fieldpath+seg.String()); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case segmentElementWildcard:
+		if node.Kind != yaml.SequenceNode {
+			return nil, nil
+		}
+		for i := range node.Content {
+			if err := element(i, fmt.Sprintf("%s[%d]", m.fieldpath, i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return matches, nil
+}
+
+// elementMatches tells whether a sequence element matches a `[key=value]` selector.
+// Scalar elements can be selected with `[.=value]`.
+func elementMatches(elem *yaml.Node, seg pathSegment) bool {
+	elem = internal.ResolveAlias(elem)
+	if seg.key == "." {
+		return elem.Kind == yaml.ScalarNode && elem.Value == seg.value
+	}
+	v, found := internal.MappingValue(elem, seg.key)
+	return found && v.Kind == yaml.ScalarNode && v.Value == seg.value
+}
+
+// resolvePath returns all the nodes matched by segments, starting from the SubObject.
+func (o *SubObject) resolvePath(segments []pathSegment) []pathMatch {
+	// A read never fails.
+	matches, _ := o.matchPath(segments, false)
+	return matches
+}
+
+// resolveWritablePath is resolvePath for a write: the matched nodes shared
+// through an alias or a merge key are copied first, see SetAliasWriteMode.
+func (o *SubObject) resolveWritablePath(segments []pathSegment) ([]pathMatch, error) {
+	return o.matchPath(segments, true)
+}
+
+func (o *SubObject) matchPath(segments []pathSegment, write bool) ([]pathMatch, error) {
+	matches := []pathMatch{{node: o.obj.Node(), fieldpath: o.fieldpath}}
+	aliases := o.aliases()
+	for _, seg := range segments {
+		var next []pathMatch
+		for _, m := range matches {
+			children, err := matchSegment(m, seg, aliases, write)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, children...)
+		}
+		matches = next
+		if len(matches) == 0 {
+			return nil, nil
+		}
+	}
+	return matches, nil
+}
+
+func (o *SubObject) matchToSubObject(m pathMatch) *SubObject {
+	return &SubObject{obj: internal.NewMap(m.node), parentGVK: o.parentGVK, fieldpath: m.fieldpath, root: o.rootNode()}
+}
+
+// GetPath returns the SubObjects matched by the path expression, e.g.
+// `spec.template.spec.containers[name=nginx].image` or
+// `spec.template.spec.containers[*].env[name=FOO].value`. Each returned
+// SubObject carries its resolved fieldpath. A matched scalar value can be read
+// via As, e.g.
+//
+//	matches, _ := obj.GetPath("spec.template.spec.containers[name=nginx].image")
+//	var image string
+//	err := matches[0].As(&image)
+//
+// It returns an empty slice if nothing matches, and an error if the path
+// expression is invalid.
+func (o *SubObject) GetPath(path string) (SliceSubObjects, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	var subObjects SliceSubObjects
+	for _, m := range o.resolvePath(segments) {
+		subObjects = append(subObjects, o.matchToSubObject(m))
+	}
+	return subObjects, nil
+}
+
+// SetPath sets val to every field matched by the path expression. The trailing
+// plain fields of the path (those after the last selector or wildcard) are
+// created if they don't exist, the same as SetNestedField. It returns
+// whether any field has been set and a potential error.
+func (o *SubObject) SetPath(val interface{}, path string) (bool, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return false, err
+	}
+	set := false
+	err = o.writeUnlocked(segments, func(o *SubObject) error {
+		var err error
+		set, err = o.setPath(val, path, segments)
+		return err
+	})
+	return set, err
+}
+
+func (o *SubObject) setPath(val interface{}, path string, segments []pathSegment) (bool, error) {
+	// Split the path into a prefix which must match existing nodes, and
+	// trailing plain fields which are created on demand.
+	split := len(segments)
+	for split > 0 && segments[split-1].kind == segmentField {
+		split--
+	}
+	fields := make([]string, 0, len(segments)-split)
+	for _, seg := range segments[split:] {
+		fields = append(fields, seg.key)
+	}
+
+	if len(fields) == 0 {
+		// The last segment is a selector or wildcard: replace the matched nodes in place.
+		matches, err := o.resolveWritablePath(segments)
+		if err != nil || len(matches) == 0 {
+			return false, err
+		}
+		for _, m := range matches {
+			node, err := toYNode(val)
+			if err != nil {
+				return false, fmt.Errorf("unable to set %v at path %v with error: %w", val, path, err)
+			}
+			// The replaced node can be the anchor of aliases which must not change.
+			if err := o.aliases().DetachAliases(m.node, m.fieldpath); err != nil {
+				return false, err
+			}
+			copyComments(m.node, node)
+			*m.node = *node
+		}
+		return true, nil
+	}
+
+	matches, err := o.resolveWritablePath(segments[:split])
+	if err != nil {
+		return false, err
+	}
+	set := false
+	for _, m := range matches {
+		if m.node.Kind != yaml.MappingNode {
+			continue
+		}
+		parent := o.matchToSubObject(m)
+		if err := parent.SetNestedField(val, fields...); err != nil {
+			return set, err
+		}
+		set = true
+	}
+	return set, nil
+}
+
+// RemovePath removes every field or sequence element matched by the path
+// expression. It returns whether anything has been removed and a potential error.
+func (o *SubObject) RemovePath(path string) (bool, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return false, err
+	}
+	removed := false
+	err = o.writeUnlocked(segments, func(o *SubObject) error {
+		var err error
+		removed, err = o.removePath(segments)
+		return err
+	})
+	return removed, err
+}
+
+func (o *SubObject) removePath(segments []pathSegment) (bool, error) {
+	last := segments[len(segments)-1]
+	removed := false
+	parents, err := o.resolveWritablePath(segments[:len(segments)-1])
+	if err != nil {
+		return false, err
+	}
+	for _, parent := range parents {
+		switch parent.node.Kind {
+		case yaml.MappingNode:
+			// The merged fields can only be removed once the merge keys are inlined.
+			if last.kind == segmentFieldWildcard || internal.IsMergedField(parent.node, last.key) {
+				if err := o.aliases().InlineMerges(parent.node); err != nil {
+					return removed, err
+				}
+			}
+		}
+		remaining := parent.node.Content[:0]
+		switch parent.node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(parent.node.Content); i += 2 {
+				k, v := parent.node.Content[i], parent.node.Content[i+1]
+				if last.kind == segmentFieldWildcard || (last.kind == segmentField && k.Value == last.key) {
+					if err := o.aliases().DetachAliases(v, k.Value); err != nil {
+						return removed, err
+					}
+					removed = true
+					continue
+				}
+				remaining = append(remaining, k, v)
+			}
+		case yaml.SequenceNode:
+			for i, elem := range parent.node.Content {
+				switch {
+				case last.kind == segmentElementWildcard,
+					last.kind == segmentIndex && last.index == i,
+					last.kind == segmentSelector && elementMatches(elem, last):
+					if err := o.aliases().DetachAliases(elem, fmt.Sprintf("[%d]", i)); err != nil {
+						return removed, err
+					}
+					removed = true
+					continue
+				}
+				remaining = append(remaining, elem)
+			}
+		default:
+			continue
+		}
+		parent.node.Content = remaining
+	}
+	return removed, nil
+}
+
+// FieldPath returns the path of the SubObject in its KubeObject, e.g.
+// `spec.template.spec.containers[name=nginx]`. The keys containing dots are
+// quoted, e.g. `metadata.annotations["config.kubernetes.io/local-config"]`, so
+// that GetPath selects the same field. It can be used to fill in
+// Result.Field.Path.
+func (o *SubObject) FieldPath() string {
+	return strings.TrimPrefix(o.fieldpath, ".")
+}
+
+// toYNode converts a value to a yaml.Node the same way SetNestedField does.
+func toYNode(val interface{}) (*yaml.Node, error) {
+	tmp := &SubObject{obj: internal.NewMap(nil)}
+	if err := tmp.SetNestedField(val, "value"); err != nil {
+		return nil, err
+	}
+	v, _, err := tmp.obj.GetNestedValue("value")
+	if err != nil {
+		return nil, err
+	}
+	return v.Node(), nil
+}
+
+func copyComments(from, to *yaml.Node) {
+	to.HeadComment = from.HeadComment
+	to.LineComment = from.LineComment
+	to.FootComment = from.FootComment
+}
@@ -0,0 +1,196 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pathDeployment = []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  annotations:
+    config.kubernetes.io/local-config: "true"
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.14.2 # kpt-set: ${image}
+        env:
+        - name: FOO
+          value: foo
+        - name: BAR
+          value: bar
+      - name: sidecar
+        image: sidecar:v1
+        env:
+        - name: FOO
+          value: foo2
+`)
+
+func TestGetPath(t *testing.T) {
+	testcases := map[string]struct {
+		path       string
+		values     []string
+		fieldpaths []string
+	}{
+		"selector": {
+			path:       "spec.template.spec.containers[name=nginx].image",
+			values:     []string{"nginx:1.14.2"},
+			fieldpaths: []string{"spec.template.spec.containers[name=nginx].image"},
+		},
+		"wildcard and nested selector": {
+			path:       "spec.template.spec.containers[*].env[name=FOO].value",
+			values:     []string{"foo", "foo2"},
+			fieldpaths: []string{"spec.template.spec.containers[0].env[name=FOO].value", "spec.template.spec.containers[1].env[name=FOO].value"},
+		},
+		"index": {
+			path:       "spec.template.spec.containers[1].name",
+			values:     []string{"sidecar"},
+			fieldpaths: []string{"spec.template.spec.containers[1].name"},
+		},
+		"quoted key": {
+			path:       `metadata.annotations["config.kubernetes.io/local-config"]`,
+			values:     []string{"true"},
+			fieldpaths: []string{`metadata.annotations["config.kubernetes.io/local-config"]`},
+		},
+		"wildcard over quoted keys": {
+			path:       "metadata.annotations.*",
+			values:     []string{"true"},
+			fieldpaths: []string{`metadata.annotations["config.kubernetes.io/local-config"]`},
+		},
+		"no match": {
+			path: "spec.template.spec.containers[name=unknown].image",
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			obj, err := ParseKubeObject(pathDeployment)
+			require.NoError(t, err)
+			matches, err := obj.GetPath(tc.path)
+			require.NoError(t, err)
+			var values, fieldpaths []string
+			for _, m := range matches {
+				var s string
+				require.NoError(t, m.As(&s))
+				values = append(values, s)
+				fieldpaths = append(fieldpaths, m.FieldPath())
+
+				// The FieldPath selects the same field.
+				again, err := obj.GetPath(m.FieldPath())
+				require.NoError(t, err)
+				require.Len(t, again, 1)
+				assert.Equal(t, m.FieldPath(), again[0].FieldPath())
+				assert.Equal(t, m.String(), again[0].String())
+			}
+			assert.Equal(t, tc.values, values)
+			assert.Equal(t, tc.fieldpaths, fieldpaths)
+		})
+	}
+}
+
+func TestGetPathInvalid(t *testing.T) {
+	obj, err := ParseKubeObject(pathDeployment)
+	require.NoError(t, err)
+	for _, path := range []string{"", "spec..template", "spec.containers[name=nginx", "spec.containers[]", "spec.containers[foo]"} {
+		_, err := obj.GetPath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	obj, err := ParseKubeObject(pathDeployment)
+	require.NoError(t, err)
+
+	found, err := obj.SetPath("nginx:1.21", "spec.template.spec.containers[name=nginx].image")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = obj.SetPath("new", "spec.template.spec.containers[*].env[name=FOO].value")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = obj.SetPath(true, "spec.template.spec.containers[name=sidecar].securityContext.readOnlyRootFilesystem")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = obj.SetPath("x", "spec.template.spec.containers[name=unknown].image")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  annotations:
+    config.kubernetes.io/local-config: "true"
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.21 # kpt-set: ${image}
+        env:
+        - name: FOO
+          value: new
+        - name: BAR
+          value: bar
+      - name: sidecar
+        image: sidecar:v1
+        env:
+        - name: FOO
+          value: new
+        securityContext:
+          readOnlyRootFilesystem: true
+`
+	assert.Equal(t, expected, obj.String())
+}
+
+func TestRemovePath(t *testing.T) {
+	obj, err := ParseKubeObject(pathDeployment)
+	require.NoError(t, err)
+
+	removed, err := obj.RemovePath("spec.template.spec.containers[*].env[name=FOO]")
+	require.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = obj.RemovePath("spec.template.spec.containers[name=sidecar].env")
+	require.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = obj.RemovePath("metadata.labels")
+	require.NoError(t, err)
+	assert.False(t, removed)
+
+	expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  annotations:
+    config.kubernetes.io/local-config: "true"
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.14.2 # kpt-set: ${image}
+        env:
+        - name: BAR
+          value: bar
+      - name: sidecar
+        image: sidecar:v1
+`
+	assert.Equal(t, expected, obj.String())
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"strconv"
+	"time"
+
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// nestedScalar returns the scalar node located by fields. A null value is
+// treated as not found.
+func (o *SubObject) nestedScalar(expectedFieldType any, fields ...string) (*yaml.Node, bool, error) {
+	_, node, found, err := o.fieldNodes(fields...)
+	if err != nil {
+		return nil, found, NewErrUnmatchedField(*o, fields, expectedFieldType)
+	}
+	if !found || (node.Kind == yaml.ScalarNode && node.Tag == yaml.NodeTagNull) {
+		return nil, false, nil
+	}
+	if node.Kind != yaml.ScalarNode {
+		return nil, true, NewErrUnmatchedField(*o, fields, expectedFieldType)
+	}
+	return node, true, nil
+}
+
+// NestedQuantity returns the resource.Quantity value, if the field exist and a
+// potential error. Both the string (e.g. `500m`, `1Gi`) and the number (e.g.
+// `2`) notations are accepted. It returns an ErrUnmatchedField error if the
+// value is not a valid quantity.
+func (o *SubObject) NestedQuantity(fields ...string) (apiresource.Quantity, bool, error) {
+	var val apiresource.Quantity
+	node, found, err := o.nestedScalar(val, fields...)
+	if err != nil || !found {
+		return val, found, err
+	}
+	q, err := apiresource.ParseQuantity(node.Value)
+	if err != nil {
+		return val, true, NewErrUnmatchedField(*o, fields, val)
+	}
+	return q, true, nil
+}
+
+// SetNestedQuantity sets the `fields` value to the resource.Quantity `value`.
+// If the field already holds an equal quantity, e.g. `1000m` for a value of 1,
+// it is left untouched to keep the original notation. A field written as a
+// number stays a number if the new value is an integer.
+func (o *SubObject) SetNestedQuantity(value apiresource.Quantity, fields ...string) error {
+	node, found, err := o.nestedScalar(value, fields...)
+	if err != nil || !found {
+		return o.SetNestedField(value.String(), fields...)
+	}
+	if current, err := apiresource.ParseQuantity(node.Value); err == nil && current.Cmp(value) == 0 {
+		return nil
+	}
+	if node.Tag == yaml.NodeTagInt {
+		if i, err := strconv.ParseInt(value.String(), 10, 64); err == nil {
+			return o.SetNestedField(i, fields...)
+		}
+	}
+	return o.setNestedStringKeepStyle(node.Style, value.String(), fields...)
+}
+
+// NestedDuration returns the time.Duration value, if the field exist and a
+// potential error. The value uses the Go duration notation of metav1.Duration,
+// e.g. `30s` or `1h30m`. It returns an ErrUnmatchedField error if the value is
+// not a valid duration.
+func (o *SubObject) NestedDuration(fields ...string) (time.Duration, bool, error) {
+	var val time.Duration
+	node, found, err := o.nestedScalar(val, fields...)
+	if err != nil || !found {
+		return val, found, err
+	}
+	d, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return val, true, NewErrUnmatchedField(*o, fields, val)
+	}
+	return d, true, nil
+}
+
+// SetNestedDuration sets the `fields` value to the time.Duration `value`. If
+// the field already holds an equal duration, e.g. `90s` for a value of 1m30s,
+// it is left untouched to keep the original notation.
+func (o *SubObject) SetNestedDuration(value time.Duration, fields ...string) error {
+	node, found, err := o.nestedScalar(value, fields...)
+	if err != nil || !found {
+		return o.SetNestedField(value.String(), fields...)
+	}
+	if current, err := time.ParseDuration(node.Value); err == nil && current == value {
+		return nil
+	}
+	return o.setNestedStringKeepStyle(node.Style, value.String(), fields...)
+}
+
+// setNestedStringKeepStyle sets the `fields` value to the string `value`, and
+// keeps the quotes if the field was quoted.
+func (o *SubObject) setNestedStringKeepStyle(style yaml.Style, value string, fields ...string) error {
+	if err := o.SetNestedField(value, fields...); err != nil {
+		return err
+	}
+	if style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) == 0 {
+		return nil
+	}
+	if _, node, found, err := o.fieldNodes(fields...); err == nil && found && node.Tag == yaml.NodeTagString {
+		node.Style = style
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+var limitRange = `apiVersion: v1
+kind: LimitRange
+metadata:
+  name: limits
+spec:
+  limits:
+  - type: Container
+    max:
+      cpu: 2 # two cores
+      memory: 1024Mi
+    default:
+      cpu: 500m
+      memory: "512Mi"
+    maxLimitRequestRatio:
+      cpu: lots
+  timeout: 90s
+`
+
+func TestNestedQuantity(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(limitRange))
+	require.NoError(t, err)
+	list, _, err := obj.NestedSlice("spec", "limits")
+	require.NoError(t, err)
+	limits := list[0]
+
+	cpu, found, err := limits.NestedQuantity("max", "cpu")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(2000), cpu.MilliValue())
+
+	memory, found, err := limits.NestedQuantity("max", "memory")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 0, memory.Cmp(apiresource.MustParse("1Gi")))
+
+	_, found, err = limits.NestedQuantity("max", "ephemeral-storage")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	_, found, err = limits.NestedQuantity("maxLimitRequestRatio", "cpu")
+	assert.True(t, found)
+	var unmatched *ErrUnmatchedField
+	assert.ErrorAs(t, err, &unmatched)
+
+	// Equal values keep the original notation.
+	require.NoError(t, limits.SetNestedQuantity(apiresource.MustParse("2000m"), "max", "cpu"))
+	require.NoError(t, limits.SetNestedQuantity(apiresource.MustParse("1Gi"), "max", "memory"))
+	// Changed values are written in the canonical notation.
+	require.NoError(t, limits.SetNestedQuantity(apiresource.MustParse("4"), "max", "cpu"))
+	require.NoError(t, limits.SetNestedQuantity(apiresource.MustParse("0.25"), "default", "cpu"))
+	require.NoError(t, limits.SetNestedQuantity(apiresource.MustParse("256Mi"), "default", "memory"))
+
+	expected := `apiVersion: v1
+kind: LimitRange
+metadata:
+  name: limits
+spec:
+  limits:
+  - type: Container
+    max:
+      cpu: 4 # two cores
+      memory: 1024Mi
+    default:
+      cpu: 250m
+      memory: "256Mi"
+    maxLimitRequestRatio:
+      cpu: lots
+  timeout: 90s
+`
+	assert.Equal(t, expected, obj.String())
+}
+
+func TestNestedDuration(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(limitRange))
+	require.NoError(t, err)
+
+	d, found, err := obj.NestedDuration("spec", "timeout")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 90*time.Second, d)
+
+	_, found, err = obj.NestedDuration("metadata", "name")
+	assert.True(t, found)
+	var unmatched *ErrUnmatchedField
+	assert.ErrorAs(t, err, &unmatched)
+
+	require.NoError(t, obj.SetNestedDuration(time.Minute+30*time.Second, "spec", "timeout"))
+	s, _, _ := obj.NestedString("spec", "timeout")
+	assert.Equal(t, "90s", s)
+
+	require.NoError(t, obj.SetNestedDuration(2*time.Minute, "spec", "timeout"))
+	s, _, _ = obj.NestedString("spec", "timeout")
+	assert.Equal(t, "2m0s", s)
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package refs
+
+import (
+	"fmt"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+// Graph is the dependency graph of a set of KubeObjects. Its edges are the
+// References from the KubeObjects to the KubeObjects they use.
+type Graph struct {
+	refs []Reference
+	// objects indexes the KubeObjects by their ResourceIdentifier.
+	objects map[fn.ResourceIdentifier]*fn.KubeObject
+}
+
+// key returns the ResourceIdentifier used to index and look up the KubeObjects.
+// The version is ignored, as a reference never pins it.
+func key(id fn.ResourceIdentifier) fn.ResourceIdentifier {
+	id.Version = ""
+	return id
+}
+
+// NewGraph extracts the References of all the KubeObjects and builds their
+// dependency graph.
+func NewGraph(items fn.KubeObjects) (*Graph, error) {
+	g := &Graph{objects: map[fn.ResourceIdentifier]*fn.KubeObject{}}
+	for _, obj := range items {
+		g.objects[key(*obj.GetId())] = obj
+	}
+	for _, obj := range items {
+		refs, err := Extract(obj)
+		if err != nil {
+			return nil, err
+		}
+		g.refs = append(g.refs, refs...)
+	}
+	return g, nil
+}
+
+// References returns all the References, in the order of the KubeObjects.
+func (g *Graph) References() []Reference {
+	return g.refs
+}
+
+// Resolve returns the target KubeObject of the Reference, or false if the
+// target is not in the graph.
+func (g *Graph) Resolve(ref Reference) (*fn.KubeObject, bool) {
+	obj, found := g.objects[key(ref.Target)]
+	return obj, found
+}
+
+// From returns the References held by the KubeObject, i.e. what it depends on.
+func (g *Graph) From(obj *fn.KubeObject) []Reference {
+	var refs []Reference
+	for _, ref := range g.refs {
+		if ref.Source == obj {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// To returns the References to the KubeObject, i.e. what depends on it.
+func (g *Graph) To(obj *fn.KubeObject) []Reference {
+	id := key(*obj.GetId())
+	var refs []Reference
+	for _, ref := range g.refs {
+		if key(ref.Target) == id {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// Dangling returns the References whose target is not in the graph. Optional
+// References are skipped.
+func (g *Graph) Dangling() []Reference {
+	var refs []Reference
+	for _, ref := range g.refs {
+		if _, found := g.Resolve(ref); !found && !ref.Optional {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// Validate returns an Error Result for every dangling Reference in the
+// KubeObjects, e.g. a Deployment using a ConfigMap which is not in the package.
+// The Result points at the referencing field.
+func Validate(items fn.KubeObjects) (fn.Results, error) {
+	g, err := NewGraph(items)
+	if err != nil {
+		return nil, err
+	}
+	var results fn.Results
+	for _, ref := range g.Dangling() {
+		msg := fmt.Sprintf("referenced %v %q is not found", ref.Target.Kind, ref.Target.Name)
+		result := fn.ConfigObjectResult(msg, ref.Source, fn.Error)
+		result.Field = &fn.Field{Path: ref.Path, CurrentValue: ref.Target.Name}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// DanglingReferences is a fn.Runner which validates that all the referenced
+// KubeObjects exist in the package, e.g.
+//
+//	fn.AsMain(fn.WithContext(ctx, &refs.DanglingReferences{}))
+type DanglingReferences struct{}
+
+var _ fn.Runner = &DanglingReferences{}
+
+func (*DanglingReferences) Run(_ *fn.Context, _ *fn.KubeObject, items fn.KubeObjects, results *fn.Results) bool {
+	res, err := Validate(items)
+	if err != nil {
+		results.ErrorE(err)
+		return false
+	}
+	*results = append(*results, res...)
+	return res.ExitCode() == 0
+}
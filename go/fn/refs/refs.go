@@ -0,0 +1,78 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package refs extracts the references between KRM resources, e.g. a Deployment
+// using a ConfigMap or a RoleBinding binding a ServiceAccount, builds a
+// dependency graph from them, and validates that the referenced resources exist.
+//
+// The references are the ones fn.Rename updates, see
+// fn.KubeObject.NameReferences:
+//   - from the workloads (Pod, Deployment, CronJob, ...): the ConfigMaps and
+//     Secrets in env, envFrom and volumes, the imagePullSecrets, the
+//     serviceAccountName, the priorityClassName and the PersistentVolumeClaims
+//     in volumes.
+//   - from StatefulSets: the serviceName.
+//   - from RoleBindings and ClusterRoleBindings: the roleRef and the
+//     ServiceAccount subjects.
+//   - from ServiceAccounts: the secrets and imagePullSecrets.
+//   - from Ingresses: the backend Services and the TLS Secrets.
+//   - from APIServices: the Service.
+//   - from PersistentVolumeClaims: the volumeName.
+//   - from HorizontalPodAutoscalers: the scaleTargetRef.
+package refs
+
+import (
+	"fmt"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+// Reference is a reference from a field of a KubeObject to another KubeObject.
+type Reference struct {
+	// Source is the KubeObject holding the reference.
+	Source *fn.KubeObject
+	// Path is the path of the referencing field in Source, e.g.
+	// `spec.template.spec.containers[name=app].envFrom[0].configMapRef.name`.
+	Path string
+	// Target identifies the referenced KubeObject. Its Namespace follows the
+	// same convention as fn.KubeObject.GetId, i.e. `default` for a namespaced
+	// target without namespace, and fn.UnknownNamespace for a cluster scoped
+	// target.
+	Target fn.ResourceIdentifier
+	// Optional tells whether the reference may be missing, e.g. a
+	// configMapKeyRef with `optional: true`.
+	Optional bool
+}
+
+func (r Reference) String() string {
+	return fmt.Sprintf("%v %v -> %v", r.Source.GetId().String(), r.Path, r.Target.String())
+}
+
+// Extract returns the References held by the KubeObject, i.e. its
+// fn.KubeObject.NameReferences, which fn.Rename also follows.
+func Extract(obj *fn.KubeObject) ([]Reference, error) {
+	nameRefs, err := obj.NameReferences()
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract the references of %v with error: %w", obj.ShortString(), err)
+	}
+	var refs []Reference
+	for _, ref := range nameRefs {
+		if ref.Target.Group == "" && ref.Target.Kind == "ServiceAccount" && ref.Target.Name == "default" {
+			// The `default` ServiceAccount is created in every namespace.
+			continue
+		}
+		refs = append(refs, Reference{Source: obj, Path: ref.Path, Target: ref.Target, Optional: ref.Optional})
+	}
+	return refs, nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package refs
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var resources = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: prod
+spec:
+  template:
+    spec:
+      serviceAccountName: app
+      containers:
+      - name: app
+        image: app
+        env:
+        - name: MODE
+          valueFrom:
+            configMapKeyRef:
+              name: app-config
+              key: mode
+        - name: DEBUG
+          valueFrom:
+            configMapKeyRef:
+              name: debug-config
+              key: debug
+              optional: true
+        envFrom:
+        - secretRef:
+            name: app-secret
+      volumes:
+      - name: config
+        configMap:
+          name: app-confgi
+      - name: data
+        persistentVolumeClaim:
+          claimName: data
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+  namespace: prod
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app-secret
+  namespace: prod
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: app
+  namespace: prod
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: app
+  namespace: prod
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: view
+subjects:
+- kind: ServiceAccount
+  name: app
+- kind: User
+  name: jane
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+  namespace: prod
+spec:
+  rules:
+  - http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: app
+            port:
+              number: 80
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: app
+  namespace: prod
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: app
+`
+
+func TestNewGraph(t *testing.T) {
+	items, err := fn.ParseKubeObjects([]byte(resources))
+	require.NoError(t, err)
+	g, err := NewGraph(items)
+	require.NoError(t, err)
+	var actual []string
+	for _, ref := range g.References() {
+		actual = append(actual, ref.String())
+	}
+	expected := []string{
+		"apps|Deployment|prod|app spec.template.spec.containers[name=app].env[0].valueFrom.configMapKeyRef.name -> |ConfigMap|prod|app-config",
+		"apps|Deployment|prod|app spec.template.spec.containers[name=app].env[1].valueFrom.configMapKeyRef.name -> |ConfigMap|prod|debug-config",
+		"apps|Deployment|prod|app spec.template.spec.containers[name=app].envFrom[0].secretRef.name -> |Secret|prod|app-secret",
+		"apps|Deployment|prod|app spec.template.spec.volumes[0].configMap.name -> |ConfigMap|prod|app-confgi",
+		"apps|Deployment|prod|app spec.template.spec.volumes[1].persistentVolumeClaim.claimName -> |PersistentVolumeClaim|prod|data",
+		"apps|Deployment|prod|app spec.template.spec.serviceAccountName -> |ServiceAccount|prod|app",
+		"rbac.authorization.k8s.io|RoleBinding|prod|app roleRef.name -> rbac.authorization.k8s.io|ClusterRole|~C|view",
+		"rbac.authorization.k8s.io|RoleBinding|prod|app subjects[0].name -> |ServiceAccount|prod|app",
+		"networking.k8s.io|Ingress|prod|app spec.rules[0].http.paths[0].backend.service.name -> |Service|prod|app",
+		"autoscaling|HorizontalPodAutoscaler|prod|app spec.scaleTargetRef.name -> apps|Deployment|prod|app",
+	}
+	assert.Equal(t, expected, actual)
+
+	deployment := items[0]
+	assert.Len(t, g.From(deployment), 6)
+	assert.Len(t, g.To(deployment), 1)
+	target, found := g.Resolve(g.References()[0])
+	assert.True(t, found)
+	assert.Equal(t, items[1], target)
+}
+
+func TestValidate(t *testing.T) {
+	items, err := fn.ParseKubeObjects([]byte(resources))
+	require.NoError(t, err)
+	results, err := Validate(items)
+	require.NoError(t, err)
+	var actual []string
+	for _, r := range results {
+		assert.Equal(t, fn.Error, r.Severity)
+		actual = append(actual, r.ResourceRef.Kind+" "+r.Field.Path+": "+r.Message)
+	}
+	expected := []string{
+		`Deployment spec.template.spec.volumes[0].configMap.name: referenced ConfigMap "app-confgi" is not found`,
+		`Deployment spec.template.spec.volumes[1].persistentVolumeClaim.claimName: referenced PersistentVolumeClaim "data" is not found`,
+		`RoleBinding roleRef.name: referenced ClusterRole "view" is not found`,
+		`Ingress spec.rules[0].http.paths[0].backend.service.name: referenced Service "app" is not found`,
+	}
+	assert.Equal(t, expected, actual)
+}
+
+func TestExtract(t *testing.T) {
+	items, err := fn.ParseKubeObjects([]byte(`apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+  namespace: prod
+spec:
+  serviceName: db
+  template:
+    spec:
+      serviceAccountName: default
+      priorityClassName: high
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: app
+  namespace: prod
+secrets:
+- name: token
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+  namespace: prod
+spec:
+  volumeName: data
+`))
+	require.NoError(t, err)
+	var actual []string
+	for _, obj := range items {
+		refs, err := Extract(obj)
+		require.NoError(t, err)
+		for _, ref := range refs {
+			actual = append(actual, ref.String())
+		}
+	}
+	expected := []string{
+		"apps|StatefulSet|prod|db spec.template.spec.priorityClassName -> scheduling.k8s.io|PriorityClass|~C|high",
+		"apps|StatefulSet|prod|db spec.serviceName -> |Service|prod|db",
+		"|ServiceAccount|prod|app secrets[0].name -> |Secret|prod|token",
+		"|PersistentVolumeClaim|prod|data spec.volumeName -> |PersistentVolume|~C|data",
+	}
+	assert.Equal(t, expected, actual)
+}
@@ -0,0 +1,305 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// nameReference is a field which refers to another object by name. The name is
+// the `name` field of the maps located by the path expression `path`. If the map
+// also has a `kind` field, e.g. a RoleBinding subject, the reference only applies
+// when it matches the target kind. A zero target means that the map tells the
+// referenced kind by its `kind` and `apiGroup` or `apiVersion` fields, e.g. a
+// RoleBinding roleRef. If the map has a `namespace` field, it overrides the
+// referrer namespace, and an `optional: true` field makes the reference optional.
+type nameReference struct {
+	target schema.GroupKind
+	path   string
+	name   string
+}
+
+var (
+	configMapGK      = schema.GroupKind{Kind: "ConfigMap"}
+	serviceGK        = schema.GroupKind{Kind: "Service"}
+	serviceAccountGK = schema.GroupKind{Kind: "ServiceAccount"}
+)
+
+// containerNameReferences are the nameReferences of every container, init
+// container and ephemeral container of the workloads.
+var containerNameReferences = []nameReference{
+	{target: configMapGK, path: "env[*].valueFrom.configMapKeyRef", name: "name"},
+	{target: secretGK, path: "env[*].valueFrom.secretKeyRef", name: "name"},
+	{target: configMapGK, path: "envFrom[*].configMapRef", name: "name"},
+	{target: secretGK, path: "envFrom[*].secretRef", name: "name"},
+}
+
+// podSpecNameReferences are the nameReferences of the PodSpec of the workloads.
+var podSpecNameReferences = []nameReference{
+	{target: configMapGK, path: "volumes[*].configMap", name: "name"},
+	{target: secretGK, path: "volumes[*].secret", name: "secretName"},
+	{target: configMapGK, path: "volumes[*].projected.sources[*].configMap", name: "name"},
+	{target: secretGK, path: "volumes[*].projected.sources[*].secret", name: "name"},
+	{target: schema.GroupKind{Kind: "PersistentVolumeClaim"}, path: "volumes[*].persistentVolumeClaim", name: "claimName"},
+	{target: secretGK, path: "imagePullSecrets[*]", name: "name"},
+	{target: serviceAccountGK, name: "serviceAccountName"},
+	{target: schema.GroupKind{Group: "scheduling.k8s.io", Kind: "PriorityClass"}, name: "priorityClassName"},
+}
+
+// objectNameReferences are the nameReferences of the other kinds, by referrer
+// kind. Together with the workload ones, they follow the kustomize nameReference
+// configuration.
+var objectNameReferences = func() map[schema.GroupKind][]nameReference {
+	bindingRefs := []nameReference{
+		{path: "roleRef", name: "name"},
+		{target: serviceAccountGK, path: "subjects[*]", name: "name"},
+	}
+	ingressRefs := []nameReference{
+		// networking.k8s.io/v1
+		{target: serviceGK, path: "spec.defaultBackend.service", name: "name"},
+		{target: serviceGK, path: "spec.rules[*].http.paths[*].backend.service", name: "name"},
+		// extensions/v1beta1 and networking.k8s.io/v1beta1
+		{target: serviceGK, path: "spec.backend", name: "serviceName"},
+		{target: serviceGK, path: "spec.rules[*].http.paths[*].backend", name: "serviceName"},
+		{target: secretGK, path: "spec.tls[*]", name: "secretName"},
+	}
+	return map[schema.GroupKind][]nameReference{
+		{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}:        bindingRefs,
+		{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}: bindingRefs,
+		{Group: "networking.k8s.io", Kind: "Ingress"}:                    ingressRefs,
+		{Group: "extensions", Kind: "Ingress"}:                           ingressRefs,
+		{Kind: "ServiceAccount"}: {
+			{target: secretGK, path: "imagePullSecrets[*]", name: "name"},
+			{target: secretGK, path: "secrets[*]", name: "name"},
+		},
+		{Group: "apps", Kind: "StatefulSet"}: {
+			{target: serviceGK, path: "spec", name: "serviceName"},
+		},
+		{Group: "apiregistration.k8s.io", Kind: "APIService"}: {
+			{target: serviceGK, path: "spec.service", name: "name"},
+		},
+		{Kind: "PersistentVolumeClaim"}: {
+			{target: schema.GroupKind{Kind: "PersistentVolume"}, path: "spec", name: "volumeName"},
+		},
+		{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"}: {
+			{path: "spec.scaleTargetRef", name: "name"},
+		},
+	}
+}()
+
+// NameReference is a field of a KubeObject which refers to another KubeObject
+// by name.
+type NameReference struct {
+	// Path is the path of the referencing field, e.g.
+	// `spec.template.spec.containers[name=app].envFrom[0].configMapRef.name`.
+	Path string
+	// Target identifies the referenced KubeObject. Its Namespace follows the
+	// same convention as GetId, i.e. `default` for a namespaced target without
+	// namespace, and UnknownNamespace for a cluster scoped target.
+	Target ResourceIdentifier
+	// Optional tells whether the reference may be missing, e.g. a
+	// configMapKeyRef with `optional: true`.
+	Optional bool
+
+	// parent is the map holding the field.
+	parent *SubObject
+	field  string
+}
+
+// NameReferences returns the fields of the KubeObject which refer to other
+// KubeObjects by name, e.g. the ConfigMaps and Secrets of the workload
+// containers and volumes, the roleRef and ServiceAccount subjects of the
+// RoleBindings or the backends of the Ingresses. It uses the same name
+// reference rules as kustomize uses for the name prefixes and suffixes, and
+// Rename updates the same fields.
+func (o *KubeObject) NameReferences() ([]NameReference, error) {
+	var refs []NameReference
+	add := func(parent *SubObject, rules []nameReference) error {
+		for _, rule := range rules {
+			found, err := o.nameReferences(parent, rule)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, found...)
+		}
+		return nil
+	}
+	err := o.VisitContainers(func(container *SubObject, _ ContainerKind) error {
+		return add(container, containerNameReferences)
+	})
+	if err != nil {
+		return nil, err
+	}
+	podSpec, found, err := o.PodSpec()
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if err := add(podSpec, podSpecNameReferences); err != nil {
+			return nil, err
+		}
+	}
+	if err := add(&o.SubObject, objectNameReferences[o.GroupKind()]); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// nameReferences returns the NameReferences matched by the rule under root.
+func (o *KubeObject) nameReferences(root *SubObject, rule nameReference) ([]NameReference, error) {
+	parents := SliceSubObjects{root}
+	if rule.path != "" {
+		var err error
+		if parents, err = root.GetPath(rule.path); err != nil {
+			return nil, err
+		}
+	}
+	var refs []NameReference
+	for _, parent := range parents {
+		if !parent.IsMap() {
+			continue
+		}
+		name, _, err := parent.NestedString(rule.name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			continue
+		}
+		target := rule.target
+		kind, found, _ := parent.NestedString("kind")
+		switch {
+		case target.Empty():
+			if !found {
+				continue
+			}
+			target.Kind = kind
+			if group, found, _ := parent.NestedString("apiGroup"); found {
+				target.Group = group
+			} else if apiVersion, found, _ := parent.NestedString("apiVersion"); found {
+				target.Group, _ = ParseGroupVersion(apiVersion)
+			}
+		case found && kind != target.Kind:
+			// e.g. a RoleBinding subject which is a User.
+			continue
+		}
+		namespace, found, _ := parent.NestedString("namespace")
+		if !found || namespace == "" {
+			namespace = o.effectiveNamespace()
+		}
+		if o.scopes.Scope(target.WithVersion("")) == ClusterScoped {
+			namespace = UnknownNamespace
+		}
+		optional, _, err := parent.NestedBool("optional")
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, NameReference{
+			Path:     joinFieldPath(parent.FieldPath(), rule.name),
+			Target:   ResourceIdentifier{Group: target.Group, Kind: target.Kind, Namespace: namespace, Name: name},
+			Optional: optional,
+			parent:   parent,
+			field:    rule.name,
+		})
+	}
+	return refs, nil
+}
+
+// ObjectFieldChange is a FieldChange in a given KubeObject.
+type ObjectFieldChange struct {
+	Object *KubeObject
+	FieldChange
+}
+
+// Rename sets the name of the target KubeObject to newName, and updates every
+// field of the items which refers to the target by name, e.g. the ConfigMap
+// volumes and envFrom of the workloads, the roleRef and subjects of the
+// RoleBindings or the backends of the Ingresses. It uses the same name
+// reference rules as kustomize uses for the name prefixes and suffixes, see
+// KubeObject.NameReferences. Only the references from the same namespace are updated, unless the target is cluster
+// scoped. It returns the changed fields, starting with `metadata.name` of target.
+// If a field can't be written, e.g. because it is locked (see FieldLock), the
+// renamed fields are restored and the error is returned.
+func Rename(items KubeObjects, target *KubeObject, newName string) ([]ObjectFieldChange, error) {
+	oldName := target.GetName()
+	if newName == "" {
+		return nil, fmt.Errorf("unable to rename %v: the new name is empty", target.ShortString())
+	}
+	if newName == oldName {
+		return nil, nil
+	}
+	targetGK := target.GroupKind()
+	targetNamespace := target.effectiveNamespace()
+	for _, obj := range items {
+		if obj != target && obj.GroupKind() == targetGK && obj.effectiveNamespace() == targetNamespace && obj.GetName() == newName {
+			return nil, fmt.Errorf("unable to rename %v: %v already exists", target.ShortString(), obj.ShortString())
+		}
+	}
+
+	// Find all the references before changing anything, so that an invalid
+	// referrer fails the rename before any change.
+	type reference struct {
+		obj *KubeObject
+		NameReference
+	}
+	var references []reference
+	clusterScoped := target.Scope() == ClusterScoped
+	for _, obj := range items {
+		refs, err := obj.NameReferences()
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			if ref.Target.Group != targetGK.Group || ref.Target.Kind != targetGK.Kind || ref.Target.Name != oldName {
+				continue
+			}
+			if !clusterScoped && ref.Target.Namespace != targetNamespace {
+				continue
+			}
+			references = append(references, reference{obj: obj, NameReference: ref})
+		}
+	}
+
+	if err := target.SetName(newName); err != nil {
+		return nil, err
+	}
+	changes := []ObjectFieldChange{{
+		Object:      target,
+		FieldChange: FieldChange{Type: FieldModified, Path: "metadata.name", OldValue: oldName, NewValue: newName},
+	}}
+	for i, ref := range references {
+		if err := ref.parent.SetNestedString(newName, ref.field); err != nil {
+			// Restore the renamed fields, e.g. when a field is locked, so that
+			// the items are not left half renamed.
+			for _, done := range references[:i] {
+				_ = done.parent.SetNestedString(oldName, done.field)
+			}
+			_ = target.SetName(oldName)
+			return nil, err
+		}
+		changes = append(changes, ObjectFieldChange{
+			Object: ref.obj,
+			FieldChange: FieldChange{
+				Type:     FieldModified,
+				Path:     ref.Path,
+				OldValue: oldName,
+				NewValue: newName,
+			},
+		})
+	}
+	return changes, nil
+}
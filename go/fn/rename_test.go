@@ -0,0 +1,176 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var renameResources = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: app
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      serviceAccountName: app
+      containers:
+      - name: app
+        image: app
+        envFrom:
+        - configMapRef:
+            name: config
+      volumes:
+      - name: config
+        configMap:
+          name: config
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: app
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: app
+subjects:
+- kind: ServiceAccount
+  name: app
+  namespace: default
+- kind: User
+  name: app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: other
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: other
+  namespace: other
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app
+        envFrom:
+        - configMapRef:
+            name: config
+`
+
+func TestRename(t *testing.T) {
+	testcases := map[string]struct {
+		target   int
+		newName  string
+		expected []string
+	}{
+		"config map": {
+			target:  0,
+			newName: "prefix-config",
+			expected: []string{
+				"ConfigMap/prefix-config metadata.name",
+				"Deployment/app spec.template.spec.containers[name=app].envFrom[0].configMapRef.name",
+				"Deployment/app spec.template.spec.volumes[0].configMap.name",
+			},
+		},
+		"service account": {
+			target:  1,
+			newName: "prefix-app",
+			expected: []string{
+				"ServiceAccount/prefix-app metadata.name",
+				"Deployment/app spec.template.spec.serviceAccountName",
+				"ClusterRoleBinding/app subjects[0].name",
+			},
+		},
+		"config map in another namespace": {
+			target:  4,
+			newName: "prefix-config",
+			expected: []string{
+				"ConfigMap/prefix-config metadata.name",
+				"Deployment/other spec.template.spec.containers[name=app].envFrom[0].configMapRef.name",
+			},
+		},
+		"same name": {
+			target:  0,
+			newName: "config",
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			items, err := ParseKubeObjects([]byte(renameResources))
+			require.NoError(t, err)
+			changes, err := Rename(items, items[tc.target], tc.newName)
+			require.NoError(t, err)
+			var actual []string
+			for _, c := range changes {
+				actual = append(actual, c.Object.GetKind()+"/"+c.Object.GetName()+" "+c.Path)
+				assert.Equal(t, tc.newName, c.NewValue)
+				matches, err := c.Object.GetPath(c.Path)
+				require.NoError(t, err)
+				require.Len(t, matches, 1)
+				var value string
+				require.NoError(t, matches[0].As(&value))
+				assert.Equal(t, tc.newName, value)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestRenameErrors(t *testing.T) {
+	items, err := ParseKubeObjects([]byte(renameResources + `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: taken
+`))
+	require.NoError(t, err)
+	_, err = Rename(items, items[0], "")
+	assert.ErrorContains(t, err, "the new name is empty")
+
+	// The other Deployment is in another namespace.
+	_, err = Rename(items, items[2], "other")
+	assert.NoError(t, err)
+
+	_, err = Rename(items, items[0], "taken")
+	assert.ErrorContains(t, err, "already exists")
+	assert.Equal(t, "config", items[0].GetName())
+
+	// The envFrom is renamed before the locked volume fails the rename.
+	require.NoError(t, items[2].SetAnnotation(LockedFieldsAnnotation, "spec.template.spec.volumes"))
+	before := items[2].String()
+	_, err = Rename(items, items[0], "renamed")
+	var lockErr *ErrLockedField
+	assert.ErrorAs(t, err, &lockErr)
+	assert.Equal(t, "config", items[0].GetName())
+	assert.Equal(t, before, items[2].String())
+}
@@ -56,31 +56,99 @@ type ResourceList struct {
 	// Validating functions can optionally use this field to communicate structured
 	// validation error data to downstream functions.
 	Results Results `yaml:"results,omitempty" json:"results,omitempty"`
+
+	// index is the KubeObjectIndex of Items, see itemIndex.
+	index *KubeObjectIndex
+	// indexed identifies the Items slice the index holds.
+	indexed itemsSlice
+}
+
+// itemsSlice identifies the backing array and the length of a KubeObjects
+// slice.
+type itemsSlice struct {
+	array **KubeObject
+	len   int
+}
+
+func itemsSliceOf(items KubeObjects) itemsSlice {
+	if cap(items) == 0 {
+		return itemsSlice{}
+	}
+	return itemsSlice{array: &items[:1][0], len: len(items)}
+}
+
+// itemIndex returns a KubeObjectIndex of the items. It follows the items added
+// or replaced by UpsertObjectToItems, and the items appended to Items. It is
+// rebuilt when Items is otherwise changed, e.g. reassigned or filtered. The
+// items are not compared on each call, which would make a loop of
+// UpsertObjectToItems quadratic: an item replaced or moved in place, e.g. by
+// `rl.Items[0] = obj`, is only seen when the index is dropped, see dropIndex.
+func (rl *ResourceList) itemIndex() *KubeObjectIndex {
+	current := itemsSliceOf(rl.Items)
+	if rl.index != nil && current == rl.indexed {
+		return rl.index
+	}
+	if rl.index != nil && current.array == rl.indexed.array && current.len > rl.indexed.len {
+		for _, obj := range rl.Items[rl.indexed.len:] {
+			rl.index.Add(obj)
+		}
+		rl.indexed = current
+		return rl.index
+	}
+	if rl.index != nil {
+		rl.index.Close()
+	}
+	rl.index = NewKubeObjectIndex(rl.Items)
+	rl.indexed = current
+	return rl.index
+}
+
+// dropIndex drops the KubeObjectIndex of the items, e.g. once they are
+// reordered in place.
+func (rl *ResourceList) dropIndex() {
+	if rl.index != nil {
+		rl.index.Close()
+	}
+	rl.index = nil
 }
 
 // CheckResourceDuplication checks the GVKNN of resourceList.items to make sure they are unique. It returns errors if
 // found more than one resource having the same GVKNN.
 func CheckResourceDuplication(rl *ResourceList) error {
-	idMap := map[yaml.ResourceIdentifier]struct{}{}
+	x := rl.itemIndex()
 	for _, obj := range rl.Items {
 		id := obj.resourceIdentifier()
-		if _, ok := idMap[*id]; ok {
-			return fmt.Errorf("duplicate Resource(apiVersion=%v, kind=%v, Namespace=%v, Name=%v)",
-				obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName())
+		for _, other := range x.byIdentifier(*obj.GetId()) {
+			if other == obj {
+				break
+			}
+			if reflect.DeepEqual(id, other.resourceIdentifier()) {
+				return fmt.Errorf("duplicate Resource(apiVersion=%v, kind=%v, Namespace=%v, Name=%v)",
+					obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName())
+			}
 		}
-		idMap[*id] = struct{}{}
 	}
 	return nil
 }
 
 // ParseResourceList parses a ResourceList from the input byte array. This function can be used to parse either KRM fn input
-// or KRM fn output
+// or KRM fn output, in YAML or JSON, with the default ParseOptions.
 func ParseResourceList(in []byte) (*ResourceList, error) {
+	return ParseResourceListWithOptions(in, ParseOptions{})
+}
+
+// ParseResourceListWithOptions parses a ResourceList from the input byte array.
+// It returns an ErrUnsafeInput if the input is rejected by the ParseOptions.
+func ParseResourceListWithOptions(in []byte, opts ParseOptions) (*ResourceList, error) {
 	rl := &ResourceList{}
-	rlObj, err := ParseKubeObject(in)
+	rlObjs, err := ParseKubeObjectsWithOptions(in, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse input bytes: %w", err)
 	}
+	if len(rlObjs) != 1 {
+		return nil, fmt.Errorf("failed to parse input bytes: expected exactly one object, got %d", len(rlObjs))
+	}
+	rlObj := rlObjs[0]
 	if rlObj.GetKind() != kio.ResourceListKind {
 		return nil, fmt.Errorf("input was of unexpected kind %q; expected ResourceList", rlObj.GetKind())
 	}
@@ -105,9 +173,18 @@ func ParseResourceList(in []byte) (*ResourceList, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to extract objects from items: %w", err)
 		}
+		if err := opts.checkItems(len(objectItems)); err != nil {
+			return nil, fmt.Errorf("failed to parse input bytes: %w", err)
+		}
 		for i := range objectItems {
-			rl.Items = append(rl.Items, asKubeObject(objectItems[i]))
+			item := asKubeObject(objectItems[i])
+			rl.Items = append(rl.Items, item)
 		}
+		// Let the items know the scope of the custom resources defined in the ResourceList. A malformed CRD
+		// should not fail the parsing, its custom resources just have an unknown scope.
+		scopes := NewScopeResolver()
+		_ = scopes.AddCRDs(rl.Items)
+		rl.Items.SetScopeResolver(scopes)
 	}
 
 	// Parse Results. Results can be empty.
@@ -129,7 +206,7 @@ func ParseResourceList(in []byte) (*ResourceList, error) {
 // toYNode converts the ResourceList to the yaml.Node representation.
 func (rl *ResourceList) toYNode() (*yaml.Node, error) {
 	reMap := internal.NewMap(nil)
-	reObj := &KubeObject{SubObject{obj: reMap, parentGVK: schema.GroupVersionKind{}, fieldpath: ""}}
+	reObj := newKubeObject(SubObject{obj: reMap, parentGVK: schema.GroupVersionKind{}, fieldpath: ""})
 	if err := reObj.SetAPIVersion(kio.ResourceListAPIVersion); err != nil {
 		return nil, err
 	}
@@ -154,7 +231,7 @@ func (rl *ResourceList) toYNode() (*yaml.Node, error) {
 
 	if rl.Results != nil && len(rl.Results) > 0 {
 		resultsSlice := internal.NewSliceVariant()
-		for _, result := range rl.Results {
+		for _, result := range rl.Results.redacted(rl.secretRedactor()) {
 			mv, err := internal.TypedObjectToMapVariant(result)
 			if err != nil {
 				return nil, err
@@ -169,8 +246,16 @@ func (rl *ResourceList) toYNode() (*yaml.Node, error) {
 	return reMap.Node(), nil
 }
 
-// ToYAML converts the ResourceList to yaml.
+// ToYAML converts the ResourceList to yaml, with the default OutputOptions.
 func (rl *ResourceList) ToYAML() ([]byte, error) {
+	return rl.ToYAMLWithOptions(OutputOptions{})
+}
+
+// ToYAMLWithOptions converts the ResourceList to yaml with the OutputOptions.
+func (rl *ResourceList) ToYAMLWithOptions(opts OutputOptions) ([]byte, error) {
+	if opts.PreserveFormat {
+		return rl.toPreservedYAML()
+	}
 	// Sort the resources first.
 	rl.Sort()
 	ynode, err := rl.toYNode()
@@ -181,22 +266,34 @@ func (rl *ResourceList) ToYAML() ([]byte, error) {
 	return doc.ToYAML()
 }
 
+// ToJSON converts the ResourceList to JSON. The items are sorted like ToYAML
+// does.
+func (rl *ResourceList) ToJSON() ([]byte, error) {
+	return rl.toJSON(OutputOptions{})
+}
+
+// toJSON converts the ResourceList to JSON, keeping the order of the items if
+// the OutputOptions preserve the format.
+func (rl *ResourceList) toJSON(opts OutputOptions) ([]byte, error) {
+	if !opts.PreserveFormat {
+		rl.Sort()
+	}
+	ynode, err := rl.toYNode()
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewDoc(ynode).ToJSON()
+}
+
 // Sort sorts the ResourceList.items by apiVersion, kind, namespace and name.
 func (rl *ResourceList) Sort() {
 	sort.Sort(rl.Items)
+	rl.dropIndex()
 }
 
 // UpsertObjectToItems adds an object to ResourceList.items. The input object can
 // be a KubeObject or any typed object (e.g. corev1.Pod).
 func (rl *ResourceList) UpsertObjectToItems(obj interface{}, checkExistence func(obj, another *KubeObject) bool, replaceIfAlreadyExist bool) error {
-	if checkExistence == nil {
-		checkExistence = func(obj, another *KubeObject) bool {
-			ri1 := obj.resourceIdentifier()
-			ri2 := another.resourceIdentifier()
-			return reflect.DeepEqual(ri1, ri2)
-		}
-	}
-
 	var ko *KubeObject
 	switch obj := obj.(type) {
 	case KubeObject:
@@ -218,6 +315,39 @@ func (rl *ResourceList) UpsertObjectToItems(obj interface{}, checkExistence func
 			return err
 		}
 	}
+	// A new object knows the scopes of the custom resources defined in the
+	// ResourceList, like the parsed items.
+	if ko.scopes == nil {
+		ko.scopes = rl.Items.scopeResolver()
+	}
+	// It is protected by the FieldLocks of the items.
+	if ko.locks == nil {
+		ko.locks = rl.Items.fieldLocks()
+	}
+
+	if checkExistence == nil {
+		// The items with the same GVKNN are looked up in the index.
+		x := rl.itemIndex()
+		ri := ko.resourceIdentifier()
+		for _, item := range x.byIdentifier(*ko.GetId()) {
+			if i := x.position[item]; i >= len(rl.Items) || rl.Items[i] != item {
+				// The items have been changed in place.
+				rl.dropIndex()
+				return rl.UpsertObjectToItems(ko, nil, replaceIfAlreadyExist)
+			}
+			if reflect.DeepEqual(ri, item.resourceIdentifier()) {
+				if replaceIfAlreadyExist {
+					rl.Items[x.position[item]] = ko
+					x.replace(item, ko)
+				}
+				return nil
+			}
+		}
+		rl.Items = append(rl.Items, ko)
+		x.Add(ko)
+		rl.indexed = itemsSliceOf(rl.Items)
+		return nil
+	}
 
 	idx := -1
 	for i, item := range rl.Items {
@@ -15,9 +15,12 @@
 package fn
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var dupResourceInput = []byte(`
@@ -78,3 +81,113 @@ results:
 		t.Fatalf("unexpected diff: %v", cmp.Diff(expected, rl.Results))
 	}
 }
+
+func TestUpsertObjectToItems(t *testing.T) {
+	rl, err := ParseResourceList([]byte(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: a
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: b
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap := func(name, value string) *KubeObject {
+		obj := NewEmptyKubeObject()
+		_ = obj.SetAPIVersion("v1")
+		_ = obj.SetKind("ConfigMap")
+		_ = obj.SetName(name)
+		_ = obj.SetNestedString(value, "data", "value")
+		return obj
+	}
+	names := func() []string {
+		var names []string
+		for _, obj := range rl.Items {
+			value, _, _ := obj.NestedString("data", "value")
+			names = append(names, obj.GetName()+"="+value)
+		}
+		return names
+	}
+	steps := []struct {
+		upsert   func() error
+		expected []string
+	}{
+		{
+			upsert:   func() error { return rl.UpsertObjectToItems(configMap("c", "new"), nil, false) },
+			expected: []string{"a=", "b=", "c=new"},
+		},
+		{
+			upsert:   func() error { return rl.UpsertObjectToItems(configMap("a", "replaced"), nil, true) },
+			expected: []string{"a=replaced", "b=", "c=new"},
+		},
+		{
+			// The index knows the items renamed with their setters.
+			upsert: func() error {
+				if err := rl.Items[1].SetName("d"); err != nil {
+					return err
+				}
+				return rl.UpsertObjectToItems(configMap("d", "kept"), nil, false)
+			},
+			expected: []string{"a=replaced", "d=", "c=new"},
+		},
+		{
+			// The items changed directly are re-indexed.
+			upsert: func() error {
+				rl.Items = rl.Items[:1]
+				return rl.UpsertObjectToItems(configMap("d", "added"), nil, false)
+			},
+			expected: []string{"a=replaced", "d=added"},
+		},
+	}
+	for i, step := range steps {
+		if err := step.upsert(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if diff := cmp.Diff(step.expected, names()); diff != "" {
+			t.Errorf("step %d: unexpected items (-want, +got): %s", i, diff)
+		}
+	}
+	rl.Items = append(rl.Items, configMap("a", "duplicate"))
+	if err := CheckResourceDuplication(rl); err == nil {
+		t.Errorf("expect to received duplicate error: got nil")
+	}
+}
+
+func TestUpsertObjectToItemsIndex(t *testing.T) {
+	rl := &ResourceList{}
+	configMap := func(name string) *KubeObject {
+		obj := NewEmptyKubeObject()
+		require.NoError(t, obj.SetAPIVersion("v1"))
+		require.NoError(t, obj.SetKind("ConfigMap"))
+		require.NoError(t, obj.SetName(name))
+		return obj
+	}
+	require.NoError(t, rl.UpsertObjectToItems(configMap("a"), nil, false))
+	index := rl.index
+	// The index follows the added items and the items appended to Items.
+	for i := 0; i < 100; i++ {
+		require.NoError(t, rl.UpsertObjectToItems(configMap(fmt.Sprintf("cm-%d", i)), nil, false))
+	}
+	rl.Items = append(rl.Items, configMap("appended"))
+	require.NoError(t, rl.UpsertObjectToItems(configMap("appended"), nil, false))
+	assert.Same(t, index, rl.index)
+	assert.Len(t, rl.Items, 102)
+
+	// The items moved in place are found again.
+	rl.Items[0], rl.Items[1] = rl.Items[1], rl.Items[0]
+	replaced := configMap("a")
+	require.NoError(t, rl.UpsertObjectToItems(replaced, nil, true))
+	assert.Same(t, replaced, rl.Items[1])
+	assert.Equal(t, "cm-0", rl.Items[0].GetName())
+
+	rl.Sort()
+	require.NoError(t, rl.UpsertObjectToItems(configMap("cm-50"), nil, false))
+	assert.Len(t, rl.Items, 102)
+}
@@ -69,6 +69,7 @@ func (i Result) Error() string {
 
 // String provides a human-readable message for the result item
 func (i Result) String() string {
+	i = i.redacted(currentSecretRedactor())
 	identifier := i.ResourceRef
 	var idStringList []string
 	if identifier != nil {
@@ -19,15 +19,37 @@ import (
 	"io"
 	"os"
 
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
 	"sigs.k8s.io/kustomize/kyaml/errors"
 	"sigs.k8s.io/kustomize/kyaml/kio"
 )
 
+// RunOption is an optional argument of AsMain, Run and Execute, either
+// ParseOptions or OutputOptions. The last one of each type wins.
+type RunOption interface {
+	applyTo(r *runOptions)
+}
+
+type runOptions struct {
+	parse  ParseOptions
+	output OutputOptions
+}
+
+func runOptionsOf(opts []RunOption) runOptions {
+	var r runOptions
+	for _, opt := range opts {
+		opt.applyTo(&r)
+	}
+	return r
+}
+
 // AsMain evaluates the ResourceList from STDIN to STDOUT.
 // `input` can be
 // - a `ResourceListProcessor` which implements `Process` method
 // - a function `Runner` which implements `Run` method
-func AsMain(input interface{}) error {
+// The optional ParseOptions harden the parsing of the input, and the optional
+// OutputOptions tell how the ResourceList is written.
+func AsMain(input interface{}, opts ...RunOption) error {
 	err := func() error {
 		var p ResourceListProcessor
 		switch input := input.(type) {
@@ -42,7 +64,7 @@ func AsMain(input interface{}) error {
 		if err != nil {
 			return fmt.Errorf("unable to read from stdin: %v", err)
 		}
-		out, err := Run(p, in)
+		out, err := Run(p, in, opts...)
 		// If there is an error, we don't return the error immediately.
 		// We write out to stdout before returning any error.
 		_, outErr := os.Stdout.Write(out)
@@ -57,9 +79,11 @@ func AsMain(input interface{}) error {
 	return err
 }
 
-// Run evaluates the function. input must be a resourceList in yaml format. An
-// updated resourceList will be returned.
-func Run(p ResourceListProcessor, input []byte) ([]byte, error) {
+// Run evaluates the function. input must be a resourceList in yaml or json
+// format. An updated resourceList will be returned, in the format of the input.
+// An input rejected by the optional ParseOptions returns a resourceList with the
+// error Result. The optional OutputOptions tell how the resourceList is written.
+func Run(p ResourceListProcessor, input []byte, opts ...RunOption) ([]byte, error) {
 	switch input := p.(type) {
 	case runnerProcessor:
 		p = input
@@ -68,12 +92,26 @@ func Run(p ResourceListProcessor, input []byte) ([]byte, error) {
 	default:
 		return nil, fmt.Errorf("unknown input type %T", input)
 	}
-	rl, err := ParseResourceList(input)
+	asJSON := internal.IsJSON(input)
+	options := runOptionsOf(opts)
+	output := options.output
+	rl, err := ParseResourceListWithOptions(input, options.parse)
 	if err != nil {
+		if isUnsafeInput(err) {
+			// Report the rejected input as a Result, the function is not run.
+			rl = &ResourceList{FunctionConfig: NewEmptyKubeObject(), Results: Results{ErrorResult(err)}}
+			out, yamlErr := rl.encode(asJSON, output)
+			if yamlErr != nil {
+				return nil, yamlErr
+			}
+			return out, err
+		}
 		return nil, err
 	}
+	// The messages redact the Secret values of the current ResourceList.
+	redactSecretsOf(rl)
 	success, fnErr := p.Process(rl)
-	out, yamlErr := rl.ToYAML()
+	out, yamlErr := rl.encode(asJSON, output)
 	if yamlErr != nil {
 		return out, yamlErr
 	}
@@ -86,9 +124,21 @@ func Run(p ResourceListProcessor, input []byte) ([]byte, error) {
 	return out, nil
 }
 
-func Execute(p ResourceListProcessor, r io.Reader, w io.Writer) error {
+// encode converts the ResourceList to JSON or YAML.
+func (rl *ResourceList) encode(asJSON bool, opts OutputOptions) ([]byte, error) {
+	if asJSON {
+		return rl.toJSON(opts)
+	}
+	return rl.ToYAMLWithOptions(opts)
+}
+
+// Execute evaluates the ResourceList read from r, and writes the updated
+// ResourceList to w. The optional ParseOptions harden the parsing of the input,
+// and the optional OutputOptions tell how the output is written.
+func Execute(p ResourceListProcessor, r io.Reader, w io.Writer, opts ...RunOption) error {
+	options := runOptionsOf(opts)
 	rw := &byteReadWriter{
-		kio.ByteReadWriter{
+		ByteReadWriter: kio.ByteReadWriter{
 			Reader: r,
 			Writer: w,
 			// We should not set the id annotation in the function, since we should not
@@ -98,6 +148,8 @@ func Execute(p ResourceListProcessor, r io.Reader, w io.Writer) error {
 			// orchestrator (e.g. kpt) may need them.
 			KeepReaderAnnotations: true,
 		},
+		parse:  options.parse,
+		output: options.output,
 	}
 	return execute(p, rw)
 }
@@ -106,8 +158,17 @@ func execute(p ResourceListProcessor, rw *byteReadWriter) error {
 	// Read the input
 	rl, err := rw.Read()
 	if err != nil {
+		if isUnsafeInput(err) {
+			// Report the rejected input as a Result, the function is not run.
+			rw.WrappingKind = kio.ResourceListKind
+			rw.WrappingAPIVersion = kio.ResourceListAPIVersion
+			if err := rw.Write(&ResourceList{FunctionConfig: NewEmptyKubeObject(), Results: Results{ErrorResult(err)}}); err != nil {
+				return errors.WrapPrefixf(err, "failed to write ResourceList output")
+			}
+		}
 		return errors.WrapPrefixf(err, "failed to read ResourceList input")
 	}
+	redactSecretsOf(rl)
 	success, fnErr := p.Process(rl)
 	// Write the output
 	if err := rw.Write(rl); err != nil {
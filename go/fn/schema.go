@@ -0,0 +1,323 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/kustomize/kyaml/openapi"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// SchemaSource provides the OpenAPI schemas used by ValidateSchema.
+type SchemaSource interface {
+	// SchemaFor returns the OpenAPI schema of the given kind, or nil if the kind
+	// is unknown to the SchemaSource.
+	SchemaFor(gvk schema.GroupVersionKind) *spec.Schema
+}
+
+// BuiltinSchemas returns the SchemaSource of the built-in Kubernetes kinds. The
+// schemas are embedded in the binary, so no cluster access is needed.
+func BuiltinSchemas() SchemaSource {
+	return builtinSchemas{}
+}
+
+type builtinSchemas struct{}
+
+func (builtinSchemas) SchemaFor(gvk schema.GroupVersionKind) *spec.Schema {
+	rs := openapi.SchemaForResourceType(yaml.TypeMeta{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind})
+	if rs.IsMissingOrNull() {
+		return nil
+	}
+	return rs.Schema
+}
+
+// SchemaSources combines multiple SchemaSources. The schema is taken from the
+// first SchemaSource which knows the kind, e.g.
+//
+//	crds, err := fn.CRDSchemas(rl.Items)
+//	...
+//	results := fn.ValidateSchema(obj, fn.SchemaSources(crds, fn.BuiltinSchemas()))
+func SchemaSources(sources ...SchemaSource) SchemaSource {
+	return multiSchemaSource(sources)
+}
+
+type multiSchemaSource []SchemaSource
+
+func (m multiSchemaSource) SchemaFor(gvk schema.GroupVersionKind) *spec.Schema {
+	for _, source := range m {
+		if source == nil {
+			continue
+		}
+		if s := source.SchemaFor(gvk); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// CRDSchemas returns the SchemaSource of the custom resources defined by the
+// CustomResourceDefinitions in the KubeObjects, e.g. the CRDs in ResourceList.Items.
+// Both apiextensions.k8s.io/v1 and v1beta1 CRDs are supported.
+func CRDSchemas(items KubeObjects) (SchemaSource, error) {
+	schemas := crdSchemas{}
+	for _, crd := range items.Where(IsGroupKind(schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"})) {
+		if err := schemas.add(crd); err != nil {
+			return nil, fmt.Errorf("unable to read the schema of %v with error: %w", crd.ShortString(), err)
+		}
+	}
+	return schemas, nil
+}
+
+type crdSchemas map[schema.GroupVersionKind]*spec.Schema
+
+func (c crdSchemas) SchemaFor(gvk schema.GroupVersionKind) *spec.Schema {
+	return c[gvk]
+}
+
+func (c crdSchemas) add(crd *KubeObject) error {
+	group, _, err := crd.NestedString("spec", "group")
+	if err != nil {
+		return err
+	}
+	kind, _, err := crd.NestedString("spec", "names", "kind")
+	if err != nil {
+		return err
+	}
+	// v1beta1 CRDs may have a single schema for all the versions.
+	var common *spec.Schema
+	if s, found, err := crd.NestedSubObject("spec", "validation", "openAPIV3Schema"); err != nil {
+		return err
+	} else if found {
+		if common, err = toSchema(&s); err != nil {
+			return err
+		}
+	}
+	if version, found, _ := crd.NestedString("spec", "version"); found && common != nil {
+		c[schema.GroupVersionKind{Group: group, Version: version, Kind: kind}] = common
+	}
+	versions, _, err := crd.NestedSlice("spec", "versions")
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		version, _, err := v.NestedString("name")
+		if err != nil {
+			return err
+		}
+		versionSchema := common
+		if s, found, err := v.NestedSubObject("schema", "openAPIV3Schema"); err != nil {
+			return err
+		} else if found {
+			if versionSchema, err = toSchema(&s); err != nil {
+				return err
+			}
+		}
+		if versionSchema != nil {
+			c[schema.GroupVersionKind{Group: group, Version: version, Kind: kind}] = versionSchema
+		}
+	}
+	return nil
+}
+
+func toSchema(o *SubObject) (*spec.Schema, error) {
+	var v interface{}
+	if err := o.obj.Node().Decode(&v); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := &spec.Schema{}
+	if err := s.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ValidateSchema validates the KubeObject against its OpenAPI schema from
+// source, or from BuiltinSchemas if source is nil. It reports unknown fields,
+// fields of the wrong type, missing required fields and values not allowed by an
+// enum as Error Results, with the ResourceRef, the File and the Field.Path
+// filled in. It returns no Results if the schema of the kind is unknown.
+func ValidateSchema(obj *KubeObject, source SchemaSource) Results {
+	if source == nil {
+		source = BuiltinSchemas()
+	}
+	s := source.SchemaFor(obj.GroupVersionKind())
+	if s == nil {
+		return nil
+	}
+	v := &schemaValidator{obj: obj}
+	v.validate("", obj.obj.Node(), s)
+	return v.results
+}
+
+// schemaValidator collects the Results of validating a KubeObject.
+type schemaValidator struct {
+	obj     *KubeObject
+	results Results
+}
+
+func (v *schemaValidator) addResult(path, msg string, value interface{}) {
+	result := ConfigObjectResult(msg, v.obj, Error)
+	result.Field = &Field{Path: path, CurrentValue: value}
+	v.results = append(v.results, result)
+}
+
+func (v *schemaValidator) validate(path string, node *yaml.Node, s *spec.Schema) {
+	s, quantity := resolveSchema(s)
+	if s == nil {
+		return
+	}
+	// The aliases and the merge keys are validated by their values.
+	node = internal.ResolveAlias(node)
+	// Null means the field is not set.
+	if node.Kind == yaml.ScalarNode && node.Tag == yaml.NodeTagNull {
+		return
+	}
+	preserveUnknown, _ := s.Extensions.GetBool("x-kubernetes-preserve-unknown-fields")
+	intOrString, _ := s.Extensions.GetBool("x-kubernetes-int-or-string")
+
+	var expected []string
+	switch {
+	case intOrString || s.Format == "int-or-string":
+		expected = []string{"integer", "string"}
+	case quantity:
+		expected = []string{"string", "integer", "number"}
+	case len(s.Type) > 0:
+		expected = s.Type
+	case len(s.Properties) > 0:
+		expected = []string{"object"}
+	}
+	actual := nodeType(node)
+	if len(expected) > 0 && !typeAllowed(actual, expected) {
+		v.addResult(path, fmt.Sprintf("expected %s, got %s", strings.Join(expected, " or "), actual), nodeValue(node))
+		return
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		v.validateMap(path, node, s, preserveUnknown)
+	case yaml.SequenceNode:
+		if s.Items != nil && s.Items.Schema != nil {
+			names, byName := elementNames(node)
+			for i, elem := range node.Content {
+				elemPath := fmt.Sprintf("%s[%d]", path, i)
+				if byName {
+					elemPath = path + selectorString("name", names[i])
+				}
+				v.validate(elemPath, elem, s.Items.Schema)
+			}
+		}
+	case yaml.ScalarNode:
+		if len(s.Enum) > 0 && !enumAllowed(node, s.Enum) {
+			v.addResult(path, fmt.Sprintf("value %q is not one of %v", node.Value, s.Enum), nodeValue(node))
+		}
+	}
+}
+
+func (v *schemaValidator) validateMap(path string, node *yaml.Node, s *spec.Schema, preserveUnknown bool) {
+	present := map[string]bool{}
+	keys, values := internal.MappingFields(node)
+	for i, k := range keys {
+		key := k.Value
+		present[key] = true
+		fieldPath := joinFieldPath(path, key)
+		if prop, found := s.Properties[key]; found {
+			v.validate(fieldPath, values[i], &prop)
+			continue
+		}
+		switch {
+		case s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil:
+			v.validate(fieldPath, values[i], s.AdditionalProperties.Schema)
+		case s.AdditionalProperties != nil && s.AdditionalProperties.Allows:
+		case preserveUnknown || len(s.Properties) == 0:
+			// Free-form object.
+		case path == "" && (key == "apiVersion" || key == "kind" || key == "metadata"):
+			// CRD schemas may omit the type and object metadata.
+		default:
+			v.addResult(fieldPath, fmt.Sprintf("unknown field %q", key), nil)
+		}
+	}
+	for _, required := range s.Required {
+		if !present[required] {
+			v.addResult(joinFieldPath(path, required), fmt.Sprintf("missing required field %q", required), nil)
+		}
+	}
+}
+
+// resolveSchema follows the references to the built-in definitions. It also
+// tells whether the schema is a resource.Quantity, which accepts numbers as
+// well as strings.
+func resolveSchema(s *spec.Schema) (*spec.Schema, bool) {
+	quantity := false
+	for s != nil && s.Ref.String() != "" {
+		if strings.HasSuffix(s.Ref.String(), ".pkg.api.resource.Quantity") {
+			quantity = true
+		}
+		resolved, err := openapi.Resolve(&s.Ref, openapi.Schema())
+		if err != nil {
+			return nil, false
+		}
+		s = resolved
+	}
+	return s, quantity
+}
+
+// nodeType returns the OpenAPI type of a node.
+func nodeType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.Tag {
+	case yaml.NodeTagInt:
+		return "integer"
+	case yaml.NodeTagFloat:
+		return "number"
+	case yaml.NodeTagBool:
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+func typeAllowed(actual string, expected []string) bool {
+	for _, t := range expected {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func enumAllowed(node *yaml.Node, enum []interface{}) bool {
+	value := fmt.Sprint(nodeValue(node))
+	for _, e := range enum {
+		if fmt.Sprint(e) == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var crd = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: databases.example.com
+spec:
+  group: example.com
+  names:
+    kind: Database
+    plural: databases
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required:
+            - engine
+            properties:
+              engine:
+                type: string
+                enum:
+                - postgres
+                - mysql
+              storage:
+                x-kubernetes-int-or-string: true
+              replicas:
+                type: integer
+              config:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+`
+
+func TestValidateSchema(t *testing.T) {
+	testcases := map[string]struct {
+		input    string
+		expected []string
+	}{
+		"valid deployment": {
+			input: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  creationTimestamp: null
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: nginx
+  template:
+    metadata:
+      labels:
+        app: nginx
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.21
+        ports:
+        - containerPort: 80
+        resources:
+          limits:
+            cpu: 1
+            memory: 128Mi
+`,
+		},
+		"invalid deployment": {
+			input: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  annotations:
+    config.kubernetes.io/path: deploy.yaml
+spec:
+  replicas: "3"
+  selector:
+    matchLabels:
+      app: nginx
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.21
+        imagePullPolicy: true
+        unknown: foo
+      - image: sidecar
+`,
+			expected: []string{
+				`spec.replicas: expected integer, got string`,
+				`spec.template.spec.containers[0].imagePullPolicy: expected string, got boolean`,
+				`spec.template.spec.containers[0].unknown: unknown field "unknown"`,
+				`spec.template.spec.containers[1].name: missing required field "name"`,
+			},
+		},
+		"valid custom resource": {
+			input: `apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: db
+spec:
+  engine: postgres
+  storage: 10Gi
+  replicas: 2
+  config:
+    anything: goes
+`,
+		},
+		"invalid custom resource": {
+			input: `apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: db
+spec:
+  storage: [10Gi]
+  replicas: 2.5
+  engine: oracle
+  extra: true
+`,
+			expected: []string{
+				`spec.storage: expected integer or string, got array`,
+				`spec.replicas: expected integer, got number`,
+				`spec.engine: value "oracle" is not one of [postgres mysql]`,
+				`spec.extra: unknown field "extra"`,
+			},
+		},
+		"merge keys": {
+			input: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels: &labels
+    app: nginx
+spec:
+  selector:
+    matchLabels: *labels
+  template:
+    spec:
+      containers:
+      - &nginx
+        name: nginx
+        image: nginx:1.21
+      - <<: *nginx
+        name: sidecar
+        imagePullPolicy: true
+`,
+			expected: []string{
+				`spec.template.spec.containers[name=sidecar].imagePullPolicy: expected string, got boolean`,
+			},
+		},
+		"unknown kind": {
+			input: `apiVersion: example.com/v1
+kind: Unknown
+metadata:
+  name: foo
+spec:
+  anything: goes
+`,
+		},
+	}
+	crdObj, err := ParseKubeObject([]byte(crd))
+	require.NoError(t, err)
+	crds, err := CRDSchemas(KubeObjects{crdObj})
+	require.NoError(t, err)
+	source := SchemaSources(crds, BuiltinSchemas())
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			obj, err := ParseKubeObject([]byte(tc.input))
+			require.NoError(t, err)
+			results := ValidateSchema(obj, source)
+			var actual []string
+			for _, r := range results {
+				assert.Equal(t, Error, r.Severity)
+				assert.Equal(t, obj.GetKind(), r.ResourceRef.Kind)
+				assert.Equal(t, obj.PathAnnotation(), r.File.Path)
+				actual = append(actual, r.Field.Path+": "+r.Message)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Scope is the namespace scope of a kind.
+type Scope int
+
+const (
+	// ScopeUnknown means the scope of the kind is not known, e.g. a custom
+	// resource whose CustomResourceDefinition is not available.
+	ScopeUnknown Scope = iota
+	// NamespaceScoped kinds live in a namespace, e.g. Deployment.
+	NamespaceScoped
+	// ClusterScoped kinds do not belong to any namespace, e.g. Namespace or ClusterRole.
+	ClusterScoped
+)
+
+func (s Scope) String() string {
+	switch s {
+	case NamespaceScoped:
+		return "Namespaced"
+	case ClusterScoped:
+		return "Cluster"
+	default:
+		return "Unknown"
+	}
+}
+
+func scopeOf(namespaced bool) Scope {
+	if namespaced {
+		return NamespaceScoped
+	}
+	return ClusterScoped
+}
+
+// builtinScopes records the scope of the built-in kinds by GroupKind, so that
+// the versions missing from internal.PrecomputedIsNamespaceScoped are also known.
+var builtinScopes = func() map[schema.GroupKind]Scope {
+	scopes := map[schema.GroupKind]Scope{}
+	for tm, namespaced := range internal.PrecomputedIsNamespaceScoped {
+		group, _ := ParseGroupVersion(tm.APIVersion)
+		scopes[schema.GroupKind{Group: group, Kind: tm.Kind}] = scopeOf(namespaced)
+	}
+	return scopes
+}()
+
+// ScopeResolver tells the namespace scope of a kind. It knows the built-in
+// kinds, and learns the custom kinds from CustomResourceDefinitions and from
+// OpenAPI documents. The zero value is not usable, use NewScopeResolver.
+type ScopeResolver struct {
+	exact map[schema.GroupVersionKind]Scope
+	kinds map[schema.GroupKind]Scope
+}
+
+// NewScopeResolver returns a ScopeResolver which knows the built-in kinds.
+func NewScopeResolver() *ScopeResolver {
+	return &ScopeResolver{
+		exact: map[schema.GroupVersionKind]Scope{},
+		kinds: map[schema.GroupKind]Scope{},
+	}
+}
+
+// defaultScopeResolver is used by the KubeObjects which have no ScopeResolver.
+var defaultScopeResolver = NewScopeResolver()
+
+// Scope returns the scope of the kind. The exact GroupVersionKind is looked up
+// first, then any version of the same GroupKind, as the scope of a kind does not
+// change across versions. It returns ScopeUnknown if the kind is not known.
+func (r *ScopeResolver) Scope(gvk schema.GroupVersionKind) Scope {
+	if r == nil {
+		r = defaultScopeResolver
+	}
+	tm := yaml.TypeMeta{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind}
+	if namespaced, found := internal.PrecomputedIsNamespaceScoped[tm]; found {
+		return scopeOf(namespaced)
+	}
+	if scope, found := r.exact[gvk]; found {
+		return scope
+	}
+	if scope, found := builtinScopes[gvk.GroupKind()]; found {
+		return scope
+	}
+	if scope, found := r.kinds[gvk.GroupKind()]; found {
+		return scope
+	}
+	return ScopeUnknown
+}
+
+// AddCRDs learns the scope of the custom kinds defined by the
+// CustomResourceDefinitions in the KubeObjects, from their `spec.scope`.
+func (r *ScopeResolver) AddCRDs(items KubeObjects) error {
+	for _, crd := range items.Where(IsGroupKind(schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"})) {
+		group, _, err := crd.NestedString("spec", "group")
+		if err != nil {
+			return err
+		}
+		kind, _, err := crd.NestedString("spec", "names", "kind")
+		if err != nil {
+			return err
+		}
+		scopeName, _, err := crd.NestedString("spec", "scope")
+		if err != nil {
+			return err
+		}
+		var scope Scope
+		switch scopeName {
+		case "Namespaced":
+			scope = NamespaceScoped
+		case "Cluster":
+			scope = ClusterScoped
+		default:
+			return fmt.Errorf("%v has invalid spec.scope %q, expect Namespaced or Cluster", crd.ShortString(), scopeName)
+		}
+		r.kinds[schema.GroupKind{Group: group, Kind: kind}] = scope
+	}
+	return nil
+}
+
+// AddOpenAPI learns the scope of the kinds from an OpenAPI v2 document in JSON
+// or YAML, e.g. the output of `kubectl get --raw /openapi/v2`. Like kubectl, a
+// kind is namespace scoped if one of its API paths has a namespace parameter.
+func (r *ScopeResolver) AddOpenAPI(doc []byte) error {
+	var v interface{}
+	if err := yaml.Unmarshal(doc, &v); err != nil {
+		return fmt.Errorf("unable to parse the OpenAPI document with error: %w", err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to parse the OpenAPI document with error: %w", err)
+	}
+	var swagger spec.Swagger
+	if err := swagger.UnmarshalJSON(b); err != nil {
+		return fmt.Errorf("unable to parse the OpenAPI document with error: %w", err)
+	}
+	if swagger.Paths == nil {
+		return nil
+	}
+	for path, item := range swagger.Paths.Paths {
+		if item.Get == nil {
+			continue
+		}
+		ext, found := item.Get.Extensions["x-kubernetes-group-version-kind"]
+		if !found {
+			continue
+		}
+		m, ok := ext.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		group, _ := m["group"].(string)
+		version, _ := m["version"].(string)
+		kind, _ := m["kind"].(string)
+		gvk := schema.GroupVersionKind{Group: group, Version: version, Kind: kind}
+		if strings.Contains(path, "namespaces/{namespace}") {
+			r.exact[gvk] = NamespaceScoped
+			r.kinds[gvk.GroupKind()] = NamespaceScoped
+		} else if _, found := r.exact[gvk]; !found {
+			r.exact[gvk] = ClusterScoped
+			r.kinds[gvk.GroupKind()] = ClusterScoped
+		}
+	}
+	return nil
+}
+
+// Scope returns the namespace scope of the KubeObject, as told by its
+// ScopeResolver. The KubeObjects parsed from a ResourceList use a ScopeResolver
+// which knows the CustomResourceDefinitions in the ResourceList items, and so do
+// the KubeObjects added with ResourceList.UpsertObjectToItems. Other KubeObjects,
+// e.g. built with NewFromTypedObject, only know the built-in kinds until
+// SetScopeResolver is called.
+func (o *KubeObject) Scope() Scope {
+	return o.scopes.Scope(o.GroupVersionKind())
+}
+
+// SetScopeResolver sets the ScopeResolver used by Scope, IsNamespaceScoped and
+// GetId, e.g. one which has learned the scopes from a cluster OpenAPI document.
+func (o *KubeObject) SetScopeResolver(r *ScopeResolver) {
+	o.scopes = r
+	// The namespace of the ResourceIdentifier may have changed.
+	o.obj.Touch()
+}
+
+// SetScopeResolver sets the ScopeResolver of all the KubeObjects.
+func (o KubeObjects) SetScopeResolver(r *ScopeResolver) {
+	for _, obj := range o {
+		obj.SetScopeResolver(r)
+	}
+}
+
+// scopeResolver returns the ScopeResolver of the first KubeObject which has one.
+func (o KubeObjects) scopeResolver() *ScopeResolver {
+	for _, obj := range o {
+		if obj.scopes != nil {
+			return obj.scopes
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestScopeResolver(t *testing.T) {
+	r := NewScopeResolver()
+	require.NoError(t, r.AddOpenAPI([]byte(`swagger: "2.0"
+info:
+  title: Kubernetes
+  version: v1.99.0
+paths:
+  /apis/example.com/v1/namespaces/{namespace}/widgets:
+    get:
+      x-kubernetes-group-version-kind:
+        group: example.com
+        version: v1
+        kind: Widget
+  /apis/example.com/v1/widgets:
+    get:
+      x-kubernetes-group-version-kind:
+        group: example.com
+        version: v1
+        kind: Widget
+  /apis/example.com/v1/gadgets:
+    get:
+      x-kubernetes-group-version-kind:
+        group: example.com
+        version: v1
+        kind: Gadget
+`)))
+	testcases := map[string]struct {
+		gvk      schema.GroupVersionKind
+		expected Scope
+	}{
+		"built-in": {
+			gvk:      schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			expected: NamespaceScoped,
+		},
+		"newer built-in": {
+			gvk:      schema.GroupVersionKind{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler"},
+			expected: NamespaceScoped,
+		},
+		"flowcontrol v1": {
+			gvk:      schema.GroupVersionKind{Group: "flowcontrol.apiserver.k8s.io", Version: "v1", Kind: "FlowSchema"},
+			expected: ClusterScoped,
+		},
+		"other version of a built-in": {
+			gvk:      schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v2", Kind: "ClusterRole"},
+			expected: ClusterScoped,
+		},
+		"namespaced from OpenAPI": {
+			gvk:      schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"},
+			expected: NamespaceScoped,
+		},
+		"cluster scoped from OpenAPI": {
+			gvk:      schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Gadget"},
+			expected: ClusterScoped,
+		},
+		"unknown": {
+			gvk:      schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Unknown"},
+			expected: ScopeUnknown,
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, r.Scope(tc.gvk))
+		})
+	}
+}
+
+func TestScopeFromCRDs(t *testing.T) {
+	rl, err := ParseResourceList([]byte(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apiextensions.k8s.io/v1
+  kind: CustomResourceDefinition
+  metadata:
+    name: clusterwidgets.example.com
+  spec:
+    group: example.com
+    names:
+      kind: ClusterWidget
+    scope: Cluster
+- apiVersion: apiextensions.k8s.io/v1
+  kind: CustomResourceDefinition
+  metadata:
+    name: widgets.example.com
+  spec:
+    group: example.com
+    names:
+      kind: Widget
+    scope: Namespaced
+- apiVersion: example.com/v1
+  kind: ClusterWidget
+  metadata:
+    name: cw
+    namespace: oops
+- apiVersion: example.com/v1
+  kind: Widget
+  metadata:
+    name: w
+- apiVersion: example.com/v1
+  kind: Unknown
+  metadata:
+    name: u
+`))
+	require.NoError(t, err)
+	var actual []string
+	for _, obj := range rl.Items[2:] {
+		actual = append(actual, obj.Scope().String()+" "+obj.GetId().String())
+	}
+	expected := []string{
+		// The namespace set by mistake is kept, like before the scopes
+		// were known, so that the upstream identifiers don't change.
+		"Cluster example.com|ClusterWidget|oops|cw",
+		"Namespaced example.com|Widget|default|w",
+		"Unknown example.com|Unknown|~C|u",
+	}
+	assert.Equal(t, expected, actual)
+	assert.False(t, rl.Items[2].IsNamespaceScoped())
+	assert.True(t, rl.Items[3].IsNamespaceScoped())
+
+	// The objects added later know the custom resources too.
+	cw, err := ParseKubeObject([]byte(`apiVersion: example.com/v1
+kind: ClusterWidget
+metadata:
+  name: cw2
+`))
+	require.NoError(t, err)
+	require.NoError(t, rl.UpsertObjectToItems(cw, nil, false))
+	assert.Equal(t, ClusterScoped, rl.Items[len(rl.Items)-1].Scope())
+}
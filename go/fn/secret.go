@@ -0,0 +1,377 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+var secretGK = schema.GroupKind{Kind: "Secret"}
+
+func (o *KubeObject) checkSecret() error {
+	if o.GroupKind() != secretGK {
+		return fmt.Errorf("%v is not a Secret", o.ShortString())
+	}
+	return nil
+}
+
+// GetSecretData returns the decoded value of the key of a Secret, and whether
+// the key exists. The plain text `stringData` value takes precedence over the
+// base64 encoded `data` value, the same as in the API server.
+func (o *KubeObject) GetSecretData(key string) ([]byte, bool, error) {
+	if err := o.checkSecret(); err != nil {
+		return nil, false, err
+	}
+	if s, found, err := o.NestedString("stringData", key); err != nil || found {
+		return []byte(s), found, err
+	}
+	s, found, err := o.NestedString("data", key)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	value, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, true, fmt.Errorf("%v has an invalid base64 value at data.%v: %w", o.ShortString(), key, err)
+	}
+	return value, true, nil
+}
+
+// SecretData returns all the decoded values of a Secret, with the `stringData`
+// values merged into the `data` values.
+func (o *KubeObject) SecretData() (map[string][]byte, error) {
+	if err := o.checkSecret(); err != nil {
+		return nil, err
+	}
+	data, _, err := o.NestedStringMap("data")
+	if err != nil {
+		return nil, err
+	}
+	stringData, _, err := o.NestedStringMap("stringData")
+	if err != nil {
+		return nil, err
+	}
+	values := map[string][]byte{}
+	for k, s := range data {
+		value, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%v has an invalid base64 value at data.%v: %w", o.ShortString(), k, err)
+		}
+		values[k] = value
+	}
+	for k, s := range stringData {
+		values[k] = []byte(s)
+	}
+	return values, nil
+}
+
+// SetSecretData sets the key of a Secret to the base64 encoded value in `data`.
+// The key is removed from `stringData`, which would override it otherwise.
+func (o *KubeObject) SetSecretData(key string, value []byte) error {
+	if err := o.checkSecret(); err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(value)
+	if err := o.SetNestedString(encoded, "data", key); err != nil {
+		return err
+	}
+	if _, err := o.RemoveNestedField("stringData", key); err != nil {
+		return err
+	}
+	return o.removeIfEmpty("stringData")
+}
+
+// SetSecretStringData sets the key of a Secret to the plain text value in
+// `stringData`. The API server merges it into `data` on write.
+func (o *KubeObject) SetSecretStringData(key, value string) error {
+	if err := o.checkSecret(); err != nil {
+		return err
+	}
+	return o.SetNestedString(value, "stringData", key)
+}
+
+// MergeSecretStringData moves the `stringData` values of a Secret into `data`,
+// base64 encoded, the same as the API server does on write. The `stringData`
+// values take precedence over the `data` values.
+func (o *KubeObject) MergeSecretStringData() error {
+	if err := o.checkSecret(); err != nil {
+		return err
+	}
+	stringData, found, err := o.NestedStringMap("stringData")
+	if err != nil || !found {
+		return err
+	}
+	keys := make([]string, 0, len(stringData))
+	for k := range stringData {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		encoded := base64.StdEncoding.EncodeToString([]byte(stringData[k]))
+		if err := o.SetNestedString(encoded, "data", k); err != nil {
+			return err
+		}
+	}
+	_, err = o.RemoveNestedField("stringData")
+	return err
+}
+
+func (o *KubeObject) removeIfEmpty(fields ...string) error {
+	m, found, err := o.NestedStringMap(fields...)
+	if err != nil || !found || len(m) > 0 {
+		return err
+	}
+	_, err = o.RemoveNestedField(fields...)
+	return err
+}
+
+// RedactedValue replaces the Secret values when the Secret redaction is enabled.
+const RedactedValue = "<redacted>"
+
+// minRedactedTextLength is the minimum length of a Secret value for it to be
+// redacted from free text, e.g. the Result messages. Shorter values would make
+// most messages unreadable, e.g. a `1` flag.
+const minRedactedTextLength = 4
+
+// redaction holds the Secret redaction settings and the ResourceList processed
+// by the last Run, whose Secret values are redacted from the messages.
+var redaction = struct {
+	sync.RWMutex
+	enabled bool
+	current *ResourceList
+}{}
+
+// EnableSecretRedaction turns on or off the redaction of the Secret values in
+// the human readable outputs, so that they never leak in the logs:
+//   - KubeObject.String() and SubObject.String() replace the `data` and
+//     `stringData` values of the Secrets by RedactedValue.
+//   - The Results written in the output ResourceList redact the values of its
+//     Secrets from the messages, and the Field values of the Secret data
+//     fields.
+//   - Log and Logf, Result.String() and KubeObject.String() redact the values
+//     of the Secrets of the ResourceList processed by the last Run or Execute.
+//
+// The Secret values are collected from the Secrets as they are when the output
+// is written, so the Secrets added or written by the function are redacted as
+// well. The resources written in the output ResourceList are never redacted.
+func EnableSecretRedaction(enabled bool) {
+	redaction.Lock()
+	defer redaction.Unlock()
+	redaction.enabled = enabled
+	if !enabled {
+		redaction.current = nil
+	}
+}
+
+func secretRedactionEnabled() bool {
+	redaction.RLock()
+	defer redaction.RUnlock()
+	return redaction.enabled
+}
+
+// redactSecretsOf sets the ResourceList whose Secret values are redacted from
+// the messages, in place of the previous one.
+func redactSecretsOf(rl *ResourceList) {
+	redaction.Lock()
+	defer redaction.Unlock()
+	if redaction.enabled {
+		redaction.current = rl
+	}
+}
+
+// secretRedactor redacts the values of some Secrets from free text.
+type secretRedactor struct {
+	// values are sorted by decreasing length, so that a value which contains
+	// another one is replaced first.
+	values []string
+}
+
+// newSecretRedactor collects the encoded and decoded values of the Secrets
+// among the KubeObjects.
+func newSecretRedactor(objs ...*KubeObject) *secretRedactor {
+	seen := map[string]bool{}
+	r := &secretRedactor{}
+	add := func(v string) {
+		if len(v) >= minRedactedTextLength && !seen[v] {
+			seen[v] = true
+			r.values = append(r.values, v)
+		}
+	}
+	for _, o := range objs {
+		if o == nil || o.obj == nil || o.GroupKind() != secretGK {
+			continue
+		}
+		for _, field := range []string{"data", "stringData"} {
+			m, _, _ := o.obj.GetNestedStringMap(field)
+			for _, v := range m {
+				add(v)
+				if field == "data" {
+					if decoded, err := base64.StdEncoding.DecodeString(v); err == nil {
+						add(string(decoded))
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(r.values, func(i, j int) bool {
+		if len(r.values[i]) != len(r.values[j]) {
+			return len(r.values[i]) > len(r.values[j])
+		}
+		return r.values[i] < r.values[j]
+	})
+	return r
+}
+
+// secretRedactor returns the secretRedactor of the Secrets of the
+// ResourceList, or one which redacts nothing if the redaction is off.
+func (rl *ResourceList) secretRedactor() *secretRedactor {
+	if rl == nil || !secretRedactionEnabled() {
+		return &secretRedactor{}
+	}
+	return newSecretRedactor(append(KubeObjects{rl.FunctionConfig}, rl.Items...)...)
+}
+
+// currentSecretRedactor returns the secretRedactor of the ResourceList
+// processed by the last Run.
+func currentSecretRedactor() *secretRedactor {
+	redaction.RLock()
+	rl := redaction.current
+	redaction.RUnlock()
+	return rl.secretRedactor()
+}
+
+// text replaces the Secret values in text.
+func (r *secretRedactor) text(text string) string {
+	for _, v := range r.values {
+		text = strings.ReplaceAll(text, v, RedactedValue)
+	}
+	return text
+}
+
+// redactText replaces the Secret values of the ResourceList processed by the
+// last Run in text.
+func redactText(text string) string {
+	return currentSecretRedactor().text(text)
+}
+
+// redactedNode returns a copy of the SubObject node with its Secret values
+// redacted.
+func (o *SubObject) redactedNode() *yaml.Node {
+	node := o.obj.DeepCopy().Node()
+	if o.rootObject().GroupKind() == secretGK {
+		switch {
+		case o.root == nil:
+			redactField(node, "data")
+			redactField(node, "stringData")
+		case isSecretDataPath(strings.TrimPrefix(o.fieldpath, ".")):
+			redactScalars(node, nil)
+		}
+	}
+	redactScalars(node, currentSecretRedactor().text)
+	return node
+}
+
+// isSecretDataPath tells whether the path is in the data of a Secret.
+func isSecretDataPath(path string) bool {
+	for _, field := range []string{"data", "stringData"} {
+		if path == field || strings.HasPrefix(path, field+".") || strings.HasPrefix(path, field+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// redactField replaces all the values under the field of the map node.
+func redactField(node *yaml.Node, field string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == field {
+			redactScalars(node.Content[i+1], nil)
+		}
+	}
+}
+
+// redactScalars replaces the scalar values under node by the result of redact,
+// or by RedactedValue if redact is nil. The map keys are kept.
+func redactScalars(node *yaml.Node, redact func(string) string) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if redact == nil {
+			node.Value, node.Tag, node.Style = RedactedValue, yaml.NodeTagString, 0
+		} else {
+			node.Value = redact(node.Value)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			redactScalars(node.Content[i+1], redact)
+		}
+	default:
+		for _, child := range node.Content {
+			redactScalars(child, redact)
+		}
+	}
+}
+
+// redacted returns a copy of the Result with its Secret values redacted by r.
+func (i Result) redacted(r *secretRedactor) Result {
+	if !secretRedactionEnabled() {
+		return i
+	}
+	i.Message = r.text(i.Message)
+	if i.Field != nil {
+		field := *i.Field
+		isSecret := i.ResourceRef != nil &&
+			schema.FromAPIVersionAndKind(i.ResourceRef.APIVersion, i.ResourceRef.Kind).GroupKind() == secretGK
+		if isSecret && isSecretDataPath(field.Path) {
+			if field.CurrentValue != nil {
+				field.CurrentValue = RedactedValue
+			}
+			if field.ProposedValue != nil {
+				field.ProposedValue = RedactedValue
+			}
+		} else {
+			if s, ok := field.CurrentValue.(string); ok {
+				field.CurrentValue = r.text(s)
+			}
+			if s, ok := field.ProposedValue.(string); ok {
+				field.ProposedValue = r.text(s)
+			}
+		}
+		i.Field = &field
+	}
+	return i
+}
+
+// redacted returns a copy of the Results with the Secret values redacted by
+// redactor.
+func (r Results) redacted(redactor *secretRedactor) Results {
+	if !secretRedactionEnabled() {
+		return r
+	}
+	results := make(Results, 0, len(r))
+	for _, result := range r {
+		redacted := result.redacted(redactor)
+		results = append(results, &redacted)
+	}
+	return results
+}
@@ -0,0 +1,190 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+type: Opaque
+data:
+  username: YWRtaW4= # admin
+  password: czNjcjN0UGFzcw==
+stringData:
+  token: plain-token
+`
+
+func TestSecretData(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(secret))
+	require.NoError(t, err)
+
+	password, found, err := obj.GetSecretData("password")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "s3cr3tPass", string(password))
+	token, found, err := obj.GetSecretData("token")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "plain-token", string(token))
+	_, found, err = obj.GetSecretData("missing")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	data, err := obj.SecretData()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"username": []byte("admin"),
+		"password": []byte("s3cr3tPass"),
+		"token":    []byte("plain-token"),
+	}, data)
+
+	require.NoError(t, obj.SetSecretData("token", []byte("new-token")))
+	require.NoError(t, obj.SetSecretStringData("api-key", "key"))
+	require.NoError(t, obj.MergeSecretStringData())
+	assert.Equal(t, `apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+type: Opaque
+data:
+  username: YWRtaW4= # admin
+  password: czNjcjN0UGFzcw==
+  token: bmV3LXRva2Vu
+  api-key: a2V5
+`, obj.String())
+
+	cm := NewEmptyKubeObject()
+	require.NoError(t, cm.SetKind("ConfigMap"))
+	_, _, err = cm.GetSecretData("password")
+	assert.EqualError(t, err, "Resource(apiVersion=, kind=ConfigMap, namespace=, name=) is not a Secret")
+}
+
+func TestSecretRedaction(t *testing.T) {
+	EnableSecretRedaction(true)
+	defer EnableSecretRedaction(false)
+	obj, err := ParseKubeObject([]byte(secret))
+	require.NoError(t, err)
+
+	assert.Equal(t, `apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+type: Opaque
+data:
+  username: <redacted> # admin
+  password: <redacted>
+stringData:
+  token: <redacted>
+`, obj.String())
+	data, _, err := obj.NestedSubObject("data")
+	require.NoError(t, err)
+	assert.Equal(t, "username: <redacted> # admin\npassword: <redacted>\n", data.String())
+
+	// The object itself is not redacted.
+	password, _, err := obj.GetSecretData("password")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3tPass", string(password))
+
+	result := ConfigObjectResult("password s3cr3tPass is too weak", obj, Error)
+	result.Field = &Field{Path: "data.password", CurrentValue: "czNjcjN0UGFzcw=="}
+	rl := &ResourceList{Items: KubeObjects{obj}, FunctionConfig: NewEmptyKubeObject(), Results: Results{result}}
+	redactSecretsOf(rl)
+	assert.Equal(t, "[error] v1/Secret/credentials data.password: password <redacted> is too weak", result.String())
+
+	out, err := rl.ToYAML()
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "password: czNjcjN0UGFzcw==")
+	assert.Contains(t, string(out), "message: password <redacted> is too weak")
+	assert.Contains(t, string(out), "currentValue: <redacted>")
+	assert.Equal(t, "czNjcjN0UGFzcw==", result.Field.CurrentValue)
+}
+
+func TestSecretRedactionPerResourceList(t *testing.T) {
+	EnableSecretRedaction(true)
+	defer EnableSecretRedaction(false)
+	var messages []string
+	process := ResourceListProcessorFunc(func(rl *ResourceList) (bool, error) {
+		messages = append(messages, redactText("password s3cr3tPass"))
+		return true, nil
+	})
+	withSecret := "apiVersion: config.kubernetes.io/v1\nkind: ResourceList\nitems:\n- " +
+		strings.ReplaceAll(strings.TrimSpace(secret), "\n", "\n  ") + "\n"
+	_, err := Run(process, []byte(withSecret))
+	require.NoError(t, err)
+	_, err = Run(process, []byte("apiVersion: config.kubernetes.io/v1\nkind: ResourceList\nitems: []\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"password <redacted>", "password s3cr3tPass"}, messages)
+}
+
+func TestSecretRedactionAtOutput(t *testing.T) {
+	// The Secret is parsed before the redaction is enabled.
+	input := "apiVersion: config.kubernetes.io/v1\nkind: ResourceList\nitems:\n- " +
+		strings.ReplaceAll(strings.TrimSpace(secret), "\n", "\n  ") + "\n"
+	rl, err := ParseResourceList([]byte(input))
+	require.NoError(t, err)
+	EnableSecretRedaction(true)
+	defer EnableSecretRedaction(false)
+
+	require.NoError(t, rl.Items[0].SetNestedString("written-later", "stringData", "token"))
+	added, err := NewFromTypedObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "added"},
+		"stringData": map[string]interface{}{"key": "typed-secret"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, rl.UpsertObjectToItems(added, nil, false))
+	rl.Results = Results{
+		GeneralResult("s3cr3tPass written-later typed-secret plain-token", Info),
+		&Result{
+			Message:     "a Secret in a ConfigMap",
+			Severity:    Warning,
+			ResourceRef: &ResourceRef{APIVersion: "v1", Kind: "ConfigMap"},
+			Field:       &Field{Path: "data.password", CurrentValue: "s3cr3tPass"},
+		},
+	}
+	out, err := rl.ToYAML()
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "message: <redacted> <redacted> <redacted> plain-token")
+	assert.Contains(t, string(out), "currentValue: <redacted>")
+}
+
+func TestSecretResultField(t *testing.T) {
+	EnableSecretRedaction(true)
+	defer EnableSecretRedaction(false)
+	// The Secrets are matched by their GroupKind.
+	for _, apiVersion := range []string{"v1", "v2"} {
+		result := &Result{
+			Message:     "weak password",
+			ResourceRef: &ResourceRef{APIVersion: apiVersion, Kind: "Secret"},
+			Field:       &Field{Path: "data.password", CurrentValue: "short"},
+		}
+		assert.Equal(t, RedactedValue, result.redacted(&secretRedactor{}).Field.CurrentValue, apiVersion)
+	}
+	result := &Result{
+		Message:     "weak password",
+		ResourceRef: &ResourceRef{APIVersion: "example.com/v1", Kind: "Secret"},
+		Field:       &Field{Path: "data.password", CurrentValue: "short"},
+	}
+	assert.Equal(t, "short", result.redacted(&secretRedactor{}).Field.CurrentValue)
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// toLabelSelector converts a string (e.g. `app=nginx,tier in (web,api),!canary`),
+// a metav1.LabelSelector or a labels.Selector to a labels.Selector.
+func toLabelSelector(selector interface{}) (labels.Selector, error) {
+	switch s := selector.(type) {
+	case string:
+		return labels.Parse(s)
+	case metav1.LabelSelector:
+		return metav1.LabelSelectorAsSelector(&s)
+	case *metav1.LabelSelector:
+		if s == nil {
+			return labels.Nothing(), nil
+		}
+		return metav1.LabelSelectorAsSelector(s)
+	case labels.Selector:
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unsupported label selector type %T, expect string, metav1.LabelSelector or labels.Selector", selector)
+	}
+}
+
+// WhereLabelSelector returns the subset of objects in KubeObjects whose labels match the
+// selector. The selector can be a string in the kubectl `-l` syntax, which supports
+// set-based requirements like `tier in (web,api)`, `tier notin (db)`, `canary` and
+// `!canary`, or a metav1.LabelSelector, or a labels.Selector. e.g.
+//
+//	objs, err := rl.Items.WhereLabelSelector("app=nginx,tier in (web,api)")
+func (o KubeObjects) WhereLabelSelector(selector interface{}) (KubeObjects, error) {
+	sel, err := toLabelSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %v: %w", selector, err)
+	}
+	return o.Where(func(obj *KubeObject) bool {
+		return sel.Matches(labels.Set(obj.GetLabels()))
+	}), nil
+}
+
+// selectorFields records where the pod selector is in the kinds supported by
+// SelectedBy, and whether it is a plain label map rather than a metav1.LabelSelector.
+var selectorFields = map[schema.GroupKind]struct {
+	fields []string
+	isMap  bool
+}{
+	{Group: "", Kind: "Service"}:                        {fields: []string{"spec", "selector"}, isMap: true},
+	{Group: "", Kind: "ReplicationController"}:          {fields: []string{"spec", "selector"}, isMap: true},
+	{Group: "apps", Kind: "Deployment"}:                 {fields: []string{"spec", "selector"}},
+	{Group: "apps", Kind: "StatefulSet"}:                {fields: []string{"spec", "selector"}},
+	{Group: "apps", Kind: "DaemonSet"}:                  {fields: []string{"spec", "selector"}},
+	{Group: "apps", Kind: "ReplicaSet"}:                 {fields: []string{"spec", "selector"}},
+	{Group: "networking.k8s.io", Kind: "NetworkPolicy"}: {fields: []string{"spec", "podSelector"}},
+	{Group: "policy", Kind: "PodDisruptionBudget"}:      {fields: []string{"spec", "selector"}},
+}
+
+// podSelector returns the pod selector of the KubeObject.
+func (o *KubeObject) podSelector() (labels.Selector, error) {
+	sf, ok := selectorFields[o.GroupKind()]
+	if !ok {
+		return nil, fmt.Errorf("%v does not have a supported pod selector", o.ShortString())
+	}
+	if sf.isMap {
+		m, found, err := o.NestedStringMap(sf.fields...)
+		if err != nil {
+			return nil, err
+		}
+		// A Service without a selector does not select any pods.
+		if !found || len(m) == 0 {
+			return labels.Nothing(), nil
+		}
+		return labels.SelectorFromSet(m), nil
+	}
+	ls, found, err := GetNested[metav1.LabelSelector](&o.SubObject, sf.fields...)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// An unset podSelector of a NetworkPolicy selects all the pods in
+		// the namespace, but an unset selector selects nothing.
+		if o.GroupKind().Kind == "NetworkPolicy" {
+			return labels.Everything(), nil
+		}
+		return labels.Nothing(), nil
+	}
+	sel, err := metav1.LabelSelectorAsSelector(&ls)
+	if err != nil {
+		return nil, fmt.Errorf("%v has an invalid selector: %w", o.ShortString(), err)
+	}
+	return sel, nil
+}
+
+// podLabels returns the labels of the pods a workload creates, i.e. the pod
+// template labels, or the labels of a Pod.
+func (o *KubeObject) podLabels() (map[string]string, bool, error) {
+	fields, ok := podSpecFields[o.GroupKind()]
+	if !ok {
+		return nil, false, nil
+	}
+	metadata := append(append([]string{}, fields[:len(fields)-1]...), "metadata", "labels")
+	m, _, err := o.NestedStringMap(metadata...)
+	return m, true, err
+}
+
+// SelectedBy tells whether the pods of the workload KubeObject (e.g. a Pod, a
+// Deployment or a CronJob) are selected by the pod selector of selectorOwner.
+// The supported selectorOwner kinds are Service, Deployment, StatefulSet,
+// DaemonSet, ReplicaSet, ReplicationController, NetworkPolicy and
+// PodDisruptionBudget. Only objects in the same namespace can be selected. It
+// returns false if the KubeObject is not a workload.
+func (o *KubeObject) SelectedBy(selectorOwner *KubeObject) (bool, error) {
+	sel, err := selectorOwner.podSelector()
+	if err != nil {
+		return false, err
+	}
+	podLabels, isWorkload, err := o.podLabels()
+	if err != nil || !isWorkload {
+		return false, err
+	}
+	if o.effectiveNamespace() != selectorOwner.effectiveNamespace() {
+		return false, nil
+	}
+	return sel.Matches(labels.Set(podLabels)), nil
+}
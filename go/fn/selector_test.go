@@ -0,0 +1,192 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var selectorObjects = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    tier: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+        track: stable
+    spec:
+      containers:
+      - name: web
+        image: web
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+  labels:
+    tier: db
+    canary: "true"
+spec:
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          labels:
+            app: backup
+        spec:
+          containers:
+          - name: backup
+            image: backup
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  labels:
+    tier: web
+spec:
+  selector:
+    app: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: external
+spec:
+  type: ExternalName
+  externalName: example.com
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: stable
+spec:
+  selector:
+    matchExpressions:
+    - key: track
+      operator: In
+      values: [stable, canary]
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny-all
+spec:
+  podSelector: {}
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: other-namespace
+  namespace: other
+spec:
+  podSelector: {}
+`
+
+func TestWhereLabelSelector(t *testing.T) {
+	objs, err := ParseKubeObjects([]byte(selectorObjects))
+	require.NoError(t, err)
+	testcases := map[string]struct {
+		selector interface{}
+		expected []string
+	}{
+		"equality": {
+			selector: "tier=web",
+			expected: []string{"Deployment/web", "Service/web"},
+		},
+		"in": {
+			selector: "tier in (web,db)",
+			expected: []string{"Deployment/web", "CronJob/backup", "Service/web"},
+		},
+		"notin and exists": {
+			selector: "tier notin (web),tier",
+			expected: []string{"CronJob/backup"},
+		},
+		"does not exist": {
+			selector: "!tier",
+			expected: []string{"Service/external", "PodDisruptionBudget/stable", "NetworkPolicy/deny-all", "NetworkPolicy/other-namespace"},
+		},
+		"metav1.LabelSelector": {
+			selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"tier": "db"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "canary", Operator: metav1.LabelSelectorOpExists},
+				},
+			},
+			expected: []string{"CronJob/backup"},
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			selected, err := KubeObjects(objs).WhereLabelSelector(tc.selector)
+			require.NoError(t, err)
+			var actual []string
+			for _, obj := range selected {
+				actual = append(actual, obj.GetKind()+"/"+obj.GetName())
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+
+	_, err = KubeObjects(objs).WhereLabelSelector("tier in (web")
+	assert.Error(t, err)
+	_, err = KubeObjects(objs).WhereLabelSelector(42)
+	assert.Error(t, err)
+}
+
+func TestSelectedBy(t *testing.T) {
+	objs, err := ParseKubeObjects([]byte(selectorObjects))
+	require.NoError(t, err)
+	deployment, cronJob := objs[0], objs[1]
+	testcases := map[string]struct {
+		owner      *KubeObject
+		deployment bool
+		cronJob    bool
+	}{
+		"service":                      {owner: objs[2], deployment: true, cronJob: false},
+		"service without selector":     {owner: objs[3], deployment: false, cronJob: false},
+		"pdb with match expressions":   {owner: objs[4], deployment: true, cronJob: false},
+		"network policy selecting all": {owner: objs[5], deployment: true, cronJob: true},
+		"other namespace":              {owner: objs[6], deployment: false, cronJob: false},
+		"deployment":                   {owner: deployment, deployment: true, cronJob: false},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			selected, err := deployment.SelectedBy(tc.owner)
+			require.NoError(t, err)
+			assert.Equal(t, tc.deployment, selected)
+			selected, err = cronJob.SelectedBy(tc.owner)
+			require.NoError(t, err)
+			assert.Equal(t, tc.cronJob, selected)
+		})
+	}
+
+	_, err = deployment.SelectedBy(cronJob)
+	assert.Error(t, err)
+	selected, err := objs[2].SelectedBy(objs[2])
+	require.NoError(t, err)
+	assert.False(t, selected)
+}
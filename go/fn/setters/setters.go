@@ -0,0 +1,323 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package setters finds, lists and applies the kpt setters, i.e. the
+// `# kpt-set: ${name}` line comments on KRM resource fields.
+//
+// A setter comment can mark
+//   - a whole scalar value, e.g. `replicas: 3 # kpt-set: ${replicas}`,
+//   - part of a string value, e.g. `image: nginx:1.21 # kpt-set: ${image}:${tag}`,
+//   - a sequence, e.g. `args: # kpt-set: ${args}`, whose setter value is a YAML
+//     list such as `[a, b]`.
+package setters
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// CommentPrefix is the prefix of the line comments which mark the setter fields.
+const CommentPrefix = "kpt-set:"
+
+var setterRegex = regexp.MustCompile(`\$\{([^${}]+)\}`)
+
+// Field is a KubeObject field marked with a setter comment.
+type Field struct {
+	// Object is the KubeObject the field belongs to.
+	Object *fn.KubeObject
+	// Path is the field path, e.g. `spec.template.spec.containers[name=nginx].image`.
+	Path string
+	// Pattern is the setter comment without its prefix, e.g. `${image}:${tag}`.
+	Pattern string
+	// Setters are the names of the setters referenced in Pattern.
+	Setters []string
+	// IsList tells whether the field is a sequence.
+	IsList bool
+	// Value is the current value of a scalar field.
+	Value string
+	// Values is the current value of a sequence field.
+	Values []string
+}
+
+// Setter summarizes a setter found in the KubeObjects.
+type Setter struct {
+	// Name is the setter name.
+	Name string
+	// Value is the current setter value inferred from the fields. It is empty
+	// if the value cannot be inferred. List values are in the `[a, b]` form.
+	Value string
+	// Count is the number of fields referencing the setter.
+	Count int
+}
+
+// parseComment returns the setter pattern of a line comment, or false if the
+// comment is not a setter comment.
+func parseComment(comment string) (string, bool) {
+	comment = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(comment), "#"))
+	if !strings.HasPrefix(comment, CommentPrefix) {
+		return "", false
+	}
+	pattern := strings.TrimSpace(strings.TrimPrefix(comment, CommentPrefix))
+	return pattern, setterRegex.MatchString(pattern)
+}
+
+func setterNames(pattern string) []string {
+	var names []string
+	for _, m := range setterRegex.FindAllStringSubmatch(pattern, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// visitFields calls visit on every setter field of obj. visit can return a
+// WalkAction to replace the field value.
+func visitFields(obj *fn.KubeObject, visit func(f *Field, node *fn.SubObject) fn.WalkAction) error {
+	// Walk visits the parents first, so we can look up the parent of each node
+	// to read the comments of the map fields.
+	parents := map[string]*fn.SubObject{"": &obj.SubObject}
+	return obj.Walk(func(path []fn.PathElement, node *fn.SubObject) fn.WalkAction {
+		if node.IsMap() || node.IsSlice() {
+			parents[indexPath(path)] = node
+		}
+		last := path[len(path)-1]
+		var comment string
+		if last.IsSequenceElement() {
+			comment, _, _ = node.LineComment()
+		} else if parent, ok := parents[indexPath(path[:len(path)-1])]; ok {
+			comment, _, _ = parent.LineComment(last.Field)
+		}
+		pattern, ok := parseComment(comment)
+		if !ok || node.IsMap() {
+			return fn.WalkContinue
+		}
+		f := &Field{
+			Object:  obj,
+			Path:    node.FieldPath(),
+			Pattern: pattern,
+			Setters: setterNames(pattern),
+			IsList:  node.IsSlice(),
+		}
+		if f.IsList {
+			_ = node.As(&f.Values)
+		} else {
+			var v interface{}
+			if err := node.As(&v); err == nil && v != nil {
+				f.Value = fmt.Sprint(v)
+			}
+		}
+		return visit(f, node)
+	})
+}
+
+// indexPath identifies a node by the indexes of the sequence elements in its
+// path, since the elements may have no name or the same name.
+func indexPath(path []fn.PathElement) string {
+	var sb strings.Builder
+	for _, e := range path {
+		if e.IsSequenceElement() {
+			fmt.Fprintf(&sb, "[%d]", e.Index)
+		} else {
+			fmt.Fprintf(&sb, ".%q", e.Field)
+		}
+	}
+	return sb.String()
+}
+
+// Find returns all the setter fields in the KubeObjects.
+func Find(items fn.KubeObjects) ([]*Field, error) {
+	var fields []*Field
+	for _, obj := range items {
+		err := visitFields(obj, func(f *Field, _ *fn.SubObject) fn.WalkAction {
+			fields = append(fields, f)
+			return fn.WalkSkip
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// List returns the setters referenced in the KubeObjects, sorted by name.
+func List(items fn.KubeObjects) ([]Setter, error) {
+	fields, err := Find(items)
+	if err != nil {
+		return nil, err
+	}
+	setters := map[string]*Setter{}
+	for _, f := range fields {
+		values := inferValues(f)
+		for _, name := range f.Setters {
+			s, ok := setters[name]
+			if !ok {
+				s = &Setter{Name: name, Value: values[name]}
+				setters[name] = s
+			}
+			s.Count++
+		}
+	}
+	var result []Setter
+	for _, s := range setters {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// inferValues infers the setter values from the current field value by
+// matching it against the pattern.
+func inferValues(f *Field) map[string]string {
+	values := map[string]string{}
+	if f.IsList {
+		if len(f.Setters) == 1 {
+			values[f.Setters[0]] = "[" + strings.Join(f.Values, ", ") + "]"
+		}
+		return values
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	last := 0
+	for _, loc := range setterRegex.FindAllStringIndex(f.Pattern, -1) {
+		sb.WriteString(regexp.QuoteMeta(f.Pattern[last:loc[0]]))
+		sb.WriteString("(.*?)")
+		last = loc[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(f.Pattern[last:]))
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return values
+	}
+	m := re.FindStringSubmatch(f.Value)
+	if m == nil {
+		return values
+	}
+	for i, name := range f.Setters {
+		values[name] = m[i+1]
+	}
+	return values
+}
+
+// Apply sets the setter values to the setter fields of the KubeObjects. It
+// returns Warning Results for the setters which are not referenced by any field
+// (unused), and for the fields referencing setters without a value
+// (unresolved). Unresolved fields are left untouched.
+func Apply(items fn.KubeObjects, values map[string]string) (fn.Results, error) {
+	var results fn.Results
+	used := map[string]bool{}
+	for _, obj := range items {
+		err := visitFields(obj, func(f *Field, node *fn.SubObject) fn.WalkAction {
+			var missing []string
+			for _, name := range f.Setters {
+				used[name] = true
+				if _, ok := values[name]; !ok {
+					missing = append(missing, name)
+				}
+			}
+			if len(missing) > 0 {
+				results = append(results, fieldResult(f, fmt.Sprintf("unresolved setters %v: no values provided", missing), fn.Warning))
+				return fn.WalkSkip
+			}
+			value, err := resolve(f, node, values)
+			if err != nil {
+				results = append(results, fieldResult(f, err.Error(), fn.Error))
+				return fn.WalkSkip
+			}
+			return fn.WalkReplace(value)
+		})
+		if err != nil {
+			return results, err
+		}
+	}
+	var unused []string
+	for name := range values {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		results = append(results, fn.GeneralResult(fmt.Sprintf("setter %q is not used by any field", name), fn.Warning))
+	}
+	return results, nil
+}
+
+// resolve computes the new field value from the setter values.
+func resolve(f *Field, node *fn.SubObject, values map[string]string) (interface{}, error) {
+	if f.IsList {
+		if len(f.Setters) != 1 || f.Pattern != "${"+f.Setters[0]+"}" {
+			return nil, fmt.Errorf("list field %v must reference exactly one setter, got %q", f.Path, f.Pattern)
+		}
+		var list []string
+		if v := strings.TrimSpace(values[f.Setters[0]]); v != "" {
+			if err := yaml.Unmarshal([]byte(v), &list); err != nil {
+				return nil, fmt.Errorf("setter %q must be a list for field %v: %v", f.Setters[0], f.Path, err)
+			}
+		}
+		if list == nil {
+			list = []string{}
+		}
+		return list, nil
+	}
+	value := setterRegex.ReplaceAllStringFunc(f.Pattern, func(s string) string {
+		return values[setterRegex.FindStringSubmatch(s)[1]]
+	})
+	// Keep the field type, e.g. `replicas: 3` stays an integer.
+	var s string
+	if node.As(&s) == nil {
+		return value, nil
+	}
+	var typed interface{}
+	if err := yaml.Unmarshal([]byte(value), &typed); err != nil || typed == nil {
+		return value, nil
+	}
+	switch typed.(type) {
+	case int, float64, bool:
+		return typed, nil
+	default:
+		return value, nil
+	}
+}
+
+func fieldResult(f *Field, msg string, severity fn.Severity) *fn.Result {
+	result := fn.ConfigObjectResult(msg, f.Object, severity)
+	result.Field = &fn.Field{Path: f.Path}
+	return result
+}
+
+// ApplySetters is a fn.Runner which applies the setter values given in the
+// `data` of a ConfigMap functionConfig, e.g.
+//
+//	fn.AsMain(fn.WithContext(ctx, &setters.ApplySetters{}))
+type ApplySetters struct {
+	// Data maps the setter names to their values.
+	Data map[string]string `json:"data,omitempty" yaml:"data,omitempty"`
+}
+
+var _ fn.Runner = &ApplySetters{}
+
+func (a *ApplySetters) Run(_ *fn.Context, _ *fn.KubeObject, items fn.KubeObjects, results *fn.Results) bool {
+	res, err := Apply(items, a.Data)
+	*results = append(*results, res...)
+	if err != nil {
+		results.ErrorE(err)
+		return false
+	}
+	return res.ExitCode() == 0
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package setters
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx # kpt-set: ${name}
+spec:
+  replicas: 3 # kpt-set: ${replicas}
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.14.2 # kpt-set: ${image}:${tag}
+        args: # kpt-set: ${args}
+        - --port=80
+        env:
+        - name: PROJECT
+          value: gcr.io/my-project/app # kpt-set: gcr.io/${project}/app
+`
+
+func TestList(t *testing.T) {
+	obj, err := fn.ParseKubeObject([]byte(deployment))
+	require.NoError(t, err)
+	setters, err := List(fn.KubeObjects{obj})
+	require.NoError(t, err)
+	expected := []Setter{
+		{Name: "args", Value: "[--port=80]", Count: 1},
+		{Name: "image", Value: "nginx", Count: 1},
+		{Name: "name", Value: "nginx", Count: 1},
+		{Name: "project", Value: "my-project", Count: 1},
+		{Name: "replicas", Value: "3", Count: 1},
+		{Name: "tag", Value: "1.14.2", Count: 1},
+	}
+	assert.Equal(t, expected, setters)
+
+	fields, err := Find(fn.KubeObjects{obj})
+	require.NoError(t, err)
+	require.Len(t, fields, 5)
+	assert.Equal(t, "spec.template.spec.containers[name=nginx].env[name=PROJECT].value", fields[4].Path)
+}
+
+func TestFindInUnnamedElements(t *testing.T) {
+	obj, err := fn.ParseKubeObject([]byte(`apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: example
+spec:
+  rules:
+  - host: a.example.com
+    port: 80
+  - host: b.example.com # kpt-set: ${host}
+    port: 8080
+  backends:
+  - name: web
+    port: 80 # kpt-set: ${port}
+  - name: web
+    port: 8080
+`))
+	require.NoError(t, err)
+	fields, err := Find(fn.KubeObjects{obj})
+	require.NoError(t, err)
+	var actual []string
+	for _, f := range fields {
+		actual = append(actual, f.Path+"="+f.Value)
+	}
+	assert.Equal(t, []string{"spec.rules[1].host=b.example.com", "spec.backends[name=web].port=80"}, actual)
+}
+
+func TestApplySetters(t *testing.T) {
+	input := []byte(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: nginx # kpt-set: ${name}
+  spec:
+    replicas: 3 # kpt-set: ${replicas}
+    template:
+      spec:
+        containers:
+        - name: nginx
+          image: nginx:1.14.2 # kpt-set: ${image}:${tag}
+          args: # kpt-set: ${args}
+          - --port=80
+          env:
+          - name: PROJECT
+            value: gcr.io/my-project/app # kpt-set: gcr.io/${project}/app
+functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: setters
+  data:
+    name: web
+    replicas: "5"
+    image: nginx
+    tag: "1.21"
+    args: "[--port=8080, --verbose]"
+    unused: foo
+`)
+	out, err := fn.Run(fn.WithContext(context.TODO(), &ApplySetters{}), input)
+	require.NoError(t, err)
+	expected := `apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: web # kpt-set: ${name}
+  spec:
+    replicas: 5 # kpt-set: ${replicas}
+    template:
+      spec:
+        containers:
+        - name: nginx
+          image: nginx:1.21 # kpt-set: ${image}:${tag}
+          args: # kpt-set: ${args}
+          - --port=8080
+          - --verbose
+          env:
+          - name: PROJECT
+            value: gcr.io/my-project/app # kpt-set: gcr.io/${project}/app
+functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: setters
+  data:
+    name: web
+    replicas: "5"
+    image: nginx
+    tag: "1.21"
+    args: "[--port=8080, --verbose]"
+    unused: foo
+results:
+- field:
+    path: spec.template.spec.containers[name=nginx].env[name=PROJECT].value
+  file:
+    index: -1
+  message: 'unresolved setters [project]: no values provided'
+  resourceRef:
+    name: web
+    apiVersion: apps/v1
+    kind: Deployment
+  severity: warning
+- message: setter "unused" is not used by any field
+  severity: warning
+`
+	assert.Equal(t, expected, string(out))
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/kustomize/kyaml/openapi"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/kustomize/kyaml/yaml/merge2"
+	"sigs.k8s.io/kustomize/kyaml/yaml/walk"
+)
+
+// ApplyStrategicMergePatch applies a Kubernetes strategic merge patch to the
+// KubeObject in place. The merge honors the `patchMergeKey` and `patchStrategy`
+// of the built-in Kubernetes kinds, and the `$patch: delete` and
+// `$patch: replace` directives. Comments on the target fields are kept unless
+// the patch provides its own comments for the same fields. The patch object is
+// not modified.
+func (o *KubeObject) ApplyStrategicMergePatch(patch *KubeObject) error {
+	if patch == nil || patch.IsEmpty() {
+		return nil
+	}
+	err := o.writeUnlocked(nil, func(o *SubObject) error {
+		// merge2 may modify the source nodes, so we merge from a copy of the patch.
+		src := yaml.NewRNode(patch.obj.Node()).Copy()
+		dest := yaml.NewRNode(o.obj.Node())
+		result, err := walk.Walker{
+			Sources: []*yaml.RNode{dest, src},
+			Visitor: commentKeepingMerger{},
+			MergeOptions: yaml.MergeOptions{
+				ListIncreaseDirection: yaml.MergeOptionsListAppend,
+			},
+		}.Walk()
+		if err != nil {
+			return err
+		}
+		if result == nil {
+			return fmt.Errorf("the patch deletes the whole object")
+		}
+		if result.YNode() != o.obj.Node() {
+			*o.obj.Node() = *result.YNode()
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to apply strategic merge patch to %v with error: %w", o.ShortString(), err)
+	}
+	return nil
+}
+
+// commentKeepingMerger is a merge2.Merger which keeps the comments of the
+// target scalar fields when they are overridden by the patch.
+type commentKeepingMerger struct {
+	merge2.Merger
+}
+
+func (m commentKeepingMerger) VisitScalar(nodes walk.Sources, s *openapi.ResourceSchema) (*yaml.RNode, error) {
+	dest, origin := nodes.Dest(), nodes.Origin()
+	if dest != nil && dest.YNode() != nil && origin != nil && origin.YNode() != nil {
+		if origin.YNode().HeadComment == "" {
+			origin.YNode().HeadComment = dest.YNode().HeadComment
+		}
+		if origin.YNode().LineComment == "" {
+			origin.YNode().LineComment = dest.YNode().LineComment
+		}
+		if origin.YNode().FootComment == "" {
+			origin.YNode().FootComment = dest.YNode().FootComment
+		}
+	}
+	return m.Merger.VisitScalar(nodes, s)
+}
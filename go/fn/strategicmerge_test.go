@@ -0,0 +1,169 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyStrategicMergePatch(t *testing.T) {
+	target := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx # the deployment name
+  labels:
+    app: nginx
+spec:
+  # keep 3 replicas in prod
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.14.2 # kpt-set: ${image}
+        ports:
+        - containerPort: 80
+      - name: sidecar
+        image: sidecar:v1
+      volumes:
+      - name: data
+        emptyDir: {}
+`)
+	testcases := map[string]struct {
+		patch    string
+		expected string
+	}{
+		"merge by patchMergeKey": {
+			patch: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: nginx
+        resources:
+          limits:
+            cpu: 500m
+`,
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx # the deployment name
+  labels:
+    app: nginx
+spec:
+  # keep 3 replicas in prod
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.14.2 # kpt-set: ${image}
+        ports:
+        - containerPort: 80
+        resources:
+          limits:
+            cpu: 500m
+      - name: sidecar
+        image: sidecar:v1
+      volumes:
+      - name: data
+        emptyDir: {}
+`,
+		},
+		"delete directive": {
+			patch: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        $patch: delete
+`,
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx # the deployment name
+  labels:
+    app: nginx
+spec:
+  # keep 3 replicas in prod
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.14.2 # kpt-set: ${image}
+        ports:
+        - containerPort: 80
+      volumes:
+      - name: data
+        emptyDir: {}
+`,
+		},
+		"replace directive": {
+			patch: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels:
+    $patch: replace
+    tier: web
+`,
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx # the deployment name
+  labels:
+    tier: web
+spec:
+  # keep 3 replicas in prod
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.14.2 # kpt-set: ${image}
+        ports:
+        - containerPort: 80
+      - name: sidecar
+        image: sidecar:v1
+      volumes:
+      - name: data
+        emptyDir: {}
+`,
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			obj, err := ParseKubeObject(target)
+			require.NoError(t, err)
+			patch, err := ParseKubeObject([]byte(tc.patch))
+			require.NoError(t, err)
+			require.NoError(t, obj.ApplyStrategicMergePatch(patch))
+			assert.Equal(t, tc.expected, obj.String())
+			assert.Equal(t, tc.patch, patch.String())
+		})
+	}
+}
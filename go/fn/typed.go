@@ -0,0 +1,57 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+)
+
+// GetNested returns the value of the nested field located by fields converted to
+// type T, whether the field exists, and a potential error. T can be a scalar
+// type (including custom types like `type Protocol string`), a struct with json
+// tags (e.g. corev1.Container), a slice or a map. e.g.
+//
+//	containers, found, err := fn.GetNested[[]corev1.Container](&obj.SubObject, "spec", "template", "spec", "containers")
+//
+// It returns an ErrUnmatchedField error if the field cannot be converted to T.
+func GetNested[T any](o *SubObject, fields ...string) (T, bool, error) {
+	var val T
+	if o == nil || o.obj == nil {
+		return val, false, nil
+	}
+	v, found, err := o.obj.GetNestedValue(fields...)
+	if err != nil {
+		return val, found, NewErrUnmatchedField(*o, fields, val)
+	}
+	if !found {
+		return val, false, nil
+	}
+	if err = internal.MapVariantToTypedObject(internal.NewMap(v.Node()), &val); err != nil {
+		var zero T
+		return zero, true, NewErrUnmatchedField(*o, fields, zero)
+	}
+	return val, true, nil
+}
+
+// SetNested sets value of type T to the nested field located by fields. It
+// accepts the same types as GetNested.
+func SetNested[T any](o *SubObject, value T, fields ...string) error {
+	if o == nil {
+		return fmt.Errorf("the object doesn't exist")
+	}
+	return o.SetNestedField(value, fields...)
+}
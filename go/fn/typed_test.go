@@ -0,0 +1,88 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testProtocol string
+
+type testPort struct {
+	Name     string       `json:"name,omitempty"`
+	Port     int32        `json:"port"`
+	Protocol testProtocol `json:"protocol,omitempty"`
+}
+
+func TestGetNested(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: example
+  labels:
+    app: example
+spec:
+  clusterIP: None
+  ports:
+  - name: http
+    port: 80
+    protocol: TCP
+  - name: https
+    port: 443
+`))
+	require.NoError(t, err)
+
+	ports, found, err := GetNested[[]testPort](&obj.SubObject, "spec", "ports")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []testPort{{Name: "http", Port: 80, Protocol: "TCP"}, {Name: "https", Port: 443}}, ports)
+
+	protocol, found, err := GetNested[testProtocol](&obj.SubObject, "spec", "ports")
+	assert.True(t, found)
+	assert.Equal(t, testProtocol(""), protocol)
+	assert.Equal(t, "Resource(apiVersion=, kind=Service) has unmatched field type \"fn.testProtocol\" in fieldpath .spec.ports", err.Error())
+
+	labels, found, err := GetNested[map[string]string](&obj.SubObject, "metadata", "labels")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, map[string]string{"app": "example"}, labels)
+
+	_, found, err = GetNested[string](&obj.SubObject, "spec", "type")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestSetNested(t *testing.T) {
+	obj := NewEmptyKubeObject()
+	require.NoError(t, SetNested(&obj.SubObject, testProtocol("UDP"), "spec", "protocol"))
+	require.NoError(t, SetNested(&obj.SubObject, int32(8080), "spec", "port"))
+	require.NoError(t, SetNested(&obj.SubObject, []testPort{{Name: "dns", Port: 53, Protocol: "UDP"}}, "spec", "ports"))
+	expected := `spec:
+  protocol: UDP
+  port: 8080
+  ports:
+  - name: dns
+    port: 53
+    protocol: UDP
+`
+	assert.Equal(t, expected, obj.String())
+
+	assert.NoError(t, SetNested(&obj.SubObject, uint64(math.MaxInt64), "spec", "max"))
+	assert.Error(t, SetNested(&obj.SubObject, uint64(math.MaxInt64)+1, "spec", "max"))
+}
@@ -0,0 +1,264 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// UpdateFrom writes a typed object (e.g. an appsv1.Deployment obtained from As
+// and then edited) back to the KubeObject. Unlike NewFromTypedObject or
+// SetNestedField, it merges the typed value into the existing YAML tree: only
+// the fields whose values differ are changed, so the comments, the field order
+// and the quoting style of everything else are kept. Fields missing from the
+// typed value, or null in it, are removed. The null and empty values of the typed
+// value which are missing from the KubeObject, e.g. the `status: {}` and
+// `creationTimestamp: null` of the zero values, are not added. The scalars are
+// compared by value, and the resource quantities, e.g. the `resources.limits` of
+// the containers, are compared as quantities: `1Gi` and `1024Mi` are equal. Sequence
+// elements are matched by their `name` field if they all have a unique one,
+// otherwise by index.
+func (o *KubeObject) UpdateFrom(typed interface{}) error {
+	err := func() error {
+		if typed == nil || (reflect.ValueOf(typed).Kind() == reflect.Ptr && reflect.ValueOf(typed).IsNil()) {
+			return fmt.Errorf("the typed object must not be nil")
+		}
+		updated, err := internal.TypedObjectToMapVariant(typed)
+		if err != nil {
+			return err
+		}
+		updatedObj := asKubeObject(updated)
+		if updatedObj.GetAnnotation(UpstreamIdentifier) != o.GetAnnotation(UpstreamIdentifier) {
+			return ErrAttemptToTouchUpstreamIdentifier{}
+		}
+		return o.writeUnlocked(nil, func(o *SubObject) error {
+			// syncNode reuses the nodes of the desired value, so every write
+			// needs its own copy.
+			syncNode(o.obj.Node(), updated.DeepCopy().Node(), false)
+			return nil
+		})
+	}()
+	if err != nil {
+		return fmt.Errorf("unable to update object from %T with error: %w", typed, err)
+	}
+	return nil
+}
+
+// quantityMaps are the keys of the maps whose values are resource quantities,
+// e.g. the `resources.requests` of a container or the `spec.hard` of a
+// ResourceQuota.
+var quantityMaps = map[string]bool{
+	"requests":    true,
+	"limits":      true,
+	"capacity":    true,
+	"allocatable": true,
+	"hard":        true,
+	"used":        true,
+	"overhead":    true,
+}
+
+// quantityFields are the keys of the resource quantity fields which are not in a
+// quantityMap, e.g. the `sizeLimit` of an emptyDir volume.
+var quantityFields = map[string]bool{
+	"sizeLimit": true,
+}
+
+// syncNode updates the current node in place to have the same value as the
+// desired node, reusing as many of the current nodes as possible. quantity tells
+// whether the node is a resource quantity field.
+func syncNode(current, desired *yaml.Node, quantity bool) {
+	switch {
+	case current.Kind == yaml.MappingNode && desired.Kind == yaml.MappingNode:
+		syncMap(current, desired, quantity)
+	case current.Kind == yaml.SequenceNode && desired.Kind == yaml.SequenceNode:
+		syncSequence(current, desired)
+	case current.Kind == yaml.ScalarNode && desired.Kind == yaml.ScalarNode:
+		syncScalar(current, desired, quantity)
+	default:
+		copyComments(current, desired)
+		*current = *desired
+	}
+}
+
+// syncMap syncs the fields of a map. quantities tells whether its values are
+// resource quantities, see quantityMaps.
+func syncMap(current, desired *yaml.Node, quantities bool) {
+	currentValues := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(current.Content); i += 2 {
+		currentValues[current.Content[i].Value] = current.Content[i+1]
+	}
+	desiredKeys := map[string]bool{}
+	var added []*yaml.Node
+	for i := 0; i+1 < len(desired.Content); i += 2 {
+		key, value := desired.Content[i].Value, desired.Content[i+1]
+		currentValue, found := currentValues[key]
+		switch {
+		case found && isNullNode(value) && !isNullNode(currentValue):
+			// Removed below.
+		case found:
+			desiredKeys[key] = true
+			if currentValue.Kind == yaml.MappingNode {
+				syncNode(currentValue, value, quantityMaps[key])
+			} else {
+				syncNode(currentValue, value, quantities || quantityFields[key])
+			}
+		case !isEmptyNode(value):
+			pruneEmptyFields(value)
+			added = append(added, desired.Content[i], value)
+		}
+	}
+	// Keep the order of the existing fields, and append the new fields.
+	content := current.Content[:0]
+	for i := 0; i+1 < len(current.Content); i += 2 {
+		if desiredKeys[current.Content[i].Value] {
+			content = append(content, current.Content[i], current.Content[i+1])
+		}
+	}
+	current.Content = append(content, added...)
+}
+
+func isNullNode(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.ShortTag() == yaml.NodeTagNull
+}
+
+// isEmptyNode tells whether the node is null, an empty sequence, or a map of
+// such values.
+func isEmptyNode(n *yaml.Node) bool {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return isNullNode(n)
+	case yaml.SequenceNode:
+		return len(n.Content) == 0
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if !isEmptyNode(n.Content[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// pruneEmptyFields removes the empty fields of the maps of a new node, see
+// isEmptyNode.
+func pruneEmptyFields(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		content := n.Content[:0]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if !isEmptyNode(n.Content[i+1]) {
+				pruneEmptyFields(n.Content[i+1])
+				content = append(content, n.Content[i], n.Content[i+1])
+			}
+		}
+		n.Content = content
+	case yaml.SequenceNode:
+		for _, elem := range n.Content {
+			pruneEmptyFields(elem)
+		}
+	}
+}
+
+func syncSequence(current, desired *yaml.Node) {
+	currentNames, currentOk := elementNames(current)
+	desiredNames, desiredOk := elementNames(desired)
+	if currentOk && desiredOk && len(currentNames) > 0 {
+		currentByName := map[string]*yaml.Node{}
+		for i, name := range currentNames {
+			currentByName[name] = current.Content[i]
+		}
+		content := make([]*yaml.Node, 0, len(desired.Content))
+		for i, name := range desiredNames {
+			if elem, found := currentByName[name]; found {
+				syncNode(elem, desired.Content[i], false)
+				content = append(content, elem)
+			} else {
+				pruneEmptyFields(desired.Content[i])
+				content = append(content, desired.Content[i])
+			}
+		}
+		current.Content = content
+		return
+	}
+	for i, elem := range desired.Content {
+		if i < len(current.Content) {
+			syncNode(current.Content[i], elem, false)
+		} else {
+			pruneEmptyFields(elem)
+			current.Content = append(current.Content, elem)
+		}
+	}
+	if len(current.Content) > len(desired.Content) {
+		current.Content = current.Content[:len(desired.Content)]
+	}
+}
+
+func syncScalar(current, desired *yaml.Node, quantity bool) {
+	if scalarEqual(current, desired, quantity) {
+		return
+	}
+	// Keep the quoting style if the value is still a string.
+	if current.Tag != yaml.NodeTagString || desired.Tag != yaml.NodeTagString {
+		current.Style = 0
+	}
+	current.Tag = desired.Tag
+	current.Value = desired.Value
+}
+
+// scalarEqual compares the values of two scalar nodes, e.g. `80` and `80.0` are
+// equal while `80` and `"80"`, or `true` and `"true"` are not. If quantity is
+// true, the scalars are compared as resource quantities, e.g. `1Gi` and `1024Mi`,
+// or `0.5` and `"500m"` are equal. A number and a string holding the same
+// quantity are equal too, since the typed quantities are always strings, e.g. the
+// `cpu: 1` of the YAML becomes "1".
+func scalarEqual(a, b *yaml.Node, quantity bool) bool {
+	if quantity && quantityEqual(a, b) {
+		return true
+	}
+	var va, vb interface{}
+	if a.Decode(&va) != nil || b.Decode(&vb) != nil {
+		return a.Tag == b.Tag && a.Value == b.Value
+	}
+	ja, errA := json.Marshal(va)
+	jb, errB := json.Marshal(vb)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(va, vb)
+	}
+	return string(ja) == string(jb)
+}
+
+// quantityEqual tells whether the two scalars are equal quantities.
+func quantityEqual(a, b *yaml.Node) bool {
+	isQuantity := func(n *yaml.Node) bool {
+		switch n.ShortTag() {
+		case yaml.NodeTagString, yaml.NodeTagInt, yaml.NodeTagFloat:
+			return true
+		}
+		return false
+	}
+	if !isQuantity(a) || !isQuantity(b) {
+		return false
+	}
+	qa, errA := apiresource.ParseQuantity(a.Value)
+	qb, errB := apiresource.ParseQuantity(b.Value)
+	return errA == nil && errB == nil && qa.Cmp(qb) == 0
+}
@@ -0,0 +1,167 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+type testContainer struct {
+	Name  string   `json:"name"`
+	Image string   `json:"image,omitempty"`
+	Args  []string `json:"args,omitempty"`
+}
+
+type testDeployment struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name        string            `json:"name"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas   int             `json:"replicas"`
+		Containers []testContainer `json:"containers"`
+	} `json:"spec"`
+}
+
+func TestUpdateFrom(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(`# the deployment
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx # kpt-set: ${name}
+  annotations:
+    owner: 'team-a'
+spec:
+  # prod needs 3 replicas
+  replicas: 3
+  containers:
+  - name: sidecar
+    image: "sidecar:v1" # kpt-set: ${sidecar-image}
+  - name: nginx
+    image: nginx:1.14.2 # kpt-set: ${image}
+    args:
+    - --port=80
+`))
+	require.NoError(t, err)
+
+	var d testDeployment
+	require.NoError(t, obj.As(&d))
+	d.Spec.Replicas = 5
+	d.Spec.Containers[1].Image = "nginx:1.21"
+	d.Spec.Containers[1].Args = nil
+	d.Spec.Containers = append(d.Spec.Containers, testContainer{Name: "logger", Image: "logger:v1"})
+	require.NoError(t, obj.UpdateFrom(&d))
+
+	expected := `# the deployment
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx # kpt-set: ${name}
+  annotations:
+    owner: 'team-a'
+spec:
+  # prod needs 3 replicas
+  replicas: 5
+  containers:
+  - name: sidecar
+    image: "sidecar:v1" # kpt-set: ${sidecar-image}
+  - name: nginx
+    image: nginx:1.21 # kpt-set: ${image}
+  - name: logger
+    image: logger:v1
+`
+	assert.Equal(t, expected, obj.String())
+
+	d.Metadata.Annotations[UpstreamIdentifier] = "apps|Deployment|default|nginx"
+	assert.Error(t, obj.UpdateFrom(d))
+}
+
+func TestScalarEqual(t *testing.T) {
+	testcases := map[string]struct {
+		a, b     string
+		quantity bool
+		expected bool
+	}{
+		"same number":                  {a: `80`, b: `80.0`, expected: true},
+		"number and string":            {a: `80`, b: `"80"`, expected: false},
+		"bool and string":              {a: `true`, b: `"true"`, expected: false},
+		"numeric strings":              {a: `"1"`, b: `"1.0"`, expected: false},
+		"quantity strings":             {a: `1k`, b: `"1000"`, expected: false},
+		"quantities":                   {a: `1024Mi`, b: `1Gi`, quantity: true, expected: true},
+		"number and quantity":          {a: `0.5`, b: `"500m"`, quantity: true, expected: true},
+		"number and string quantities": {a: `1`, b: `"1"`, quantity: true, expected: true},
+		"different quantities":         {a: `1Gi`, b: `1G`, quantity: true, expected: false},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			a, b := yaml.MustParse(tc.a).YNode(), yaml.MustParse(tc.b).YNode()
+			assert.Equal(t, tc.expected, scalarEqual(a, b, tc.quantity))
+		})
+	}
+}
+
+func TestUpdateFromQuantities(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+  annotations:
+    size: 1k
+spec:
+  containers:
+  - name: app
+    resources:
+      limits:
+        cpu: 500m # half a core
+        memory: 1Gi
+    env:
+    - name: RATIO
+      value: "0.5"
+`))
+	require.NoError(t, err)
+
+	var pod map[string]interface{}
+	require.NoError(t, obj.As(&pod))
+	pod["metadata"].(map[string]interface{})["annotations"] = map[string]interface{}{"size": "1000"}
+	container := pod["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	container["resources"] = map[string]interface{}{"limits": map[string]interface{}{"cpu": 0.5, "memory": "1024Mi"}}
+	container["env"].([]interface{})[0].(map[string]interface{})["value"] = "500m"
+	require.NoError(t, obj.UpdateFrom(pod))
+
+	expected := `apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+  annotations:
+    size: "1000"
+spec:
+  containers:
+  - name: app
+    resources:
+      limits:
+        cpu: 500m # half a core
+        memory: 1Gi
+    env:
+    - name: RATIO
+      value: "500m"
+`
+	assert.Equal(t, expected, obj.String())
+}
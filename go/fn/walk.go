@@ -0,0 +1,217 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// PathElement is a single step of the path to a node visited by Walk. It is
+// either a map field or a sequence element.
+type PathElement struct {
+	// Field is the map key. It is empty for sequence elements.
+	Field string
+	// Index is the index of a sequence element. It is -1 for map fields.
+	Index int
+	// Key and Value identify a sequence element by its `name` field, if the
+	// element is a map which has one, e.g. Key "name" and Value "nginx".
+	Key   string
+	Value string
+}
+
+// IsSequenceElement tells whether the PathElement refers to a sequence element.
+func (e PathElement) IsSequenceElement() bool {
+	return e.Index >= 0
+}
+
+// String returns the PathElement in the path expression syntax accepted by GetPath,
+// e.g. `spec`, `[name=nginx]` or `[0]`.
+func (e PathElement) String() string {
+	switch {
+	case !e.IsSequenceElement():
+		return strings.TrimPrefix(fieldPathKeys(e.Field), ".")
+	case e.Key != "":
+		return selectorString(e.Key, e.Value)
+	default:
+		return fmt.Sprintf("[%d]", e.Index)
+	}
+}
+
+// PathString joins the path elements to a path expression, e.g.
+// `spec.template.spec.containers[name=nginx].image`.
+func PathString(path []PathElement) string {
+	var sb strings.Builder
+	for _, e := range path {
+		if e.IsSequenceElement() {
+			sb.WriteString(e.String())
+		} else {
+			sb.WriteString(fieldPathKeys(e.Field))
+		}
+	}
+	return strings.TrimPrefix(sb.String(), ".")
+}
+
+type walkActionKind int
+
+const (
+	walkContinue walkActionKind = iota
+	walkSkip
+	walkStop
+	walkReplace
+)
+
+// WalkAction tells Walk what to do after a node has been visited.
+type WalkAction struct {
+	kind  walkActionKind
+	value interface{}
+}
+
+var (
+	// WalkContinue continues the walk into the children of the node.
+	WalkContinue = WalkAction{kind: walkContinue}
+	// WalkSkip skips the children of the node.
+	WalkSkip = WalkAction{kind: walkSkip}
+	// WalkStop stops the walk.
+	WalkStop = WalkAction{kind: walkStop}
+)
+
+// WalkReplace replaces the value of the node with val and skips its children.
+// val accepts the same types as SetNestedField. The comments on the node are kept.
+func WalkReplace(val interface{}) WalkAction {
+	return WalkAction{kind: walkReplace, value: val}
+}
+
+// Walk visits every field and sequence element under the SubObject in depth-first
+// order. visitor receives the full path of the node relative to the SubObject,
+// and the node as a SubObject whose fieldpath is resolved. Use IsMap, IsSlice
+// and IsScalar to tell the node type, and As to read its value. The fields
+// merged by a `<<` merge key are visited like the own fields of the map, and a
+// YAML alias like the value it refers to. WalkReplace never modifies a shared
+// value, see AliasWriteMode. e.g.
+//
+//	err := obj.Walk(func(path []fn.PathElement, node *fn.SubObject) fn.WalkAction {
+//		var s string
+//		if node.IsScalar() && node.As(&s) == nil && strings.HasPrefix(s, "AKIA") {
+//			return fn.WalkReplace("REDACTED")
+//		}
+//		return fn.WalkContinue
+//	})
+func (o *SubObject) Walk(visitor func(path []PathElement, node *SubObject) WalkAction) error {
+	if o == nil || o.obj == nil {
+		return nil
+	}
+	_, err := o.walk(o.obj.Node(), nil, nil, o.fieldpath, visitor)
+	return err
+}
+
+// walk visits the children of node. It returns false if the walk should stop.
+// The merged fields of the maps are visited like their own fields, and the
+// aliases are visited as the values they refer to. segments locate node from
+// the SubObject.
+func (o *SubObject) walk(node *yaml.Node, path []PathElement, segments []pathSegment, fieldpath string,
+	visitor func(path []PathElement, node *SubObject) WalkAction) (bool, error) {
+	type child struct {
+		node      *yaml.Node
+		elem      PathElement
+		segment   pathSegment
+		fieldpath string
+	}
+	var children []child
+	switch node = internal.ResolveAlias(node); node.Kind {
+	case yaml.MappingNode:
+		keys, values := internal.MappingFields(node)
+		for i, k := range keys {
+			children = append(children, child{
+				node:      values[i],
+				elem:      PathElement{Field: k.Value, Index: -1},
+				segment:   pathSegment{kind: segmentField, key: k.Value},
+				fieldpath: fieldpath + fieldPathKeys(k.Value),
+			})
+		}
+	case yaml.SequenceNode:
+		for i, elem := range node.Content {
+			elem = internal.ResolveAlias(elem)
+			pe := PathElement{Index: i}
+			if elem.Kind == yaml.MappingNode {
+				if name, found, err := internal.NewMap(elem).GetNestedString("name"); err == nil && found {
+					pe.Key, pe.Value = "name", name
+				}
+			}
+			children = append(children, child{
+				node:      elem,
+				elem:      pe,
+				segment:   pathSegment{kind: segmentIndex, index: i},
+				fieldpath: fieldpath + pe.String(),
+			})
+		}
+	}
+	for _, c := range children {
+		childPath := append(append([]PathElement{}, path...), c.elem)
+		childSegments := append(append([]pathSegment{}, segments...), c.segment)
+		sub := &SubObject{obj: internal.NewMap(c.node), parentGVK: o.parentGVK, fieldpath: c.fieldpath, root: o.rootNode()}
+		action := visitor(childPath, sub)
+		switch action.kind {
+		case walkStop:
+			return false, nil
+		case walkSkip:
+			continue
+		case walkReplace:
+			replacement, err := toYNode(action.value)
+			if err != nil {
+				return false, fmt.Errorf("unable to replace the value at %v with error: %w", PathString(childPath), err)
+			}
+			// The node is replaced through its path, so that a value shared
+			// through an alias or a merge key is copied first.
+			err = o.writeUnlocked(childSegments, func(o *SubObject) error {
+				matches, err := o.matchPath(childSegments, true)
+				if err != nil || len(matches) == 0 {
+					return err
+				}
+				node := matches[0].node
+				copyComments(node, replacement)
+				*node = *replacement
+				return nil
+			})
+			if err != nil {
+				return false, err
+			}
+			continue
+		}
+		cont, err := o.walk(c.node, childPath, childSegments, c.fieldpath, visitor)
+		if err != nil || !cont {
+			return cont, err
+		}
+	}
+	return true, nil
+}
+
+// IsMap tells whether the SubObject is a map.
+func (o *SubObject) IsMap() bool {
+	return o.obj != nil && o.obj.Node().Kind == yaml.MappingNode
+}
+
+// IsSlice tells whether the SubObject is a sequence, e.g. a node visited by Walk.
+func (o *SubObject) IsSlice() bool {
+	return o.obj != nil && o.obj.Node().Kind == yaml.SequenceNode
+}
+
+// IsScalar tells whether the SubObject is a scalar value, e.g. a node visited by Walk.
+func (o *SubObject) IsScalar() bool {
+	return o.obj != nil && o.obj.Node().Kind == yaml.ScalarNode
+}
@@ -0,0 +1,198 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalk(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: example
+spec:
+  containers:
+  - name: app
+    env:
+    - name: TOKEN
+      value: AKIA1234 # the token
+    args: [a, b]
+  volumes:
+  - name: data
+`))
+	require.NoError(t, err)
+
+	var paths []string
+	err = obj.Walk(func(path []PathElement, node *SubObject) WalkAction {
+		if len(path) == 1 && path[0].Field == "metadata" {
+			return WalkSkip
+		}
+		paths = append(paths, PathString(path))
+		assert.Equal(t, PathString(path), node.FieldPath())
+		var s string
+		if node.IsScalar() && node.As(&s) == nil && strings.HasPrefix(s, "AKIA") {
+			return WalkReplace("REDACTED")
+		}
+		if len(path) > 0 && path[len(path)-1].Field == "args" {
+			return WalkStop
+		}
+		return WalkContinue
+	})
+	require.NoError(t, err)
+	expected := []string{
+		"apiVersion",
+		"kind",
+		"spec",
+		"spec.containers",
+		"spec.containers[name=app]",
+		"spec.containers[name=app].name",
+		"spec.containers[name=app].env",
+		"spec.containers[name=app].env[name=TOKEN]",
+		"spec.containers[name=app].env[name=TOKEN].name",
+		"spec.containers[name=app].env[name=TOKEN].value",
+		"spec.containers[name=app].args",
+	}
+	assert.Equal(t, expected, paths)
+	value, _, _ := obj.NestedSlice("spec", "containers")
+	env := value[0].GetSlice("env")
+	assert.Equal(t, "REDACTED", env[0].GetString("value"))
+	assert.Contains(t, obj.String(), "value: REDACTED # the token")
+}
+
+func TestWalkAliases(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: example
+spec:
+  containers:
+  - &app
+    name: app
+    env: &env
+    - name: TOKEN
+      value: AKIA1234
+  - <<: *app
+    name: sidecar
+  initContainers:
+  - *app
+  volumes:
+  - name: data
+    secret:
+      env: *env
+`))
+	require.NoError(t, err)
+
+	var paths []string
+	err = obj.Walk(func(path []PathElement, node *SubObject) WalkAction {
+		if len(path) == 1 && path[0].Field != "spec" {
+			return WalkSkip
+		}
+		paths = append(paths, PathString(path))
+		var s string
+		if node.IsScalar() && node.As(&s) == nil && strings.HasPrefix(s, "AKIA") {
+			return WalkReplace("REDACTED")
+		}
+		return WalkContinue
+	})
+	require.NoError(t, err)
+	expected := []string{
+		"spec",
+		"spec.containers",
+		"spec.containers[name=app]",
+		"spec.containers[name=app].name",
+		"spec.containers[name=app].env",
+		"spec.containers[name=app].env[name=TOKEN]",
+		"spec.containers[name=app].env[name=TOKEN].name",
+		"spec.containers[name=app].env[name=TOKEN].value",
+		"spec.containers[name=sidecar]",
+		"spec.containers[name=sidecar].name",
+		"spec.containers[name=sidecar].env",
+		"spec.containers[name=sidecar].env[name=TOKEN]",
+		"spec.containers[name=sidecar].env[name=TOKEN].name",
+		"spec.containers[name=sidecar].env[name=TOKEN].value",
+		"spec.initContainers",
+		"spec.initContainers[name=app]",
+		"spec.initContainers[name=app].name",
+		"spec.initContainers[name=app].env",
+		"spec.initContainers[name=app].env[name=TOKEN]",
+		"spec.initContainers[name=app].env[name=TOKEN].name",
+		"spec.initContainers[name=app].env[name=TOKEN].value",
+		"spec.volumes",
+		"spec.volumes[name=data]",
+		"spec.volumes[name=data].name",
+		"spec.volumes[name=data].secret",
+		"spec.volumes[name=data].secret.env",
+		"spec.volumes[name=data].secret.env[name=TOKEN]",
+		"spec.volumes[name=data].secret.env[name=TOKEN].name",
+		"spec.volumes[name=data].secret.env[name=TOKEN].value",
+	}
+	assert.Equal(t, expected, paths)
+	// Every shared value is replaced.
+	for _, path := range []string{
+		"spec.containers[name=app].env[name=TOKEN].value",
+		"spec.containers[name=sidecar].env[name=TOKEN].value",
+		"spec.initContainers[name=app].env[name=TOKEN].value",
+		"spec.volumes[name=data].secret.env[name=TOKEN].value",
+	} {
+		matches, err := obj.GetPath(path)
+		require.NoError(t, err)
+		require.Len(t, matches, 1, path)
+		var value string
+		require.NoError(t, matches[0].As(&value))
+		assert.Equal(t, "REDACTED", value, path)
+	}
+}
+
+func TestWalkReplaceAlias(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: example
+  labels: &labels
+    app: web
+  annotations:
+    <<: *labels
+    owner: team-a
+data:
+  labels: *labels
+`))
+	require.NoError(t, err)
+
+	// Only the merged field is replaced, not the anchor.
+	err = obj.Walk(func(path []PathElement, node *SubObject) WalkAction {
+		if PathString(path) == "metadata.annotations.app" {
+			return WalkReplace("api")
+		}
+		return WalkContinue
+	})
+	require.NoError(t, err)
+	// Only the aliased value is replaced, not the anchor.
+	err = obj.Walk(func(path []PathElement, node *SubObject) WalkAction {
+		if PathString(path) == "data.labels" {
+			return WalkReplace(map[string]string{"app": "db"})
+		}
+		return WalkContinue
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"app": "web"}, obj.GetLabels())
+	assert.Equal(t, map[string]string{"app": "api", "owner": "team-a"}, obj.GetAnnotations())
+	app, _, _ := obj.NestedString("data", "labels", "app")
+	assert.Equal(t, "db", app)
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn/internal"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ContainerKind tells which list of a PodSpec a container belongs to.
+type ContainerKind string
+
+const (
+	// Containers are the containers in `containers`.
+	Containers ContainerKind = "containers"
+	// InitContainers are the containers in `initContainers`.
+	InitContainers ContainerKind = "initContainers"
+	// EphemeralContainers are the containers in `ephemeralContainers`.
+	EphemeralContainers ContainerKind = "ephemeralContainers"
+)
+
+// podSpecFields records where the PodSpec is in each built-in workload kind.
+var podSpecFields = map[schema.GroupKind][]string{
+	{Group: "", Kind: "Pod"}:                   {"spec"},
+	{Group: "", Kind: "PodTemplate"}:           {"template", "spec"},
+	{Group: "", Kind: "ReplicationController"}: {"spec", "template", "spec"},
+	{Group: "apps", Kind: "Deployment"}:        {"spec", "template", "spec"},
+	{Group: "apps", Kind: "StatefulSet"}:       {"spec", "template", "spec"},
+	{Group: "apps", Kind: "DaemonSet"}:         {"spec", "template", "spec"},
+	{Group: "apps", Kind: "ReplicaSet"}:        {"spec", "template", "spec"},
+	{Group: "extensions", Kind: "Deployment"}:  {"spec", "template", "spec"},
+	{Group: "extensions", Kind: "DaemonSet"}:   {"spec", "template", "spec"},
+	{Group: "extensions", Kind: "ReplicaSet"}:  {"spec", "template", "spec"},
+	{Group: "batch", Kind: "Job"}:              {"spec", "template", "spec"},
+	{Group: "batch", Kind: "CronJob"}:          {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// IsWorkload tells whether the KubeObject is a built-in kind which has a PodSpec,
+// e.g. Pod, Deployment or CronJob.
+func (o *KubeObject) IsWorkload() bool {
+	_, ok := podSpecFields[o.GroupKind()]
+	return ok
+}
+
+// PodSpec returns the PodSpec of a built-in workload kind as a SubObject, e.g.
+// `spec.template.spec` of a Deployment or `spec.jobTemplate.spec.template.spec`
+// of a CronJob. It returns false if the KubeObject is not a workload or the
+// PodSpec does not exist.
+func (o *KubeObject) PodSpec() (*SubObject, bool, error) {
+	fields, ok := podSpecFields[o.GroupKind()]
+	if !ok {
+		return nil, false, nil
+	}
+	podSpec, found, err := o.NestedSubObject(fields...)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	podSpec.parentGVK = o.GroupVersionKind()
+	return &podSpec, true, nil
+}
+
+// VisitContainers calls visitor on every container, init container and
+// ephemeral container of a built-in workload kind. Each container SubObject has
+// its fieldpath resolved, e.g. `spec.template.spec.containers[name=nginx]`, so
+// it can be used to fill in Result.Field.Path. It stops at the first error
+// returned by visitor. Non-workload KubeObjects are skipped.
+func (o *KubeObject) VisitContainers(visitor func(container *SubObject, kind ContainerKind) error) error {
+	podSpec, found, err := o.PodSpec()
+	if err != nil || !found {
+		return err
+	}
+	for _, kind := range []ContainerKind{InitContainers, Containers, EphemeralContainers} {
+		list, found, err := podSpec.obj.GetNestedSlice(string(kind))
+		if err != nil {
+			return NewErrUnmatchedField(*podSpec, []string{string(kind)}, SliceSubObjects{})
+		}
+		if !found {
+			continue
+		}
+		for i, node := range list.Node().Content {
+			if node.Kind != yaml.MappingNode {
+				elem := *podSpec
+				elem.fieldpath += fieldPathKeys(string(kind)) + pathSegment{kind: segmentIndex, index: i}.String()
+				return NewErrUnmatchedField(elem, nil, SubObject{})
+			}
+			container := &SubObject{
+				obj:       internal.NewMap(node),
+				parentGVK: podSpec.parentGVK,
+				fieldpath: podSpec.fieldpath + "." + containerSelector(kind, i, node),
+				root:      podSpec.rootNode(),
+			}
+			if err := visitor(container, kind); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// containerSelector selects a container by name if it has one, otherwise by index.
+func containerSelector(kind ContainerKind, i int, node *yaml.Node) string {
+	name, found, err := internal.NewMap(node).GetNestedString("name")
+	if err != nil || !found || name == "" {
+		return fmt.Sprintf("%s[%d]", kind, i)
+	}
+	return string(kind) + selectorString("name", name)
+}
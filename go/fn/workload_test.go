@@ -0,0 +1,124 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisitContainers(t *testing.T) {
+	testcases := map[string]struct {
+		input    string
+		expected []string
+	}{
+		"Pod": {
+			input: `apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+spec:
+  containers:
+  - name: app
+    image: app:v1
+  ephemeralContainers:
+  - name: debug
+    image: busybox
+`,
+			expected: []string{
+				"containers spec.containers[name=app] app:v1",
+				"ephemeralContainers spec.ephemeralContainers[name=debug] busybox",
+			},
+		},
+		"Deployment": {
+			input: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: deploy
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: init:v1
+      containers:
+      - image: app:v1
+`,
+			expected: []string{
+				"initContainers spec.template.spec.initContainers[name=init] init:v1",
+				"containers spec.template.spec.containers[0] app:v1",
+			},
+		},
+		"CronJob": {
+			input: `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cron
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job
+            image: job:v1
+`,
+			expected: []string{
+				"containers spec.jobTemplate.spec.template.spec.containers[name=job] job:v1",
+			},
+		},
+		"not a workload": {
+			input: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+`,
+		},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			obj, err := ParseKubeObject([]byte(tc.input))
+			require.NoError(t, err)
+			var visited []string
+			err = obj.VisitContainers(func(container *SubObject, kind ContainerKind) error {
+				visited = append(visited, fmt.Sprintf("%s %s %s", kind, container.FieldPath(), container.GetString("image")))
+				return container.SetNestedString("Always", "imagePullPolicy")
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, visited)
+		})
+	}
+}
+
+func TestPodSpec(t *testing.T) {
+	obj, err := ParseKubeObject([]byte(`apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    spec:
+      serviceAccountName: db
+`))
+	require.NoError(t, err)
+	podSpec, found, err := obj.PodSpec()
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "db", podSpec.GetString("serviceAccountName"))
+	assert.Equal(t, "spec.template.spec", podSpec.FieldPath())
+}